@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Endpoints of the providers, replaced in tests
+var (
+	graphURL           = "https://graph.microsoft.com/v1.0"
+	googleCalendarURL  = "https://www.googleapis.com/calendar/v3"
+	googleTokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+	googleRevokeURL    = "https://oauth2.googleapis.com/revoke"
+)
+
+// Identity describes the signed-in user and the token.
+type Identity struct {
+	Name  string
+	Email string
+	// Tenant is the directory of a Microsoft account
+	Tenant string
+	// Scopes granted to the token
+	Scopes []string
+	// Expiry of the access token
+	Expiry time.Time
+}
+
+// WhoAmI returns the signed-in user, asking the API of the provider.
+// It doesn't sign in if there is no valid token.
+func (a *Auth) WhoAmI() (*Identity, error) {
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	token, err := a.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	identity, err := a.whoami(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), token)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Tenant == "" {
+		identity.Tenant = a.TenantID
+	}
+	identity.Expiry = token.Expiry
+	return identity, nil
+}
+
+// Logout deletes the saved token. If revoke is set, the sessions or the grant of the
+// token are revoked first at the provider, so that the token can't be used anymore.
+func (a *Auth) Logout(revoke bool) error {
+	err := a.load()
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil
+	}
+	if a.source == nil {
+		return err
+	}
+	if revoke {
+		if err != nil {
+			return err
+		}
+		token, err := a.source.Token()
+		if err != nil {
+			return fmt.Errorf("failed to get token to revoke: %w", err)
+		}
+		ctx := context.Background()
+		if err := a.revoke(ctx, oauth2.NewClient(ctx, oauth2.StaticTokenSource(token)), token); err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+	}
+	a.source.setToken(nil)
+	return a.Store.Delete()
+}
+
+// jwtClaims returns the claims of a JWT without verifying it, or nil if the token is not a JWT.
+// Access tokens of Microsoft are JWTs, but are not guaranteed to be.
+func jwtClaims(token string) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// getJSON decodes the response of a GET request.
+func getJSON(ctx context.Context, client *http.Client, url string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API request failed with status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// DOC: https://learn.microsoft.com/en-us/graph/api/user-get
+func microsoftWhoAmI(ctx context.Context, client *http.Client, token *oauth2.Token) (*Identity, error) {
+	var me struct {
+		DisplayName       string `json:"displayName"`
+		UserPrincipalName string `json:"userPrincipalName"`
+		Mail              string `json:"mail"`
+	}
+	if err := getJSON(ctx, client, graphURL+"/me?$select=displayName,userPrincipalName,mail", &me); err != nil {
+		return nil, err
+	}
+	identity := &Identity{Name: me.DisplayName, Email: me.Mail}
+	if identity.Email == "" {
+		identity.Email = me.UserPrincipalName
+	}
+	claims := jwtClaims(token.AccessToken)
+	if tid, ok := claims["tid"].(string); ok {
+		identity.Tenant = tid
+	}
+	if scp, ok := claims["scp"].(string); ok {
+		identity.Scopes = strings.Fields(scp)
+	}
+	return identity, nil
+}
+
+// microsoftRevoke signs the user out of all sessions, which invalidates the refresh tokens
+// of all apps. It requires the User.RevokeSessions.All permission.
+// DOC: https://learn.microsoft.com/en-us/graph/api/user-revokesigninsessions
+func microsoftRevoke(ctx context.Context, client *http.Client, token *oauth2.Token) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", graphURL+"/me/revokeSignInSessions", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API request failed with status: %s", resp.Status)
+	}
+	return nil
+}
+
+// googleWhoAmI identifies the user by the primary calendar, whose id is the address of the user,
+// as the token has no scope to read the profile.
+// DOC: https://developers.google.com/identity/protocols/oauth2/native-app#tokeninfo
+func googleWhoAmI(ctx context.Context, client *http.Client, token *oauth2.Token) (*Identity, error) {
+	var calendar struct {
+		ID      string `json:"id"`
+		Summary string `json:"summary"`
+	}
+	if err := getJSON(ctx, client, googleCalendarURL+"/calendars/primary", &calendar); err != nil {
+		return nil, err
+	}
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := getJSON(ctx, client, googleTokenInfoURL+"?access_token="+url.QueryEscape(token.AccessToken), &info); err != nil {
+		return nil, err
+	}
+	return &Identity{Name: calendar.Summary, Email: calendar.ID, Scopes: strings.Fields(info.Scope)}, nil
+}
+
+// googleRevoke revokes the grant of the app, which invalidates its access and refresh tokens.
+// DOC: https://developers.google.com/identity/protocols/oauth2/native-app#tokenrevoke
+func googleRevoke(ctx context.Context, client *http.Client, token *oauth2.Token) error {
+	revoked := token.RefreshToken
+	if revoked == "" {
+		revoked = token.AccessToken
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", googleRevokeURL, strings.NewReader(url.Values{"token": {revoked}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API request failed with status: %s", resp.Status)
+	}
+	return nil
+}
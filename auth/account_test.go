@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// savedAuth returns an Auth of the provider with a valid token saved.
+func savedAuth(t *testing.T, a *Auth, accessToken string) *Auth {
+	a.Store = &FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}
+	require.NoError(t, a.Store.Save(&oauth2.Token{
+		AccessToken:  accessToken,
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(time.Hour),
+	}))
+	return a
+}
+
+func TestMicrosoftWhoAmI(t *testing.T) {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"tid":"tenant-id","scp":"Calendars.Read User.Read"}`))
+	accessToken := "header." + claims + ".signature"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/me", r.URL.Path)
+		assert.Equal(t, "Bearer "+accessToken, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"displayName":"Alex Doe","userPrincipalName":"alex@example.com","mail":null}`))
+	}))
+	t.Cleanup(server.Close)
+	graphURL = server.URL
+	t.Cleanup(func() { graphURL = "https://graph.microsoft.com/v1.0" })
+
+	a := savedAuth(t, NewMicrosoft("client", "", "http://localhost:9091/callback", "common", nil, LoginBrowser), accessToken)
+	identity, err := a.WhoAmI()
+	require.NoError(t, err)
+	assert.Equal(t, "Alex Doe", identity.Name)
+	assert.Equal(t, "alex@example.com", identity.Email)
+	assert.Equal(t, "tenant-id", identity.Tenant)
+	assert.Equal(t, []string{"Calendars.Read", "User.Read"}, identity.Scopes)
+}
+
+func TestWhoAmINotSignedIn(t *testing.T) {
+	a := NewMicrosoft("client", "", "http://localhost:9091/callback", "common", &FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}, LoginBrowser)
+	_, err := a.WhoAmI()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestGoogleLogout(t *testing.T) {
+	var revoked string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		revoked = r.PostForm.Get("token")
+	}))
+	t.Cleanup(server.Close)
+	googleRevokeURL = server.URL
+	t.Cleanup(func() { googleRevokeURL = "https://oauth2.googleapis.com/revoke" })
+
+	// Without revoke, only the saved token is deleted
+	a := savedAuth(t, NewGoogle("client", "", "http://localhost:9091/callback", nil, LoginBrowser), "access")
+	require.NoError(t, a.Logout(false))
+	assert.Empty(t, revoked)
+	_, err := a.Store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	// Signing out again is not an error
+	a = NewGoogle("client", "", "http://localhost:9091/callback", a.Store, LoginBrowser)
+	require.NoError(t, a.Logout(true))
+	assert.Empty(t, revoked)
+
+	a = savedAuth(t, NewGoogle("client", "", "http://localhost:9091/callback", nil, LoginBrowser), "access")
+	require.NoError(t, a.Logout(true))
+	assert.Equal(t, "refresh", revoked)
+	_, err = a.Store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestLogoutRevokeFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	graphURL = server.URL
+	t.Cleanup(func() { graphURL = "https://graph.microsoft.com/v1.0" })
+
+	// The token is kept, so that the user can retry
+	a := savedAuth(t, NewMicrosoft("client", "", "http://localhost:9091/callback", "common", nil, LoginBrowser), "access")
+	assert.ErrorContains(t, a.Logout(true), "403")
+	_, err := a.Store.Load()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"golang.org/x/oauth2/microsoft"
+)
+
+// appOnlyScope requests all the application permissions granted to the app in Microsoft Graph.
+// DOC: https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-client-creds-grant-flow
+const appOnlyScope = "https://graph.microsoft.com/.default"
+
+// Client assertions are valid for this long, and a new one is made for each token request
+const assertionLifetime = 10 * time.Minute
+
+// NewAppOnly returns the tokens of the app itself, authenticated by a client secret,
+// to read the mailboxes with the application permissions of the app, without a user signing in.
+func NewAppOnly(tenantID, clientID, clientSecret string) oauth2.TokenSource {
+	return newClientSecretSource(microsoft.AzureADEndpoint(tenantID).TokenURL, clientID, clientSecret)
+}
+
+// NewAppOnlyWithCertificate returns the tokens of the app itself, authenticated by a JWT assertion
+// signed with the private key of a certificate uploaded to the app registration.
+// certFile is a PEM file with the certificate, and the private key too if keyFile is empty.
+func NewAppOnlyWithCertificate(tenantID, clientID, certFile, keyFile string) (oauth2.TokenSource, error) {
+	cert, key, err := loadCertificate(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return newClientAssertionSource(microsoft.AzureADEndpoint(tenantID).TokenURL, clientID, cert, key), nil
+}
+
+func newClientSecretSource(tokenURL, clientID, clientSecret string) oauth2.TokenSource {
+	config := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       []string{appOnlyScope},
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	return config.TokenSource(context.Background())
+}
+
+// clientAssertionSource requests tokens with a new client assertion each time.
+// DOC: https://learn.microsoft.com/en-us/entra/identity-platform/certificate-credentials
+type clientAssertionSource struct {
+	tokenURL string
+	clientID string
+	cert     *x509.Certificate
+	key      *rsa.PrivateKey
+}
+
+func newClientAssertionSource(tokenURL, clientID string, cert *x509.Certificate, key *rsa.PrivateKey) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &clientAssertionSource{tokenURL: tokenURL, clientID: clientID, cert: cert, key: key})
+}
+
+func (s *clientAssertionSource) Token() (*oauth2.Token, error) {
+	assertion, err := s.assertion(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client assertion: %w", err)
+	}
+	config := &clientcredentials.Config{
+		ClientID: s.clientID,
+		TokenURL: s.tokenURL,
+		Scopes:   []string{appOnlyScope},
+		EndpointParams: url.Values{
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {assertion},
+		},
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	return config.Token(context.Background())
+}
+
+// assertion returns a JWT signed with RS256, identifying the certificate by its SHA-1 thumbprint.
+func (s *clientAssertionSource) assertion(now time.Time) (string, error) {
+	thumbprint := sha1.Sum(s.cert.Raw)
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	})
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomState()
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": s.tokenURL,
+		"iss": s.clientID,
+		"sub": s.clientID,
+		"jti": jti,
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(assertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// loadCertificate reads a certificate and its RSA private key from PEM files.
+// The key is read from certFile if keyFile is empty.
+func loadCertificate(certFile, keyFile string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	if keyFile != "" {
+		keyData, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		data = append(data, keyData...)
+	}
+
+	var cert *x509.Certificate
+	var key *rsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			// The first certificate is the one of the app, followed by its chain
+			if cert == nil {
+				if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+					return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+				}
+			}
+		case "RSA PRIVATE KEY":
+			if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				return nil, nil, errors.New("private key must be an RSA key")
+			}
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, nil, errors.New("encrypted private keys are not supported")
+		}
+	}
+	if cert == nil {
+		return nil, nil, errors.New("no certificate found")
+	}
+	if key == nil {
+		return nil, nil, errors.New("no private key found")
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, nil, errors.New("private key doesn't match the certificate")
+	}
+	return cert, key, nil
+}
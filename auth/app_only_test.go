@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSecretSource(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "client", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+		assert.Equal(t, appOnlyScope, r.PostForm.Get("scope"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"app","token_type":"Bearer","expires_in":3599}`))
+	}))
+	t.Cleanup(server.Close)
+
+	source := newClientSecretSource(server.URL, "client", "secret")
+	for range 2 {
+		token, err := source.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "app", token.AccessToken)
+	}
+	// The token is reused until it expires
+	assert.Equal(t, 1, requests)
+}
+
+// writeCertificate writes a self-signed certificate and its key to a PEM file.
+func writeCertificate(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "meeting-reminder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	path := filepath.Join(t.TempDir(), "app.pem")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestClientAssertionSource(t *testing.T) {
+	certFile := writeCertificate(t)
+	cert, key, err := loadCertificate(certFile, "")
+	require.NoError(t, err)
+	var tokenURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Empty(t, r.PostForm.Get("client_secret"))
+		assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", r.PostForm.Get("client_assertion_type"))
+
+		// The assertion is signed by the key of the certificate
+		parts := strings.Split(r.PostForm.Get("client_assertion"), ".")
+		require.Len(t, parts, 3)
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signature))
+
+		var header map[string]string
+		data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		require.NoError(t, json.Unmarshal(data, &header))
+		assert.Equal(t, "RS256", header["alg"])
+		assert.NotEmpty(t, header["x5t"])
+
+		claims := jwtClaims(r.PostForm.Get("client_assertion"))
+		assert.Equal(t, tokenURL, claims["aud"])
+		assert.Equal(t, "client", claims["iss"])
+		assert.Equal(t, "client", claims["sub"])
+		assert.NotEmpty(t, claims["jti"])
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"app","token_type":"Bearer","expires_in":3599}`))
+	}))
+	t.Cleanup(server.Close)
+	tokenURL = server.URL + "/tenant/oauth2/v2.0/token"
+
+	token, err := newClientAssertionSource(tokenURL, "client", cert, key).Token()
+	require.NoError(t, err)
+	assert.Equal(t, "app", token.AccessToken)
+}
+
+func TestLoadCertificate(t *testing.T) {
+	certFile := writeCertificate(t)
+	otherFile := writeCertificate(t)
+
+	_, _, err := loadCertificate(certFile, "")
+	assert.NoError(t, err)
+
+	// The key of another certificate is rejected
+	data, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	block, _ := pem.Decode(data)
+	onlyCert := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(onlyCert, pem.EncodeToMemory(block), 0600))
+	_, _, err = loadCertificate(onlyCert, "")
+	assert.ErrorContains(t, err, "no private key found")
+	_, _, err = loadCertificate(onlyCert, otherFile)
+	assert.ErrorContains(t, err, "doesn't match")
+}
@@ -2,168 +2,367 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/kajikentaro/meeting-reminder/utils"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
 	"golang.org/x/oauth2/microsoft"
 )
 
+// LoginFlow is how the user signs in when there is no valid token.
+type LoginFlow string
+
+const (
+	// LoginBrowser signs in with the browser on this machine, redirected back to the app.
+	LoginBrowser LoginFlow = "browser"
+	// LoginDeviceCode shows a code to enter in a browser on any device, for machines without one.
+	LoginDeviceCode LoginFlow = "device"
+)
+
 type Auth struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
 	TenantID     string
+	Store        TokenStore
+	Flow         LoginFlow
 	OAuth2Config *oauth2.Config
-	Token        *oauth2.Token
+	// OnReloginRequired is called with where to sign in again, when the token can't be
+	// refreshed while running. Defaults to opening the browser.
+	OnReloginRequired Prompt
+
+	// authCodeOpts are the parameters of the authorization request of the provider
+	authCodeOpts []oauth2.AuthCodeOption
+	// whoami and revoke call the APIs of the provider
+	whoami func(ctx context.Context, client *http.Client, token *oauth2.Token) (*Identity, error)
+	revoke func(ctx context.Context, client *http.Client, token *oauth2.Token) error
+	source *persistingTokenSource
+
+	mu        sync.Mutex
+	relogging bool
 }
 
-func NewAuth(clientID, clientSecret, redirectURL, tenantID string) (*Auth, error) {
-	endpoint := microsoft.AzureADEndpoint(tenantID)
+// Prompt shows the user where to sign in: the URL to open, and with the device code flow,
+// the code to enter there.
+type Prompt func(url, userCode string)
+
+// Interactive logins are done one at a time, as they share the callback port
+// and the attention of the user.
+var loginMu sync.Mutex
+
+// NewAuth signs in to a Microsoft account and saves the token to store.
+// If store is nil, the token is saved to the file returned by GetTokenFilePath.
+// clientSecret may be empty if the app is registered as a public client.
+func NewAuth(clientID, clientSecret, redirectURL, tenantID string, store TokenStore, flow LoginFlow) (*Auth, error) {
+	authInstance := NewMicrosoft(clientID, clientSecret, redirectURL, tenantID, store, flow)
+	if err := authInstance.SignIn(); err != nil {
+		return nil, err
+	}
+	return authInstance, nil
+}
+
+// NewMicrosoft creates the auth of a Microsoft account without signing in.
+func NewMicrosoft(clientID, clientSecret, redirectURL, tenantID string, store TokenStore, flow LoginFlow) *Auth {
 	authInstance := &Auth{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
 		TenantID:     tenantID,
+		Store:        store,
+		Flow:         flow,
+		OAuth2Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"https://graph.microsoft.com/Calendars.Read", "https://graph.microsoft.com/Calendars.Read.Shared", "https://graph.microsoft.com/User.Read", "offline_access"},
+			Endpoint:     microsoft.AzureADEndpoint(tenantID),
+		},
+		// Let the user pick the account, as the browser may already be signed in to another one
+		authCodeOpts: []oauth2.AuthCodeOption{oauth2.SetAuthURLParam("prompt", "select_account")},
+		whoami:       microsoftWhoAmI,
+		revoke:       microsoftRevoke,
+	}
+	authInstance.usePublicClient()
+	return authInstance
+}
+
+// NewGoogleAuth signs in to a Google account with the installed application flow,
+// and saves the token to store.
+// If store is nil, the token is saved to the file returned by GetTokenFilePath.
+func NewGoogleAuth(clientID, clientSecret, redirectURL string, store TokenStore, flow LoginFlow) (*Auth, error) {
+	authInstance := NewGoogle(clientID, clientSecret, redirectURL, store, flow)
+	if err := authInstance.SignIn(); err != nil {
+		return nil, err
+	}
+	return authInstance, nil
+}
+
+// NewGoogle creates the auth of a Google account without signing in.
+func NewGoogle(clientID, clientSecret, redirectURL string, store TokenStore, flow LoginFlow) *Auth {
+	authInstance := &Auth{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Store:        store,
+		Flow:         flow,
 		OAuth2Config: &oauth2.Config{
 			ClientID:     clientID,
 			ClientSecret: clientSecret,
 			RedirectURL:  redirectURL,
-			Scopes:       []string{"https://graph.microsoft.com/Calendars.Read", "offline_access"},
-			Endpoint:     endpoint,
+			Scopes:       []string{"https://www.googleapis.com/auth/calendar.readonly"},
+			Endpoint:     endpoints.Google,
 		},
+		// A refresh token is only issued for offline access, and again only if consent is asked
+		authCodeOpts: []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "select_account consent")},
+		whoami:       googleWhoAmI,
+		revoke:       googleRevoke,
 	}
+	authInstance.usePublicClient()
+	return authInstance
+}
 
+// usePublicClient sends only the client id to the token endpoint if there is no client secret.
+// Public clients are rejected if they authenticate with an empty secret.
+func (a *Auth) usePublicClient() {
+	if a.ClientSecret == "" {
+		a.OAuth2Config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+}
+
+// load sets up the token source with the saved token, unless it is done already.
+// It returns the error of loading the token, like ErrTokenNotFound.
+func (a *Auth) load() error {
+	if a.source != nil {
+		return nil
+	}
+	if a.Store == nil {
+		tokenPath, err := GetTokenFilePath()
+		if err != nil {
+			return err
+		}
+		a.Store = &FileTokenStore{Path: tokenPath}
+	}
+	token, err := a.Store.Load()
+	a.source = newPersistingTokenSource(a.OAuth2Config, a.Store, token)
+	return err
+}
+
+// SignIn loads the saved token, or authenticates interactively if there is no valid one.
+func (a *Auth) SignIn() error {
 	// Check for saved token
-	token, err := loadToken()
+	err := a.load()
 	if err == nil {
 		log.Println("Loaded saved token, checking validity...")
-		authInstance.Token = token
-		if _, err = authInstance.GetAccessToken(); err == nil {
+		if _, err = a.source.Token(); err == nil {
 			log.Println("Saved token is valid, using it for authentication.")
-			return authInstance, nil
+			return nil
 		}
 		log.Println("Saved token is invalid, starting authentication process...")
-	} else {
+	} else if errors.Is(err, ErrTokenNotFound) {
 		log.Println("No saved token found, starting authentication process...")
+	} else {
+		log.Printf("Failed to load saved token, starting authentication process: %v", err)
 	}
+	return a.Login()
+}
 
-	token, err = authenticate(authInstance.OAuth2Config)
+// Resume loads the saved token like SignIn, but instead of authenticating interactively if there
+// is no valid one, it returns ErrReloginRequired.
+func (a *Auth) Resume() error {
+	err := a.load()
+	if errors.Is(err, ErrTokenNotFound) {
+		return fmt.Errorf("%w: no saved token", ErrReloginRequired)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to authenticate: %w", err)
+		return err
 	}
-	authInstance.Token = token
+	_, err = a.source.Token()
+	return err
+}
 
-	if err := saveToken(authInstance.Token); err != nil {
-		return nil, fmt.Errorf("failed to save token: %w", err)
+// Login authenticates interactively even if a valid token is saved, and saves the new token.
+func (a *Auth) Login() error {
+	if err := a.load(); err != nil && a.source == nil {
+		return err
+	}
+	token, err := a.login(nil)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
 	}
+	a.source.setToken(token)
 
-	return authInstance, nil
+	if err := a.Store.Save(token); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+	return nil
 }
 
-func (a *Auth) GetAccessToken() (*oauth2.Token, error) {
-	if a.Token.Valid() {
-		return a.Token, nil
+// login signs in interactively with the flow of the account.
+// prompt shows where to sign in, and if it is nil, the browser is opened.
+func (a *Auth) login(prompt Prompt) (*oauth2.Token, error) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	if a.Flow == LoginDeviceCode {
+		return authenticateWithDeviceCode(context.Background(), a.OAuth2Config, prompt)
 	}
-
-	if a.Token.RefreshToken != "" {
-		log.Println("Refreshing access token...")
-		ts := a.OAuth2Config.TokenSource(context.Background(), a.Token)
-		token, err := ts.Token()
-		if err != nil {
-			return nil, fmt.Errorf("failed to refresh token: %w", err)
-		}
-		a.Token = token
-		if err := saveToken(a.Token); err != nil {
-			log.Printf("Failed to save refreshed token: %v", err)
-		}
-		return a.Token, nil
+	if prompt == nil {
+		prompt = func(url, _ string) { _ = utils.OpenBrowser(context.Background(), url) }
 	}
-
-	return nil, fmt.Errorf("no valid refresh token available")
+	return authenticate(a.OAuth2Config, prompt, a.authCodeOpts...)
 }
 
-func authenticate(config *oauth2.Config) (*oauth2.Token, error) {
-	state := "random_state" // Random string for CSRF protection
-	authURL := config.AuthCodeURL(state)
+// Token returns a valid access token, refreshing it ahead of its expiry.
+// It is safe to call from several goroutines, which then share a single refresh.
+// If the user has to sign in again, a login is started in the background, and
+// ErrReloginRequired is returned until it completes.
+func (a *Auth) Token() (*oauth2.Token, error) {
+	token, err := a.source.Token()
+	if errors.Is(err, ErrReloginRequired) {
+		a.startRelogin()
+	}
+	return token, err
+}
 
-	log.Printf("Open the following URL in your browser to authenticate:\n%s\n", authURL)
+// startRelogin signs in again in the background, unless a login is already in progress.
+func (a *Auth) startRelogin() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.relogging {
+		return
+	}
+	a.relogging = true
 
-	codeCh := make(chan string)
-	srv := &http.Server{Addr: ":9091"}
+	go func() {
+		defer func() {
+			a.mu.Lock()
+			a.relogging = false
+			a.mu.Unlock()
+		}()
 
-	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Query().Get("state") != state {
-			http.Error(w, "State mismatch", http.StatusBadRequest)
-			return
-		}
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			http.Error(w, "Code not found", http.StatusBadRequest)
+		log.Println("Re-login required, starting authentication process...")
+		token, err := a.login(a.OnReloginRequired)
+		if err != nil {
+			log.Printf("Re-login failed: %v", err)
 			return
 		}
-		fmt.Fprintf(w, "Authentication completed. You can close this window.")
-		codeCh <- code
-	})
-
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("ListenAndServe(): %v", err)
+		a.source.setToken(token)
+		if err := a.Store.Save(token); err != nil {
+			log.Printf("Failed to save token: %v", err)
 		}
+		log.Println("Re-login completed")
 	}()
+}
 
-	_ = openBrowser(authURL)
-
-	code := <-codeCh
+// GetAccessToken is the same as Token.
+func (a *Auth) GetAccessToken() (*oauth2.Token, error) {
+	return a.Token()
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	_ = srv.Shutdown(ctx)
+// authenticate signs in with the authorization code flow in the browser.
+// The code is bound to this login with PKCE and a random state, so that a client
+// secret is not needed and a code sent to the callback by someone else is rejected.
+// prompt is called with the URL of the login.
+func authenticate(config *oauth2.Config, prompt Prompt, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	state, err := randomState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate state: %w", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+	opts = append(opts, oauth2.S256ChallengeOption(verifier))
 
-	token, err := config.Exchange(context.TODO(), code)
+	resultCh := make(chan callbackResult, 1)
+	server, err := startCallbackServer(config.RedirectURL, callbackHandler(state, resultCh))
 	if err != nil {
 		return nil, err
 	}
+	defer server.shutdown()
 
-	return token, nil
-}
+	// The redirect URL has the port actually listened on, if it was chosen by the system
+	loginConfig := *config
+	loginConfig.RedirectURL = server.redirectURL
+	authURL := loginConfig.AuthCodeURL(state, opts...)
 
-func saveToken(token *oauth2.Token) error {
-	tokenPath, err := GetTokenFilePath()
-	if err != nil {
-		return err
+	log.Printf("Open the following URL in your browser to authenticate:\n%s\n", authURL)
+
+	prompt(authURL, "")
+
+	var result callbackResult
+	select {
+	case result = <-resultCh:
+	case <-time.After(loginTimeout):
+		return nil, fmt.Errorf("login timed out after %s", loginTimeout)
 	}
-	data, err := json.Marshal(token)
+
+	if result.err != nil {
+		return nil, result.err
+	}
+	token, err := loginConfig.Exchange(context.TODO(), result.code, oauth2.VerifierOption(verifier))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return os.WriteFile(tokenPath, data, 0600)
+
+	return token, nil
 }
 
-func loadToken() (*oauth2.Token, error) {
-	tokenPath, err := GetTokenFilePath()
+// authenticateWithDeviceCode signs in with the device authorization grant. The user enters
+// the shown code in a browser on any device, while the token endpoint is polled.
+// prompt is called with the verification URL and the code, if it is not nil.
+// DOC: https://www.rfc-editor.org/rfc/rfc8628
+func authenticateWithDeviceCode(ctx context.Context, config *oauth2.Config, prompt Prompt) (*oauth2.Token, error) {
+	deviceAuth, err := config.DeviceAuth(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to start device login: %w", err)
+	}
+
+	// The log may be written to a file, so the code is also shown in the terminal
+	message := fmt.Sprintf("To sign in, open %s in a browser on any device and enter the code %s", deviceAuth.VerificationURI, deviceAuth.UserCode)
+	if deviceAuth.VerificationURIComplete != "" {
+		message += fmt.Sprintf(", or open %s", deviceAuth.VerificationURIComplete)
 	}
-	data, err := os.ReadFile(tokenPath)
+	log.Println(message)
+	fmt.Fprintln(os.Stderr, message)
+	if prompt != nil {
+		prompt(deviceAuth.VerificationURI, deviceAuth.UserCode)
+	}
+
+	// authorization_pending and slow_down are handled while polling
+	token, err := config.DeviceAccessToken(ctx, deviceAuth)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("device login failed: %w", err)
 	}
-	var token oauth2.Token
-	if err := json.Unmarshal(data, &token); err != nil {
-		return nil, err
+	return token, nil
+}
+
+// randomState returns an unguessable state of a login, for CSRF protection.
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return &token, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
 func GetTokenFilePath() (string, error) {
+	return GetAccountTokenFilePath("")
+}
+
+// GetAccountTokenFilePath returns the default token path of a named account.
+// An empty name gives the same path as GetTokenFilePath.
+func GetAccountTokenFilePath(account string) (string, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
@@ -172,20 +371,27 @@ func GetTokenFilePath() (string, error) {
 	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return "", err
 	}
-	tokenPath := filepath.Join(configDir, "token.json")
+	name := "token.json"
+	if account != "" {
+		name = "token-" + sanitizeFileName(account) + ".json"
+	}
+	tokenPath := filepath.Join(configDir, name)
 	return tokenPath, nil
 }
 
-func openBrowser(url string) error {
-	// Branch commands by OS
-	switch runtime.GOOS {
-	case "windows":
-		return utils.ExecCommand("rundll32", "url.dll,FileProtocolHandler", url)
-	case "darwin":
-		return utils.ExecCommand("open", url)
-	case "linux":
-		return utils.ExecCommand("xdg-open", url)
-	default:
-		return fmt.Errorf("unsupported platform")
+// sanitizeFileName replaces the characters of the name which may not be in a file name.
+// If any is replaced, a short hash of the name is appended, so that names like "a/b" and
+// "a_b" don't share a file.
+func sanitizeFileName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+	if sanitized == name {
+		return name
 	}
+	sum := sha256.Sum256([]byte(name))
+	return sanitized + "-" + hex.EncodeToString(sum[:4])
 }
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestRandomState(t *testing.T) {
+	a, err := randomState()
+	require.NoError(t, err)
+	b, err := randomState()
+	require.NoError(t, err)
+	assert.Len(t, a, 43)
+	assert.NotEqual(t, a, b)
+}
+
+func TestAuthenticateWithDeviceCode(t *testing.T) {
+	var polls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client", r.PostForm.Get("client_id"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/devicecode":
+			assert.Equal(t, "calendars", r.PostForm.Get("scope"))
+			w.Write([]byte(`{"device_code":"device","user_code":"ABCD-EFGH","verification_uri":"https://example.com/device","expires_in":900,"interval":1}`))
+		case "/token":
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:device_code", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "device", r.PostForm.Get("device_code"))
+			polls++
+			if polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"authorization_pending"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":3600}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Scopes:   []string{"calendars"},
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: server.URL + "/devicecode",
+			TokenURL:      server.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+	token, err := authenticateWithDeviceCode(context.Background(), config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "access", token.AccessToken)
+	assert.Equal(t, "refresh", token.RefreshToken)
+	assert.Equal(t, 2, polls)
+}
+
+func TestRelogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/devicecode":
+			w.Write([]byte(`{"device_code":"device","user_code":"ABCD-EFGH","verification_uri":"https://example.com/device","expires_in":900,"interval":1}`))
+		case r.PostForm.Get("grant_type") == "refresh_token":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"The refresh token has expired."}`))
+		default:
+			w.Write([]byte(`{"access_token":"new-access","refresh_token":"new-refresh","token_type":"Bearer","expires_in":3600}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: server.URL + "/devicecode",
+			TokenURL:      server.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+	store := &FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}
+	prompts := make(chan string, 2)
+	a := &Auth{
+		Flow:              LoginDeviceCode,
+		Store:             store,
+		OAuth2Config:      config,
+		OnReloginRequired: func(url, userCode string) { prompts <- url + " " + userCode },
+		source:            newPersistingTokenSource(config, store, &oauth2.Token{AccessToken: "old", RefreshToken: "old", Expiry: time.Now()}),
+	}
+
+	// The user is asked to sign in once, while the token is requested again
+	_, err := a.Token()
+	assert.ErrorIs(t, err, ErrReloginRequired)
+	_, err = a.Token()
+	assert.ErrorIs(t, err, ErrReloginRequired)
+	assert.Equal(t, "https://example.com/device ABCD-EFGH", <-prompts)
+
+	require.Eventually(t, func() bool {
+		token, err := a.Token()
+		return err == nil && token.AccessToken == "new-access"
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.Empty(t, prompts)
+	saved, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "new-refresh", saved.RefreshToken)
+}
+
+func TestResume(t *testing.T) {
+	config := &oauth2.Config{ClientID: "client"}
+	store := &FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}
+
+	// Without a saved token, the user is not asked to sign in
+	a := &Auth{Flow: LoginDeviceCode, Store: store, OAuth2Config: config}
+	assert.ErrorIs(t, a.Resume(), ErrReloginRequired)
+
+	require.NoError(t, store.Save(&oauth2.Token{AccessToken: "saved", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}))
+	a = &Auth{Flow: LoginDeviceCode, Store: store, OAuth2Config: config}
+	require.NoError(t, a.Resume())
+	token, err := a.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "saved", token.AccessToken)
+}
+
+func TestGetAccountTokenFilePath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	work, err := GetAccountTokenFilePath("Work")
+	require.NoError(t, err)
+	assert.Equal(t, "token-Work.json", filepath.Base(work))
+
+	// Names whose characters are replaced don't share a file with others
+	slash, err := GetAccountTokenFilePath("a/b")
+	require.NoError(t, err)
+	underscore, err := GetAccountTokenFilePath("a_b")
+	require.NoError(t, err)
+	assert.Equal(t, "token-a_b.json", filepath.Base(underscore))
+	assert.NotEqual(t, underscore, slash)
+	assert.Regexp(t, `^token-a_b-[0-9a-f]{8}\.json$`, filepath.Base(slash))
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The login fails if the user doesn't complete it in this time
+const loginTimeout = 5 * time.Minute
+
+// callbackServer receives the redirect of the authorization server on the loopback interface.
+type callbackServer struct {
+	// redirectURL is the redirect URL with the port listened on
+	redirectURL string
+	server      *http.Server
+}
+
+// startCallbackServer listens for the redirect to redirectURL, which must be a loopback http URL.
+// If its port is 0, the port is chosen by the system, and set in the redirect URL of the server.
+// "localhost" is listened on both 127.0.0.1 and ::1, as the browser may resolve it to either.
+func startCallbackServer(redirectURL string, handler http.Handler) (*callbackServer, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URL: %w", err)
+	}
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("redirect URL must be an http URL: %s", redirectURL)
+	}
+	host := u.Hostname()
+	var addrs []string
+	if host == "localhost" {
+		addrs = []string{"127.0.0.1", "::1"}
+	} else if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		addrs = []string{host}
+	} else {
+		return nil, fmt.Errorf("redirect URL must be on localhost or a loopback address: %s", redirectURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	var listeners []net.Listener
+	for i, addr := range addrs {
+		listener, err := net.Listen("tcp", net.JoinHostPort(addr, port))
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("failed to listen for the login callback: %w", err)
+			}
+			// IPv6 may be unavailable
+			log.Printf("Failed to listen for the login callback on %s: %v", addr, err)
+			continue
+		}
+		if port == "0" {
+			// Other addresses listen on the same port
+			port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+		}
+		listeners = append(listeners, listener)
+	}
+	u.Host = net.JoinHostPort(host, port)
+
+	// A private mux, so that logins don't conflict on http.DefaultServeMux
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	s := &callbackServer{
+		redirectURL: u.String(),
+		server:      &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}
+	for _, listener := range listeners {
+		go func() {
+			if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Login callback server stopped: %v", err)
+			}
+		}()
+	}
+	return s, nil
+}
+
+func (s *callbackServer) shutdown() {
+	// The page of the callback is given time to be sent
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.server.Shutdown(ctx)
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>Meeting Reminder</title>
+		<style>
+			body {
+				background: {{if .Failed}}#d70036{{else}}#0078D7{{end}};
+				color: white;
+				display: flex;
+				justify-content: center;
+				align-items: center;
+				margin: 0;
+				flex-direction: column;
+				min-height: 100vh;
+				font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, 'Open Sans', 'Helvetica Neue', sans-serif;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>{{.Title}}</h1>
+		<p>{{.Message}}</p>
+	</body>
+</html>
+`))
+
+// writeCallbackPage responds to the browser with a page telling the result of the login.
+func writeCallbackPage(w http.ResponseWriter, status int, title, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = callbackPage.Execute(w, struct {
+		Failed         bool
+		Title, Message string
+	}{status != http.StatusOK, title, message})
+}
+
+// callbackHandler receives the redirect of the authorization server, and sends
+// the authorization code or the error of the login to resultCh once.
+// Requests without the state of the login are rejected and don't end the login,
+// as they are not the response to it.
+func callbackHandler(state string, resultCh chan<- callbackResult) http.Handler {
+	var once sync.Once
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+			writeCallbackPage(w, http.StatusBadRequest, "Authentication failed", "The request doesn't belong to the login in progress. Start the login again from the app.")
+			return
+		}
+
+		var result callbackResult
+		// DOC: https://www.rfc-editor.org/rfc/rfc6749#section-4.1.2.1
+		if errorCode := query.Get("error"); errorCode != "" {
+			result.err = fmt.Errorf("authorization failed: %s: %s", errorCode, query.Get("error_description"))
+		} else if result.code = query.Get("code"); result.code == "" {
+			result.err = fmt.Errorf("authorization code not found in the callback")
+		}
+
+		sent := false
+		once.Do(func() {
+			resultCh <- result
+			sent = true
+		})
+		switch {
+		case !sent:
+			writeCallbackPage(w, http.StatusConflict, "Already signed in", "The login has already been completed. You can close this window.")
+		case result.err != nil:
+			writeCallbackPage(w, http.StatusBadRequest, "Authentication failed", result.err.Error())
+		default:
+			writeCallbackPage(w, http.StatusOK, "Authentication completed", "You can close this window and return to the app.")
+		}
+	})
+}
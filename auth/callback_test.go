@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestCallbackHandler(t *testing.T) {
+	resultCh := make(chan callbackResult, 1)
+	handler := callbackHandler("expected-state", resultCh)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/callback?"+query, nil))
+		return w
+	}
+
+	// Requests not answering the login are ignored
+	assert.Equal(t, http.StatusBadRequest, get("code=forged&state=other").Code)
+	assert.Equal(t, http.StatusBadRequest, get("code=forged").Code)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/callback?code=forged&state=expected-state", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Empty(t, resultCh)
+
+	assert.Equal(t, http.StatusOK, get("code=the-code&state=expected-state").Code)
+	require.Len(t, resultCh, 1)
+	result := <-resultCh
+	assert.NoError(t, result.err)
+	assert.Equal(t, "the-code", result.code)
+
+	// The login ends with the first response
+	assert.Equal(t, http.StatusConflict, get("code=other-code&state=expected-state").Code)
+	assert.Empty(t, resultCh)
+}
+
+func TestCallbackHandlerError(t *testing.T) {
+	resultCh := make(chan callbackResult, 1)
+	w := httptest.NewRecorder()
+	callbackHandler("s", resultCh).ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"/callback?error=access_denied&error_description=The+user+cancelled&state=s", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	result := <-resultCh
+	assert.EqualError(t, result.err, "authorization failed: access_denied: The user cancelled")
+}
+
+func TestStartCallbackServer(t *testing.T) {
+	_, err := startCallbackServer("http://0.0.0.0:0/callback", http.NotFoundHandler())
+	assert.ErrorContains(t, err, "loopback")
+	_, err = startCallbackServer("http://example.com/callback", http.NotFoundHandler())
+	assert.ErrorContains(t, err, "loopback")
+	_, err = startCallbackServer("https://localhost:0/callback", http.NotFoundHandler())
+	assert.Error(t, err)
+
+	server, err := startCallbackServer("http://127.0.0.1:0/oauth/callback", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	require.NoError(t, err)
+	defer server.shutdown()
+	assert.NotContains(t, server.redirectURL, ":0/")
+
+	resp, err := http.Get(server.redirectURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "ok", string(body))
+
+	// Only the callback path is served
+	resp, err = http.Get(strings.TrimSuffix(server.redirectURL, "/oauth/callback") + "/other")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The port is in use
+	_, err = startCallbackServer(server.redirectURL, http.NotFoundHandler())
+	assert.ErrorContains(t, err, "failed to listen")
+}
+
+func TestAuthenticate(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "the-code", r.PostForm.Get("code"))
+		assert.NotEmpty(t, r.PostForm.Get("code_verifier"))
+		assert.Contains(t, r.PostForm.Get("redirect_uri"), "http://localhost:")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(tokenServer.Close)
+	config := &oauth2.Config{
+		ClientID:    "client",
+		RedirectURL: "http://localhost:0/callback",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   "https://login.example.com/authorize",
+			TokenURL:  tokenServer.URL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+
+	// The browser is redirected to the callback after signing in
+	var page string
+	token, err := authenticate(config, func(authURL, _ string) {
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		query := u.Query()
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+		redirect := fmt.Sprintf("%s?code=the-code&state=%s", query.Get("redirect_uri"), query.Get("state"))
+		resp, err := http.Get(strings.Replace(redirect, "localhost", "127.0.0.1", 1))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		page = string(body)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "access", token.AccessToken)
+	assert.Contains(t, page, "Authentication completed")
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/metrics"
+	"golang.org/x/oauth2"
+)
+
+// ErrReloginRequired is returned when the token can't be refreshed anymore,
+// like when the refresh token is revoked or has expired, and the user has to sign in again.
+var ErrReloginRequired = errors.New("re-login required")
+
+// Access tokens are refreshed this long before they expire, so that a token
+// doesn't expire while a request using it is in flight.
+const refreshAhead = 5 * time.Minute
+
+// persistingTokenSource is an oauth2.TokenSource refreshing the token with its refresh token,
+// and saving every new token to the store, as refresh tokens may be rotated on each refresh.
+// It is safe for concurrent use, and concurrent callers share a single refresh.
+type persistingTokenSource struct {
+	config *oauth2.Config
+	store  TokenStore
+
+	mu    sync.Mutex
+	token *oauth2.Token
+	// revoked is set if the refresh token was rejected, until a new token is set
+	revoked bool
+}
+
+func newPersistingTokenSource(config *oauth2.Config, store TokenStore, token *oauth2.Token) *persistingTokenSource {
+	return &persistingTokenSource{config: config, store: store, token: token}
+}
+
+// Token returns the current token, refreshing it if it expires soon.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == nil {
+		return nil, fmt.Errorf("%w: not signed in", ErrReloginRequired)
+	}
+	if s.revoked {
+		return nil, fmt.Errorf("%w: the refresh token was rejected", ErrReloginRequired)
+	}
+	if s.token.AccessToken != "" && (s.token.Expiry.IsZero() || time.Now().Add(refreshAhead).Before(s.token.Expiry)) {
+		return cloneToken(s.token), nil
+	}
+	if s.token.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: no valid refresh token available", ErrReloginRequired)
+	}
+
+	log.Println("Refreshing access token...")
+	// Without the access token, the token is refreshed even if it hasn't expired yet
+	token, err := s.config.TokenSource(context.Background(), &oauth2.Token{RefreshToken: s.token.RefreshToken}).Token()
+	if err != nil {
+		// The refresh token is not retried once rejected, while other failures may be temporary
+		// DOC: https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			s.revoked = true
+			metrics.TokenRefreshes.WithLabelValues("reauth").Inc()
+			return nil, fmt.Errorf("%w: failed to refresh token: %v", ErrReloginRequired, err)
+		}
+		metrics.TokenRefreshes.WithLabelValues(metrics.Failure).Inc()
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	metrics.TokenRefreshes.WithLabelValues(metrics.Success).Inc()
+	s.token = token
+	if err := s.store.Save(token); err != nil {
+		log.Printf("Failed to save refreshed token: %v", err)
+	}
+	return cloneToken(token), nil
+}
+
+// setToken replaces the token, after signing in again.
+func (s *persistingTokenSource) setToken(token *oauth2.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+	s.revoked = false
+}
+
+// cloneToken copies the token, so that callers can't modify the token of the source.
+func cloneToken(token *oauth2.Token) *oauth2.Token {
+	clone := *token
+	return &clone
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// tokenServer rotates the refresh token on each refresh.
+func tokenServer(t *testing.T, refreshes *atomic.Int32) *oauth2.Config {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		n := refreshes.Add(1)
+		assert.Equal(t, fmt.Sprintf("refresh-%d", n-1), r.PostForm.Get("refresh_token"))
+		// Give concurrent callers time to pile up
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh-%d","token_type":"Bearer","expires_in":3600}`, n, n)
+	}))
+	t.Cleanup(server.Close)
+	return &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	var refreshes atomic.Int32
+	config := tokenServer(t, &refreshes)
+	store := &FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}
+	source := newPersistingTokenSource(config, store, &oauth2.Token{
+		AccessToken:  "access-0",
+		RefreshToken: "refresh-0",
+		Expiry:       time.Now().Add(time.Hour),
+	})
+
+	// A valid token is used as is
+	token, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "access-0", token.AccessToken)
+	assert.Equal(t, int32(0), refreshes.Load())
+
+	// The token is refreshed once by concurrent callers, ahead of its expiry
+	source.token.Expiry = time.Now().Add(refreshAhead - time.Second)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token()
+			assert.NoError(t, err)
+			assert.Equal(t, "access-1", token.AccessToken)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), refreshes.Load())
+
+	// The rotated refresh token is saved
+	saved, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "refresh-1", saved.RefreshToken)
+
+	// Modifying a returned token doesn't affect the source
+	token.AccessToken = "modified"
+	token, err = source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", token.AccessToken)
+}
+
+func TestPersistingTokenSourceWithoutRefreshToken(t *testing.T) {
+	source := newPersistingTokenSource(&oauth2.Config{}, &FileTokenStore{}, &oauth2.Token{
+		AccessToken: "access",
+		Expiry:      time.Now().Add(-time.Minute),
+	})
+	_, err := source.Token()
+	assert.ErrorIs(t, err, ErrReloginRequired)
+
+	source = newPersistingTokenSource(&oauth2.Config{}, &FileTokenStore{}, nil)
+	_, err = source.Token()
+	assert.ErrorIs(t, err, ErrReloginRequired)
+}
+
+func TestPersistingTokenSourceRevoked(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"AADSTS700082: The refresh token has expired due to inactivity."}`))
+	}))
+	t.Cleanup(server.Close)
+	config := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams}}
+	source := newPersistingTokenSource(config, &FileTokenStore{}, &oauth2.Token{RefreshToken: "revoked"})
+
+	_, err := source.Token()
+	assert.ErrorIs(t, err, ErrReloginRequired)
+	assert.ErrorContains(t, err, "AADSTS700082")
+	// The rejected refresh token is not sent again
+	_, err = source.Token()
+	assert.ErrorIs(t, err, ErrReloginRequired)
+	assert.Equal(t, 1, requests)
+
+	source.setToken(&oauth2.Token{AccessToken: "new"})
+	token, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "new", token.AccessToken)
+}
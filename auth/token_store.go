@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/oauth2"
+)
+
+// ErrTokenNotFound is returned by TokenStore.Load if no token is saved.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore saves the token of an account between runs.
+type TokenStore interface {
+	// Load returns the saved token, or ErrTokenNotFound.
+	Load() (*oauth2.Token, error)
+	Save(token *oauth2.Token) error
+	// Delete removes the saved token. Deleting a missing token is not an error.
+	Delete() error
+	// Location describes where the token is saved, like the path of the file.
+	Location() string
+}
+
+// FileTokenStore saves the token as plain JSON, readable by anyone with access to the file.
+type FileTokenStore struct {
+	Path string
+}
+
+func (s *FileTokenStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *FileTokenStore) Save(token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data)
+}
+
+func (s *FileTokenStore) Delete() error {
+	return removeFile(s.Path)
+}
+
+func (s *FileTokenStore) Location() string {
+	return s.Path
+}
+
+// Iterations of PBKDF2 deriving the key of EncryptedFileTokenStore, as recommended by OWASP
+const pbkdf2Iterations = 600000
+
+// EncryptedFileTokenStore saves the token encrypted with AES-GCM, with a key derived from a secret.
+// The secret is a passphrase, or the content of a key file.
+type EncryptedFileTokenStore struct {
+	Path   string
+	Secret []byte
+}
+
+// encryptedToken is the content of the file of EncryptedFileTokenStore.
+type encryptedToken struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewEncryptedFileTokenStore reads the secret from the key file if keyFile is set, or uses the passphrase.
+func NewEncryptedFileTokenStore(path, passphrase, keyFile string) (*EncryptedFileTokenStore, error) {
+	secret := []byte(passphrase)
+	if keyFile != "" {
+		var err error
+		secret, err = os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		secret = bytes.TrimSpace(secret)
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("a passphrase or a key file is required to encrypt tokens")
+	}
+	return &EncryptedFileTokenStore{Path: path, Secret: secret}, nil
+}
+
+func (s *EncryptedFileTokenStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file encryptedToken
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid encrypted token file: %w", err)
+	}
+	if file.Version != 1 || file.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported encrypted token file: version %d, kdf %q", file.Version, file.KDF)
+	}
+
+	gcm, err := newGCM(s.Secret, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted token file: invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt token, the passphrase or key file may be wrong")
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(plaintext, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *EncryptedFileTokenStore) Save(token *oauth2.Token) error {
+	plaintext, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	file := encryptedToken{Version: 1, KDF: "pbkdf2-sha256", Iterations: pbkdf2Iterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(s.Secret, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, nil)
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, data)
+}
+
+func (s *EncryptedFileTokenStore) Delete() error {
+	return removeFile(s.Path)
+}
+
+func (s *EncryptedFileTokenStore) Location() string {
+	return s.Path
+}
+
+func newGCM(secret, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("invalid encrypted token file: invalid iterations")
+	}
+	block, err := aes.NewCipher(pbkdf2.Key(secret, salt, iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretService is the service of the tokens in the keyring.
+const secretService = "meeting-reminder"
+
+// SecretServiceTokenStore saves the token in the keyring of the desktop, like GNOME Keyring or KWallet,
+// through the Secret Service D-Bus API. On macOS and Windows, the Keychain and the Credential Manager are used.
+type SecretServiceTokenStore struct {
+	// Account distinguishes the tokens of the accounts in the keyring
+	Account string
+}
+
+func (s *SecretServiceTokenStore) user() string {
+	if s.Account == "" {
+		return "default"
+	}
+	return s.Account
+}
+
+func (s *SecretServiceTokenStore) Load() (*oauth2.Token, error) {
+	data, err := keyring.Get(secretService, s.user())
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token from Secret Service: %w", err)
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *SecretServiceTokenStore) Save(token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(secretService, s.user(), string(data)); err != nil {
+		return fmt.Errorf("failed to save token to Secret Service: %w", err)
+	}
+	return nil
+}
+
+func (s *SecretServiceTokenStore) Location() string {
+	return fmt.Sprintf("Secret Service: service %s username %s", secretService, s.user())
+}
+
+func (s *SecretServiceTokenStore) Delete() error {
+	if err := keyring.Delete(secretService, s.user()); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("failed to delete token from Secret Service: %w", err)
+	}
+	return nil
+}
+
+// MigrateTokenFile moves a token saved as plain JSON at path to the store, unless the store already
+// has a token. The plain file is removed once the token is saved to the store.
+func MigrateTokenFile(store TokenStore, path string) error {
+	if _, err := store.Load(); !errors.Is(err, ErrTokenNotFound) {
+		return err
+	}
+	legacy := &FileTokenStore{Path: path}
+	token, err := legacy.Load()
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token to migrate: %w", err)
+	}
+	if err := store.Save(token); err != nil {
+		return err
+	}
+	log.Printf("Moved token from %s to the token store", path)
+	return legacy.Delete()
+}
+
+// writeFileAtomic replaces the file, so that the token is not lost if writing is interrupted.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
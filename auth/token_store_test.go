@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+)
+
+func testToken() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  "access",
+		TokenType:    "Bearer",
+		RefreshToken: "refresh",
+		Expiry:       time.Date(2025, 6, 6, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	store := &FileTokenStore{Path: filepath.Join(t.TempDir(), "token.json")}
+	_, err := store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	require.NoError(t, store.Save(testToken()))
+	token, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, testToken(), token)
+
+	require.NoError(t, store.Delete())
+	_, err = store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	assert.NoError(t, store.Delete())
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("secret key\n"), 0600))
+	store, err := NewEncryptedFileTokenStore(filepath.Join(dir, "token.enc"), "", keyFile)
+	require.NoError(t, err)
+	_, err = store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	require.NoError(t, store.Save(testToken()))
+	data, err := os.ReadFile(store.Path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "refresh")
+
+	// The key file is read as a passphrase
+	store, err = NewEncryptedFileTokenStore(store.Path, "secret key", "")
+	require.NoError(t, err)
+	token, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, testToken(), token)
+
+	store, err = NewEncryptedFileTokenStore(store.Path, "wrong", "")
+	require.NoError(t, err)
+	_, err = store.Load()
+	assert.ErrorContains(t, err, "failed to decrypt token")
+
+	_, err = NewEncryptedFileTokenStore(store.Path, "", "")
+	assert.Error(t, err)
+}
+
+func TestSecretServiceTokenStore(t *testing.T) {
+	keyring.MockInit()
+	store := &SecretServiceTokenStore{Account: "Contoso"}
+	_, err := store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	require.NoError(t, store.Save(testToken()))
+	token, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, testToken(), token)
+
+	// The tokens of the accounts are kept apart
+	_, err = (&SecretServiceTokenStore{Account: "Fabrikam"}).Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	require.NoError(t, store.Delete())
+	_, err = store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	assert.NoError(t, store.Delete())
+
+	// Failures other than a missing secret are reported
+	keyring.MockInitWithError(errors.New("Cannot autolaunch D-Bus"))
+	_, err = store.Load()
+	assert.ErrorContains(t, err, "Cannot autolaunch D-Bus")
+}
+
+func TestMigrateTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	legacy := &FileTokenStore{Path: filepath.Join(dir, "token.json")}
+	store := &FileTokenStore{Path: filepath.Join(dir, "new.json")}
+
+	// Nothing to migrate
+	require.NoError(t, MigrateTokenFile(store, legacy.Path))
+	_, err := store.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+
+	require.NoError(t, legacy.Save(testToken()))
+	require.NoError(t, MigrateTokenFile(store, legacy.Path))
+	token, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, testToken(), token)
+	_, err = legacy.Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound, "the plain token is removed")
+
+	// A token in the store is not overwritten
+	newer := testToken()
+	newer.AccessToken = "newer"
+	require.NoError(t, store.Save(newer))
+	require.NoError(t, legacy.Save(testToken()))
+	require.NoError(t, MigrateTokenFile(store, legacy.Path))
+	token, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "newer", token.AccessToken)
+}
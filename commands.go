@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/auth"
+	"github.com/kajikentaro/meeting-reminder/config"
+	"github.com/kajikentaro/meeting-reminder/services"
+	"github.com/kajikentaro/meeting-reminder/ui"
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name string
+	// args describes the arguments in the usage
+	args        string
+	description string
+	run         func(flags *flag.FlagSet, opts *options, args []string)
+}
+
+var commands = []command{
+	{"run", "", "Show reminders of the meetings (default)", runCommandRun},
+	{"agenda", "[-for duration]", "List the upcoming meetings", runCommandAgenda},
+	{"test-notify", "[-title title]", "Show a sample reminder, to check the browser settings", runCommandTestNotify},
+	{"doctor", "", "Check the settings, the sign-in and the calendars of the accounts", runCommandDoctor},
+	{"config", "[validate]", "Show the settings and where they are set, or check the config file", runCommandConfig},
+	{"install-service", "[-print]", "Run the reminders in background as a systemd user service, started on login", runCommandInstallService},
+	{"uninstall-service", "", "Stop and remove the systemd user service", runCommandUninstallService},
+	{"ctl", "command", "Control the running reminders, see ctl -h", runCommandCtl},
+	{"login", "[account]", "Sign in again, even if a valid token is saved", runCommandLogin},
+	{"logout", "[-revoke] [account]", "Delete the saved token, and with -revoke, revoke it at the provider", runCommandLogout},
+	{"whoami", "[account]", "Show the signed-in user and the token", runCommandWhoAmI},
+	{"token-path", "[account]", "Show where the token is saved", runCommandTokenPath},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [flags]\n\nCommands:\n", os.Args[0])
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", c.name, c.args, c.description)
+	}
+	w.Flush()
+	fmt.Fprint(out, `
+Settings are read from flags, which override environment variables, which override the env file,
+which overrides the config file.
+Sign-in commands apply to all Microsoft and Google accounts signing in a user, unless an account name is given.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// fatalf reports the failure of a command in the terminal.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// runCommand runs the subcommand named by args[0] with the rest of args.
+// opts holds the shared flags given before the command.
+func runCommand(args []string, opts *options) {
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		flags := flag.NewFlagSet(c.name, flag.ExitOnError)
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "Usage: %s %s %s\n\n%s\n\nFlags:\n", os.Args[0], c.name, c.args, c.description)
+			flags.PrintDefaults()
+		}
+		c.run(flags, opts, args[1:])
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+	flag.Usage()
+	os.Exit(2)
+}
+
+// parseCommand parses the arguments of a command with the shared flags, and loads and validates
+// the settings. Commands take up to maxArgs arguments after the flags.
+func parseCommand(flags *flag.FlagSet, opts *options, args []string, maxArgs int) (*config.Config, []string) {
+	c, args := parseCommandUnvalidated(flags, opts, args, maxArgs)
+	if err := c.Validate(); err != nil {
+		fatalf("Invalid configuration:\n%v", err)
+	}
+	return c, args
+}
+
+// parseCommandUnvalidated is parseCommand without the validation of the settings.
+func parseCommandUnvalidated(flags *flag.FlagSet, opts *options, args []string, maxArgs int) (*config.Config, []string) {
+	opts.register(flags)
+	flags.Parse(args)
+	if flags.NArg() > maxArgs {
+		fatalf("Too many arguments of %s", flags.Name())
+	}
+	c, err := opts.load()
+	if err != nil {
+		fatalf("Error loading the configuration: %v", err)
+	}
+	return c, flags.Args()
+}
+
+func runCommandRun(flags *flag.FlagSet, opts *options, args []string) {
+	c, _ := parseCommand(flags, opts, args, 0)
+	runReminders(c, opts)
+}
+
+func runCommandAgenda(flags *flag.FlagSet, opts *options, args []string) {
+	period := flags.Duration("for", 24*time.Hour, "list the meetings starting in this period")
+	c, _ := parseCommand(flags, opts, args, 0)
+
+	accounts := signInAccounts(c, opts.deviceLogin)
+	calendarService := services.NewMultiAccountCalendarService(accounts, nil, time.Minute)
+	now := time.Now()
+	events, err := calendarService.Upcoming(context.Background(), now, now.Add(*period))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Some calendars couldn't be read:\n%v\n\n", err)
+	}
+	if len(events) == 0 {
+		fmt.Println("No meetings")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, event := range events {
+		var labels []string
+		for _, label := range []string{event.Account, event.Calendar} {
+			if label != "" {
+				labels = append(labels, label)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.StartTime.Local().Format("Mon Jan 2 15:04"), event.Title, strings.Join(labels, " / "), event.Link)
+	}
+	w.Flush()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func runCommandTestNotify(flags *flag.FlagSet, opts *options, args []string) {
+	title := flags.String("title", "Test reminder", "title of the sample meeting")
+	c, _ := parseCommand(flags, opts, args, 0)
+
+	uiInstance := ui.NewUI(c.UI.BrowserPath, c.UI.OutputDir, c.UI.OpenDir)
+	newNotifier(c, uiInstance).ShowMeetingReminder(context.Background(), []ui.UIEvents{{
+		Title:     *title,
+		StartTime: time.Now(),
+		Link:      "https://example.com/join",
+		Organizer: "you",
+	}})
+	fmt.Printf("Showed a sample reminder with %d notifiers\n", len(c.Notifiers))
+}
+
+func runCommandDoctor(flags *flag.FlagSet, opts *options, args []string) {
+	c, _ := parseCommandUnvalidated(flags, opts, args, 0)
+
+	failed := false
+	check := func(subject string, err error) {
+		if err != nil {
+			fmt.Printf("FAIL  %s: %v\n", subject, err)
+			failed = true
+			return
+		}
+		fmt.Printf("ok    %s\n", subject)
+	}
+
+	if _, err := os.Stat(opts.envFile); err == nil {
+		check("Env file "+opts.envFile, nil)
+	} else {
+		fmt.Printf("-     Env file %s not found, using the environment\n", opts.envFile)
+	}
+	if c.Path == "" {
+		fmt.Println("-     Config file not found, using the defaults")
+	}
+	err := c.Validate()
+	check("Configuration", err)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if c.UI.BrowserPath == "" {
+		fmt.Println("-     Browser not set, using the default browser of the system")
+	} else {
+		_, err := exec.LookPath(c.UI.BrowserPath)
+		check("Browser "+c.UI.BrowserPath, err)
+	}
+	for _, n := range c.Notifiers {
+		if n.Type == config.NotifierCommand {
+			_, err := exec.LookPath(n.Command[0])
+			check("Notifier command "+n.Command[0], err)
+		}
+	}
+	outputDir := c.UI.OutputDir
+	if outputDir == "" {
+		outputDir = os.TempDir()
+	}
+	check("Output directory "+outputDir, checkWritable(outputDir))
+
+	redirectURL := loginRedirectURL(c.Login)
+	for _, accountConfig := range c.Accounts {
+		if accountConfig.SignsIn() && accountConfig.LoginFlow != config.LoginDevice && !opts.deviceLogin {
+			check("Login callback "+redirectURL, checkCallbackPort(redirectURL))
+			break
+		}
+	}
+
+	year, month, day := time.Now().Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 1)
+	for _, accountConfig := range c.Accounts {
+		label := "Account"
+		if accountConfig.Name != "" {
+			label = fmt.Sprintf("Account %q", accountConfig.Name)
+		}
+
+		var authInstance *auth.Auth
+		if accountConfig.SignsIn() {
+			authInstance = newAccountAuth(accountConfig, c, opts.deviceLogin)
+			// Unlike signing in, WhoAmI doesn't start a login without a valid token
+			identity, err := authInstance.WhoAmI()
+			if err != nil {
+				check(label+" sign-in", err)
+				continue
+			}
+			check(fmt.Sprintf("%s signed in as %s", label, identity.Email), nil)
+		}
+
+		account, _, err := newAccount(accountConfig, authInstance, time.Duration(c.Reminders.LeadTime))
+		if err != nil {
+			check(label, err)
+			continue
+		}
+		var ids []string
+		for _, calendar := range account.Calendars {
+			ids = append(ids, calendar.ID)
+		}
+		if len(ids) == 0 {
+			ids = []string{""}
+		}
+		views, err := account.Provider.FetchCalendarViews(context.Background(), ids, start, end)
+		if err == nil && len(views) != len(ids) {
+			err = fmt.Errorf("got %d calendar views for %d calendars", len(views), len(ids))
+		}
+		if err != nil {
+			check(label+" calendars", err)
+			continue
+		}
+		for i, view := range views {
+			name := ids[i]
+			if len(account.Calendars) > 0 && account.Calendars[i].Name != "" {
+				name = account.Calendars[i].Name
+			}
+			if name == "" {
+				name = "default"
+			}
+			check(fmt.Sprintf("%s calendar %q: %d events today", label, name, len(view.Events)), view.Err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkWritable tells whether files can be created in dir.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkCallbackPort tells whether the port of the redirect URL of the browser login is free.
+func checkCallbackPort(redirectURL string) error {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", u.Port()))
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
+
+func runCommandConfig(flags *flag.FlagSet, opts *options, args []string) {
+	c, args := parseCommandUnvalidated(flags, opts, args, 1)
+	if len(args) > 0 {
+		if args[0] != "validate" {
+			fatalf("Unknown argument of config: %s", args[0])
+		}
+		if err := c.Validate(); err != nil {
+			fatalf("%v", err)
+		}
+		if c.Path == "" {
+			fmt.Println("No config file found, the settings are valid")
+			return
+		}
+		fmt.Printf("%s is valid\n", c.Path)
+		return
+	}
+
+	if c.Path != "" {
+		fmt.Printf("Config file: %s\n\n", c.Path)
+	} else {
+		path, _ := config.DefaultPath()
+		fmt.Printf("Config file: none (%s not found)\n\n", path)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, s := range settings {
+		value, ok := opts.lookupEnv(s.env)
+		source := opts.settingSource(s.env)
+		if s.field != nil {
+			value = *s.field(c)
+		} else if !ok {
+			source = "unset"
+		}
+		if s.secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.env, value, source)
+	}
+	w.Flush()
+}
+
+func runCommandLogin(flags *flag.FlagSet, opts *options, args []string) {
+	c, args := parseCommand(flags, opts, args, 1)
+	forEachSignIn(c, opts, args, true, func(label string, authInstance *auth.Auth) {
+		if err := authInstance.Login(); err != nil {
+			fatalf("%s: %v", label, err)
+		}
+		fmt.Printf("%s: signed in\n", label)
+	})
+}
+
+func runCommandLogout(flags *flag.FlagSet, opts *options, args []string) {
+	revoke := flags.Bool("revoke", false, "revoke the sessions or the grant at the provider")
+	c, args := parseCommand(flags, opts, args, 1)
+	forEachSignIn(c, opts, args, true, func(label string, authInstance *auth.Auth) {
+		if err := authInstance.Logout(*revoke); err != nil {
+			fatalf("%s: %v", label, err)
+		}
+		fmt.Printf("%s: signed out\n", label)
+	})
+}
+
+func runCommandWhoAmI(flags *flag.FlagSet, opts *options, args []string) {
+	c, args := parseCommand(flags, opts, args, 1)
+	forEachSignIn(c, opts, args, false, func(label string, authInstance *auth.Auth) {
+		identity, err := authInstance.WhoAmI()
+		if err != nil {
+			fatalf("%s: %v", label, err)
+		}
+		fmt.Printf("%s\n  Name:    %s\n  Email:   %s\n", label, identity.Name, identity.Email)
+		if identity.Tenant != "" {
+			fmt.Printf("  Tenant:  %s\n", identity.Tenant)
+		}
+		fmt.Printf("  Scopes:  %s\n  Expires: %s\n", strings.Join(identity.Scopes, " "), identity.Expiry.Local().Format(time.RFC3339))
+	})
+}
+
+func runCommandTokenPath(flags *flag.FlagSet, opts *options, args []string) {
+	c, args := parseCommand(flags, opts, args, 1)
+	forEachSignIn(c, opts, args, false, func(label string, authInstance *auth.Auth) {
+		fmt.Printf("%s: %s\n", label, authInstance.Store.Location())
+	})
+}
+
+// forEachSignIn calls f with the auth of the accounts a user signs in to, or only of the
+// account named by args[0] if given. If migrate is set, the tokens saved as plain JSON by an
+// earlier version are moved to the token store first, which the commands only reading tokens don't.
+func forEachSignIn(c *config.Config, opts *options, args []string, migrate bool, f func(label string, authInstance *auth.Auth)) {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	for _, account := range signInAccountConfigs(c.Accounts, name) {
+		label := "Account"
+		if account.Name != "" {
+			label = fmt.Sprintf("Account %q", account.Name)
+		}
+		authInstance := newAccountAuth(account, c, opts.deviceLogin)
+		if migrate {
+			migrateTokenFile(account, authInstance)
+		}
+		f(label, authInstance)
+	}
+}
+
+// signInAccountConfigs returns the Microsoft and Google accounts a user signs in to with OAuth.
+// If name is set, only the account of the name is returned.
+func signInAccountConfigs(accounts []config.Account, name string) []config.Account {
+	var selected []config.Account
+	for _, account := range accounts {
+		if name != "" && account.Name != name {
+			continue
+		}
+		if !account.SignsIn() {
+			if name != "" {
+				fatalf("Account %q doesn't sign in a user with OAuth", name)
+			}
+			continue
+		}
+		selected = append(selected, account)
+	}
+	if len(selected) == 0 && name != "" {
+		fatalf("Account %q is not found", name)
+	}
+	return selected
+}
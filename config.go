@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/config"
+	"github.com/kajikentaro/meeting-reminder/repositories"
+	"github.com/kajikentaro/meeting-reminder/services"
+	"github.com/kajikentaro/meeting-reminder/ui"
+)
+
+// loadAccountsFile reads the accounts of the JSON file specified by ACCOUNTS_FILE.
+func loadAccountsFile(path string) ([]config.Account, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ACCOUNTS_FILE: %w", err)
+	}
+	var accounts []config.Account
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("error parsing ACCOUNTS_FILE %s: %w", path, err)
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New("no account found in ACCOUNTS_FILE")
+	}
+	return accounts, nil
+}
+
+// envAccounts returns the account made of TENANT_ID, CLIENT_ID, CLIENT_SECRET and CALENDARS,
+// used when neither the config file nor ACCOUNTS_FILE has accounts, and the events of EVENTS_FILE.
+func (o *options) envAccounts() ([]config.Account, error) {
+	var accounts []config.Account
+	if o.getenv("CLIENT_ID") != "" {
+		calendars, err := o.loadCalendars()
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, config.Account{
+			Type:               config.AccountMicrosoft,
+			TenantID:           o.getenv("TENANT_ID"),
+			ClientID:           o.getenv("CLIENT_ID"),
+			ClientSecret:       o.getenv("CLIENT_SECRET"),
+			AppOnly:            o.getenv("APP_ONLY") == "true",
+			CertificateFile:    o.getenv("CLIENT_CERTIFICATE_FILE"),
+			CertificateKeyFile: o.getenv("CLIENT_CERTIFICATE_KEY_FILE"),
+			Calendars:          calendars,
+		})
+	}
+	if eventsFile := o.getenv("EVENTS_FILE"); eventsFile != "" {
+		accounts = append(accounts, config.Account{
+			Type:      config.AccountManual,
+			Calendars: []config.Calendar{{Path: eventsFile}},
+		})
+	}
+	return accounts, nil
+}
+
+// Load the watched calendars from the CALENDARS environment variable.
+// If it is not set, only the default calendar is watched.
+func (o *options) loadCalendars() ([]config.Calendar, error) {
+	value := o.getenv("CALENDARS")
+	if value == "" {
+		return nil, nil
+	}
+
+	var calendars []config.Calendar
+	if err := json.Unmarshal([]byte(value), &calendars); err != nil {
+		return nil, fmt.Errorf("error parsing CALENDARS: %w", err)
+	}
+	return calendars, nil
+}
+
+// toCalendars returns the watched calendars of the account. Calendars without
+// a lead time use leadTime.
+func toCalendars(account config.Account, leadTime time.Duration) []services.Calendar {
+	var calendars []services.Calendar
+	for _, c := range account.Calendars {
+		policy := services.ReminderPolicy{LeadTime: leadTime, Disabled: c.Disabled, UseAlarms: c.UseAlarms}
+		if c.LeadTime != nil {
+			policy.LeadTime = time.Duration(*c.LeadTime)
+		}
+
+		calendar := services.Calendar{
+			Name:   c.Name,
+			Color:  c.Color,
+			Policy: policy,
+		}
+		switch account.Type {
+		case config.AccountICS:
+			calendar.ID = c.URL
+		case config.AccountManual:
+			calendar.ID = c.Path
+		case config.AccountCalDAV, config.AccountGoogle, config.AccountEWS:
+			calendar.ID = c.ID
+		default:
+			calendar.ID = repositories.Calendar{UserID: c.User, GroupID: c.Group, ID: c.ID}.Path()
+			// Change notifications of /me/events only cover the default calendar of the signed-in user
+			calendar.Pushable = c.User == "" && c.ID == ""
+		}
+		calendars = append(calendars, calendar)
+	}
+
+	if len(calendars) == 0 && account.Type == config.AccountMicrosoft {
+		calendars = []services.Calendar{{
+			ID:       repositories.Calendar{}.Path(),
+			Policy:   services.ReminderPolicy{LeadTime: leadTime},
+			Pushable: true,
+		}}
+	}
+	return calendars
+}
+
+// newFilter returns the filter of the events of a validated config.
+func newFilter(c *config.Config) (services.Filter, error) {
+	filter := services.Filter{SkipDeclined: c.Filters.SkipDeclined}
+	for _, pattern := range c.Filters.ExcludeTitles {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, err
+		}
+		filter.ExcludeTitles = append(filter.ExcludeTitles, re)
+	}
+	for _, q := range c.QuietHours {
+		start, err := config.ParseTimeOfDay(q.Start)
+		if err != nil {
+			return filter, err
+		}
+		end, err := config.ParseTimeOfDay(q.End)
+		if err != nil {
+			return filter, err
+		}
+		quietHours := services.QuietHours{Start: start, End: end}
+		for _, value := range q.Days {
+			day, err := config.ParseWeekday(value)
+			if err != nil {
+				return filter, err
+			}
+			quietHours.Days = append(quietHours.Days, day)
+		}
+		filter.QuietHours = append(filter.QuietHours, quietHours)
+	}
+	return filter, nil
+}
+
+// newNotifier returns the notifiers of the config, showing the reminders in the browser of uiInstance
+// or by running commands.
+func newNotifier(c *config.Config, uiInstance *ui.UI) ui.Notifiers {
+	var notifiers ui.Notifiers
+	for _, n := range c.Notifiers {
+		switch n.Type {
+		case config.NotifierCommand:
+			notifiers = append(notifiers, &ui.CommandNotifier{Command: n.Command})
+		default:
+			notifiers = append(notifiers, uiInstance)
+		}
+	}
+	return notifiers
+}
@@ -0,0 +1,417 @@
+// Package config reads the configuration file of the app.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of the configuration file.
+type Config struct {
+	Accounts   []Account    `yaml:"accounts"`
+	Reminders  Reminders    `yaml:"reminders"`
+	Filters    Filters      `yaml:"filters"`
+	QuietHours []QuietHours `yaml:"quietHours"`
+	// Notifiers show the reminders. Defaults to the browser.
+	Notifiers []Notifier `yaml:"notifiers"`
+	UI        UI         `yaml:"ui"`
+	Login     Login      `yaml:"login"`
+	Tokens    Tokens     `yaml:"tokens"`
+	Webhook   Webhook    `yaml:"webhook"`
+	Metrics   Metrics    `yaml:"metrics"`
+
+	// Path of the file the config was read from, empty if there was none
+	Path string `yaml:"-"`
+	pos  position
+}
+
+// Reminders are the settings of the reminders shared by the calendars.
+type Reminders struct {
+	// LeadTime is how long before the start of the events reminders are shown,
+	// unless their calendar sets it.
+	LeadTime Duration `yaml:"leadTime"`
+	// Interval is how often the calendars are checked for starting events.
+	Interval Duration `yaml:"interval"`
+	pos      position
+}
+
+// Filters select the events reminded of.
+type Filters struct {
+	// ExcludeTitles are regular expressions of the titles of events not reminded of.
+	ExcludeTitles []string `yaml:"excludeTitles"`
+	// SkipDeclined skips the events the user declined.
+	SkipDeclined bool `yaml:"skipDeclined"`
+	pos          position
+}
+
+// QuietHours is a period of the day no reminder is shown in.
+type QuietHours struct {
+	// Start and End are times of the day like "22:00". The period continues into the
+	// next day if End is before Start.
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// Days are the days of the week the period starts on, like "sat". Defaults to every day.
+	Days []string `yaml:"days"`
+	pos  position
+}
+
+// Types of notifiers
+const (
+	NotifierBrowser = "browser"
+	NotifierCommand = "command"
+)
+
+// Notifier shows the reminders.
+type Notifier struct {
+	// Type is "browser", showing the reminders with the browser of UI, or "command",
+	// running Command for each event.
+	Type string `yaml:"type"`
+	// Command and its arguments. The event is passed in the environment variables
+	// MEETING_TITLE, MEETING_START, MEETING_LINK, MEETING_CALENDAR and MEETING_ACCOUNT.
+	Command []string `yaml:"command"`
+	pos     position
+}
+
+// UI is the settings of the browser showing the reminders.
+type UI struct {
+	// BrowserPath is the browser opening the reminders. Defaults to the default browser of the system.
+	BrowserPath string `yaml:"browserPath"`
+	// OutputDir is where the page of the reminders is written. Defaults to the temporary directory.
+	OutputDir string `yaml:"outputDir"`
+	// OpenDir is the directory the browser opens the page from, if it sees the files at
+	// another path, like a browser on the host of a container. Defaults to OutputDir.
+	OpenDir string `yaml:"openDir"`
+	pos     position
+}
+
+// Login is the settings of the interactive sign-in.
+type Login struct {
+	// Flow is the default login flow of the accounts, "browser" or "device".
+	Flow string `yaml:"flow"`
+	// CallbackPort and CallbackPath are the redirect URI of the browser login,
+	// http://localhost:[port][path]. Port 0 uses a free port on each login.
+	CallbackPort string `yaml:"callbackPort"`
+	CallbackPath string `yaml:"callbackPath"`
+	pos          position
+}
+
+// Types of token stores
+const (
+	TokenStoreFile          = "file"
+	TokenStoreEncrypted     = "encrypted"
+	TokenStoreSecretService = "secret-service"
+)
+
+// Tokens is where the tokens of the accounts are saved.
+type Tokens struct {
+	// Store is "file", "encrypted" or "secret-service".
+	Store string `yaml:"store"`
+	// Passphrase, or KeyFile containing the key, of the "encrypted" store
+	Passphrase string `yaml:"passphrase"`
+	KeyFile    string `yaml:"keyFile"`
+	pos        position
+}
+
+// Webhook is the settings of the change notifications of Microsoft Graph.
+type Webhook struct {
+	// URL is the public HTTPS URL forwarded to ListenAddr. Calendars are polled if empty.
+	URL        string `yaml:"url"`
+	ListenAddr string `yaml:"listenAddr"`
+	pos        position
+}
+
+// Metrics is the settings of the metrics endpoint of Prometheus.
+type Metrics struct {
+	// ListenAddr is the address /metrics is served on. The endpoint is disabled if empty.
+	ListenAddr string `yaml:"listenAddr"`
+	pos        position
+}
+
+// Types of accounts
+const (
+	AccountMicrosoft = "microsoft"
+	AccountICS       = "ics"
+	AccountCalDAV    = "caldav"
+	AccountGoogle    = "google"
+	AccountManual    = "manual"
+	AccountEWS       = "ews"
+)
+
+// Authentication schemes of EWS
+const (
+	EWSAuthNTLM  = "ntlm"
+	EWSAuthBasic = "basic"
+)
+
+// Login flows
+const (
+	LoginBrowser = "browser"
+	LoginDevice  = "device"
+)
+
+// Account is a calendar account. It is also an entry of the JSON file of ACCOUNTS_FILE.
+type Account struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is "microsoft" (default), "google", "ics", "caldav", "ews" or "manual"
+	Type string `yaml:"type" json:"type"`
+	// Email is the address of the user in iCalendar feeds and CalDAV, to find the user's responses
+	Email string `yaml:"email" json:"email"`
+	// URL, Username, Password and Token are the server and the credentials of CalDAV and EWS
+	URL      string `yaml:"url" json:"url"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	Token    string `yaml:"token" json:"token"`
+	// Auth is how the username and password are sent to EWS, "ntlm" (default) or "basic"
+	Auth         string `yaml:"auth" json:"auth"`
+	TenantID     string `yaml:"tenantId" json:"tenantId"`
+	ClientID     string `yaml:"clientId" json:"clientId"`
+	ClientSecret string `yaml:"clientSecret" json:"clientSecret"`
+	TokenFile    string `yaml:"tokenFile" json:"tokenFile"`
+	// LoginFlow is "browser" or "device", to sign in on another device. Defaults to the flow of Login.
+	LoginFlow string `yaml:"loginFlow" json:"loginFlow"`
+	// AppOnly reads the mailboxes of the calendars with the application permissions
+	// of a Microsoft app, authenticated by the client secret or a certificate
+	AppOnly bool `yaml:"appOnly" json:"appOnly"`
+	// CertificateFile is a PEM file of the certificate of the app, with the private key
+	// unless CertificateKeyFile is set
+	CertificateFile    string     `yaml:"certificateFile" json:"certificateFile"`
+	CertificateKeyFile string     `yaml:"certificateKeyFile" json:"certificateKeyFile"`
+	Calendars          []Calendar `yaml:"calendars" json:"calendars"`
+	pos                position
+}
+
+// Calendar is a watched calendar of an account.
+type Calendar struct {
+	Name  string `yaml:"name" json:"name"`
+	Color string `yaml:"color" json:"color"`
+	User  string `yaml:"user" json:"user"`
+	Group string `yaml:"group" json:"group"`
+	ID    string `yaml:"id" json:"id"`
+	// URL is the URL or path of an iCalendar feed
+	URL string `yaml:"url" json:"url"`
+	// Path is the path of a file of manual events
+	Path string `yaml:"path" json:"path"`
+	// LeadTime overrides the lead time of Reminders
+	LeadTime  *Duration `yaml:"leadTime" json:"leadTime"`
+	Disabled  bool      `yaml:"disabled" json:"disabled"`
+	UseAlarms bool      `yaml:"useAlarms" json:"useAlarms"`
+	pos       position
+}
+
+// Duration is a time.Duration written like "5m" or "1h30m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil || node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: invalid duration %q, expected like \"5m\"", node.Line, node.Value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected like \"5m\"", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Default returns the config used without a configuration file.
+func Default() *Config {
+	return &Config{
+		Reminders: Reminders{Interval: Duration(time.Minute)},
+		Login:     Login{Flow: LoginBrowser, CallbackPort: "9091", CallbackPath: "/callback"},
+		Tokens:    Tokens{Store: TokenStoreFile},
+		Webhook:   Webhook{ListenAddr: "127.0.0.1:9092"},
+	}
+}
+
+// DefaultPath returns the path of the configuration file in the config directory of the user,
+// e.g. $XDG_CONFIG_HOME/meeting-reminder/config.yaml.
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "meeting-reminder", "config.yaml"), nil
+}
+
+// Load reads the YAML configuration file at path over the defaults.
+// Errors tell the line of the file they are at.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.Path = path
+	return c, nil
+}
+
+// Parse reads a YAML configuration over the defaults.
+func Parse(data []byte) (*Config, error) {
+	c := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, unwrapYAMLError(err)
+	}
+	return c, nil
+}
+
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	type plain Config
+	return decodeMapping(node, (*plain)(c), &c.pos)
+}
+
+func (r *Reminders) UnmarshalYAML(node *yaml.Node) error {
+	type plain Reminders
+	return decodeMapping(node, (*plain)(r), &r.pos)
+}
+
+func (f *Filters) UnmarshalYAML(node *yaml.Node) error {
+	type plain Filters
+	return decodeMapping(node, (*plain)(f), &f.pos)
+}
+
+func (q *QuietHours) UnmarshalYAML(node *yaml.Node) error {
+	type plain QuietHours
+	return decodeMapping(node, (*plain)(q), &q.pos)
+}
+
+func (n *Notifier) UnmarshalYAML(node *yaml.Node) error {
+	type plain Notifier
+	return decodeMapping(node, (*plain)(n), &n.pos)
+}
+
+func (u *UI) UnmarshalYAML(node *yaml.Node) error {
+	type plain UI
+	return decodeMapping(node, (*plain)(u), &u.pos)
+}
+
+func (l *Login) UnmarshalYAML(node *yaml.Node) error {
+	type plain Login
+	return decodeMapping(node, (*plain)(l), &l.pos)
+}
+
+func (t *Tokens) UnmarshalYAML(node *yaml.Node) error {
+	type plain Tokens
+	return decodeMapping(node, (*plain)(t), &t.pos)
+}
+
+func (w *Webhook) UnmarshalYAML(node *yaml.Node) error {
+	type plain Webhook
+	return decodeMapping(node, (*plain)(w), &w.pos)
+}
+
+func (m *Metrics) UnmarshalYAML(node *yaml.Node) error {
+	type plain Metrics
+	return decodeMapping(node, (*plain)(m), &m.pos)
+}
+
+func (a *Account) UnmarshalYAML(node *yaml.Node) error {
+	type plain Account
+	return decodeMapping(node, (*plain)(a), &a.pos)
+}
+
+func (c *Calendar) UnmarshalYAML(node *yaml.Node) error {
+	type plain Calendar
+	return decodeMapping(node, (*plain)(c), &c.pos)
+}
+
+// position is where a mapping and its keys are in the file, for the messages of errors.
+// The zero value is an unknown position, like of a config not read from YAML.
+type position struct {
+	line int
+	keys map[string]int
+}
+
+// lineOf returns the line of the key, or of the mapping if the key is not set.
+func (p position) lineOf(key string) int {
+	if line, ok := p.keys[key]; ok {
+		return line
+	}
+	return p.line
+}
+
+// decodeMapping decodes a mapping into v, a pointer to a struct, rejecting the keys
+// which are not fields of the struct, and records where the mapping and its keys are.
+func decodeMapping(node *yaml.Node, v interface{}, pos *position) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+	fields := map[string]bool{}
+	t := reflect.TypeOf(v).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+
+	pos.line = node.Line
+	pos.keys = map[string]int{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !fields[key.Value] {
+			return fmt.Errorf("line %d: unknown field %q", key.Line, key.Value)
+		}
+		pos.keys[key.Value] = key.Line
+	}
+	if err := node.Decode(v); err != nil {
+		return unwrapYAMLError(err)
+	}
+	return nil
+}
+
+// unwrapYAMLError removes the "yaml: unmarshal errors:" header from the errors of
+// the values of wrong types, so that they read like the other errors.
+func unwrapYAMLError(err error) error {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		return errors.New(strings.Join(typeErr.Errors, "\n"))
+	}
+	return err
+}
+
+// SignsIn reports whether a user signs in to the account with OAuth, unlike the accounts
+// of calendar feeds or servers, and app-only accounts.
+func (a Account) SignsIn() bool {
+	return (a.Type == "" || a.Type == AccountMicrosoft || a.Type == AccountGoogle) && !a.AppOnly
+}
+
+// SameConnection reports whether the accounts connect to the same server with the same
+// credentials, wherever they are in the file. Their calendars may differ.
+func (a Account) SameConnection(b Account) bool {
+	return reflect.DeepEqual(a.connection(), b.connection())
+}
+
+// connection returns the account without its calendars and position.
+func (a Account) connection() Account {
+	a.pos = position{}
+	a.Calendars = nil
+	return a
+}
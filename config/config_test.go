@@ -0,0 +1,179 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+accounts:
+  - name: Work
+    tenantId: contoso.onmicrosoft.com
+    clientId: client
+    calendars:
+      - name: Work
+        leadTime: 5m
+      - name: Alice
+        user: alice@example.com
+  - name: Holidays
+    type: ics
+    calendars:
+      - url: https://example.com/holidays.ics
+reminders:
+  leadTime: 1m
+filters:
+  excludeTitles: ["^Focus time$"]
+  skipDeclined: true
+quietHours:
+  - start: "22:00"
+    end: "07:00"
+notifiers:
+  - type: browser
+  - type: command
+    command: [notify-send, Meeting]
+ui:
+  browserPath: firefox
+login:
+  callbackPort: 0
+`), 0600))
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.NoError(t, c.Validate())
+	assert.Equal(t, path, c.Path)
+
+	require.Len(t, c.Accounts, 2)
+	assert.Equal(t, AccountMicrosoft, c.Accounts[0].Type)
+	assert.Equal(t, LoginBrowser, c.Accounts[0].LoginFlow)
+	assert.Equal(t, Duration(5*time.Minute), *c.Accounts[0].Calendars[0].LeadTime)
+	assert.Nil(t, c.Accounts[0].Calendars[1].LeadTime)
+	assert.Equal(t, "https://example.com/holidays.ics", c.Accounts[1].Calendars[0].URL)
+	assert.Equal(t, Duration(time.Minute), c.Reminders.LeadTime)
+	assert.Equal(t, []string{"^Focus time$"}, c.Filters.ExcludeTitles)
+	assert.Equal(t, "22:00", c.QuietHours[0].Start)
+	assert.Equal(t, []string{"notify-send", "Meeting"}, c.Notifiers[1].Command)
+	assert.Equal(t, "firefox", c.UI.BrowserPath)
+
+	// Unset values keep the defaults
+	assert.Equal(t, Duration(time.Minute), c.Reminders.Interval)
+	assert.Equal(t, "0", c.Login.CallbackPort)
+	assert.Equal(t, "/callback", c.Login.CallbackPath)
+	assert.Equal(t, TokenStoreFile, c.Tokens.Store)
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		title string
+		yaml  string
+		err   string
+	}{
+		{
+			title: "unknown field",
+			yaml:  "accounts:\n  - name: Work\n    clientid: client\n",
+			err:   `line 3: unknown field "clientid"`,
+		},
+		{
+			title: "invalid duration",
+			yaml:  "reminders:\n  leadTime: 5 minutes\n",
+			err:   `line 2: invalid duration "5 minutes"`,
+		},
+		{
+			title: "wrong type",
+			yaml:  "filters:\n  skipDeclined: sometimes\n",
+			err:   "line 2: cannot unmarshal !!str `sometimes` into bool",
+		},
+		{
+			title: "not a mapping",
+			yaml:  "ui: firefox\n",
+			err:   "line 1: expected a mapping",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			_, err := Parse([]byte(tc.yaml))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c, err := Parse([]byte(`accounts:
+  - name: Work
+    clientId: client
+    loginFlow: phone
+  - name: Work
+    type: ics
+    calendars:
+      - name: No URL
+  - clientId: client
+  - clientId: client
+  - name: Exchange
+    type: exchange
+quietHours:
+  - start: "25:00"
+    end: "07:00"
+    days: [someday]
+notifiers:
+  - type: command
+login:
+  callbackPort: http
+metrics:
+  listenAddr: "9093"
+`))
+	require.NoError(t, err)
+	c.Path = "config.yaml"
+
+	err = c.Validate()
+	for _, message := range []string{
+		`config.yaml: line 4: unknown loginFlow of account "Work": "phone"`,
+		`config.yaml: line 5: duplicated account name: "Work"`,
+		`config.yaml: line 8: each calendar of account "Work" must have a url`,
+		`config.yaml: line 10: each account signing in a user must have a name, unless there is only one`,
+		`config.yaml: line 12: unknown type of account "Exchange": "exchange"`,
+		`config.yaml: line 14: invalid start of quietHours: "25:00" is not a time like "22:00"`,
+		`config.yaml: line 16: invalid day of quietHours: "someday" is not a day of the week`,
+		`config.yaml: line 18: notifier of type command must have a command`,
+		`config.yaml: line 20: invalid login.callbackPort: "http"`,
+		`config.yaml: line 22: invalid metrics.listenAddr: address 9093: missing port in address`,
+	} {
+		assert.ErrorContains(t, err, message)
+	}
+}
+
+func TestValidateNoAccount(t *testing.T) {
+	c := Default()
+	assert.ErrorContains(t, c.Validate(), "no account is configured")
+}
+
+func TestParseWeekday(t *testing.T) {
+	day, err := ParseWeekday("Sat")
+	require.NoError(t, err)
+	assert.Equal(t, time.Saturday, day)
+	day, err = ParseWeekday("monday")
+	require.NoError(t, err)
+	assert.Equal(t, time.Monday, day)
+}
+
+func TestAccountSameConnection(t *testing.T) {
+	c, err := Parse([]byte("accounts:\n  - name: Work\n    clientId: client\n    calendars:\n      - name: Work\n"))
+	require.NoError(t, err)
+	moved, err := Parse([]byte("# Moved\naccounts:\n  - name: Work\n    clientId: client\n    calendars:\n      - name: Work\n"))
+	require.NoError(t, err)
+	assert.True(t, c.Accounts[0].SameConnection(moved.Accounts[0]))
+
+	// The calendars are replaced without connecting again
+	calendarsChanged := moved.Accounts[0]
+	calendarsChanged.Calendars = []Calendar{{Name: "Home", Color: "teal"}}
+	assert.True(t, c.Accounts[0].SameConnection(calendarsChanged))
+
+	clientChanged := moved.Accounts[0]
+	clientChanged.ClientID = "other"
+	assert.False(t, c.Accounts[0].SameConnection(clientChanged))
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validator collects the errors of a config, with the file and the line they are at.
+type validator struct {
+	path string
+	errs []error
+}
+
+func (v *validator) errorf(line int, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	// Settings not read from the file, like of environment variables, have no line
+	if line > 0 {
+		message = fmt.Sprintf("line %d: %s", line, message)
+		if v.path != "" {
+			message = v.path + ": " + message
+		}
+	}
+	v.errs = append(v.errs, errors.New(message))
+}
+
+// Validate checks the config, and fills in the defaults which depend on other settings,
+// like the type of the accounts. All the errors found are returned together.
+func (c *Config) Validate() error {
+	v := &validator{path: c.Path}
+
+	if c.Reminders.Interval <= 0 {
+		v.errorf(c.Reminders.pos.lineOf("interval"), "reminders.interval must be positive")
+	}
+	if c.Reminders.LeadTime < 0 {
+		v.errorf(c.Reminders.pos.lineOf("leadTime"), "reminders.leadTime must not be negative")
+	}
+	for _, pattern := range c.Filters.ExcludeTitles {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.errorf(c.Filters.pos.lineOf("excludeTitles"), "invalid pattern of filters.excludeTitles: %v", err)
+		}
+	}
+	for _, q := range c.QuietHours {
+		if _, err := ParseTimeOfDay(q.Start); err != nil {
+			v.errorf(q.pos.lineOf("start"), "invalid start of quietHours: %v", err)
+		}
+		if _, err := ParseTimeOfDay(q.End); err != nil {
+			v.errorf(q.pos.lineOf("end"), "invalid end of quietHours: %v", err)
+		}
+		for _, day := range q.Days {
+			if _, err := ParseWeekday(day); err != nil {
+				v.errorf(q.pos.lineOf("days"), "invalid day of quietHours: %v", err)
+			}
+		}
+	}
+
+	if len(c.Notifiers) == 0 {
+		c.Notifiers = []Notifier{{Type: NotifierBrowser}}
+	}
+	for _, n := range c.Notifiers {
+		switch n.Type {
+		case NotifierBrowser:
+		case NotifierCommand:
+			if len(n.Command) == 0 {
+				v.errorf(n.pos.lineOf("command"), "notifier of type command must have a command")
+			}
+		default:
+			v.errorf(n.pos.lineOf("type"), "unknown type of notifier: %q", n.Type)
+		}
+	}
+
+	if c.UI.OpenDir == "" {
+		c.UI.OpenDir = c.UI.OutputDir
+	}
+	switch c.Login.Flow {
+	case LoginBrowser, LoginDevice:
+	default:
+		v.errorf(c.Login.pos.lineOf("flow"), "unknown login.flow: %q", c.Login.Flow)
+	}
+	if _, err := strconv.ParseUint(c.Login.CallbackPort, 10, 16); err != nil {
+		v.errorf(c.Login.pos.lineOf("callbackPort"), "invalid login.callbackPort: %q", c.Login.CallbackPort)
+	}
+	if !strings.HasPrefix(c.Login.CallbackPath, "/") {
+		c.Login.CallbackPath = "/" + c.Login.CallbackPath
+	}
+	switch c.Tokens.Store {
+	case TokenStoreFile, TokenStoreSecretService:
+	case TokenStoreEncrypted:
+		if c.Tokens.Passphrase == "" && c.Tokens.KeyFile == "" {
+			v.errorf(c.Tokens.pos.lineOf("store"), "the encrypted token store needs tokens.passphrase or tokens.keyFile")
+		}
+	default:
+		v.errorf(c.Tokens.pos.lineOf("store"), "unknown tokens.store: %q", c.Tokens.Store)
+	}
+
+	if c.Metrics.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.ListenAddr); err != nil {
+			v.errorf(c.Metrics.pos.lineOf("listenAddr"), "invalid metrics.listenAddr: %v", err)
+		}
+	}
+
+	c.validateAccounts(v)
+	return errors.Join(v.errs...)
+}
+
+func (c *Config) validateAccounts(v *validator) {
+	if len(c.Accounts) == 0 {
+		v.errorf(c.pos.lineOf("accounts"), "no account is configured")
+		return
+	}
+
+	names := map[string]bool{}
+	unnamedSignIn := false
+	for i := range c.Accounts {
+		account := &c.Accounts[i]
+		// The tokens of the accounts are saved by their names
+		if account.Name == "" && account.SignsIn() {
+			if unnamedSignIn {
+				v.errorf(account.pos.line, "each account signing in a user must have a name, unless there is only one")
+			}
+			unnamedSignIn = true
+		}
+		if names[account.Name] && account.Name != "" {
+			v.errorf(account.pos.lineOf("name"), "duplicated account name: %q", account.Name)
+		}
+		names[account.Name] = true
+
+		switch account.LoginFlow {
+		case "":
+			account.LoginFlow = c.Login.Flow
+		case LoginBrowser, LoginDevice:
+		default:
+			v.errorf(account.pos.lineOf("loginFlow"), "unknown loginFlow of account %q: %q", account.Name, account.LoginFlow)
+		}
+		if account.AppOnly {
+			if account.Type != "" && account.Type != AccountMicrosoft {
+				v.errorf(account.pos.lineOf("appOnly"), "account %q of type %s can't be appOnly", account.Name, account.Type)
+			}
+			validateAppOnly(v, account)
+		}
+
+		switch account.Type {
+		case "", AccountMicrosoft, AccountGoogle:
+			if account.Type == "" {
+				account.Type = AccountMicrosoft
+			}
+			if account.ClientID == "" {
+				v.errorf(account.pos.line, "account %q must have a clientId", account.Name)
+			}
+		case AccountICS:
+			if len(account.Calendars) == 0 {
+				v.errorf(account.pos.line, "account %q of type ics must have calendars", account.Name)
+			}
+			for _, calendar := range account.Calendars {
+				if calendar.URL == "" {
+					v.errorf(calendar.pos.line, "each calendar of account %q must have a url", account.Name)
+				}
+			}
+		case AccountManual:
+			if len(account.Calendars) == 0 {
+				v.errorf(account.pos.line, "account %q of type manual must have calendars", account.Name)
+			}
+			for _, calendar := range account.Calendars {
+				if calendar.Path == "" {
+					v.errorf(calendar.pos.line, "each calendar of account %q must have a path", account.Name)
+				}
+			}
+		case AccountCalDAV:
+			if account.URL == "" {
+				v.errorf(account.pos.line, "account %q of type caldav must have a url", account.Name)
+			}
+		case AccountEWS:
+			if account.URL == "" {
+				v.errorf(account.pos.line, "account %q of type ews must have a url", account.Name)
+			}
+			switch account.Auth {
+			case "":
+				account.Auth = EWSAuthNTLM
+			case EWSAuthNTLM, EWSAuthBasic:
+			default:
+				v.errorf(account.pos.lineOf("auth"), "unknown auth of account %q: %q", account.Name, account.Auth)
+			}
+		default:
+			v.errorf(account.pos.lineOf("type"), "unknown type of account %q: %q", account.Name, account.Type)
+		}
+
+		for _, calendar := range account.Calendars {
+			if calendar.LeadTime != nil && *calendar.LeadTime < 0 {
+				v.errorf(calendar.pos.lineOf("leadTime"), "leadTime of calendar %q of account %q must not be negative", calendar.Name, account.Name)
+			}
+		}
+	}
+}
+
+// validateAppOnly checks an app-only account, which can only read the mailboxes of
+// its calendars from a single tenant, as there is no signed-in user.
+func validateAppOnly(v *validator, account *Account) {
+	switch account.TenantID {
+	case "", "common", "organizations", "consumers":
+		v.errorf(account.pos.lineOf("tenantId"), "app-only account %q must have the id of its tenant", account.Name)
+	}
+	if account.ClientSecret == "" && account.CertificateFile == "" {
+		v.errorf(account.pos.line, "app-only account %q must have a clientSecret or a certificateFile", account.Name)
+	}
+	if len(account.Calendars) == 0 {
+		v.errorf(account.pos.line, "app-only account %q must have calendars", account.Name)
+	}
+	for _, calendar := range account.Calendars {
+		if calendar.User == "" {
+			v.errorf(calendar.pos.line, "each calendar of app-only account %q must have a user", account.Name)
+		}
+	}
+}
+
+// ParseTimeOfDay parses a time of the day like "22:00" into the time since midnight.
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like \"22:00\"", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseWeekday parses a day of the week like "sat" or "Saturday".
+func ParseWeekday(value string) (time.Weekday, error) {
+	lower := strings.ToLower(value)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if lower == name || lower == name[:3] {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not a day of the week", value)
+}
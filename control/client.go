@@ -0,0 +1,146 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrNotRunning is returned by the client when no instance serves the socket.
+var ErrNotRunning = errors.New("meeting-reminder is not running")
+
+// Client calls the API of the running instance.
+type Client struct {
+	path string
+	http *http.Client
+}
+
+// NewClient creates a client of the socket of path.
+func NewClient(path string) *Client {
+	dialer := &net.Dialer{}
+	return &Client{
+		path: path,
+		http: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		}},
+	}
+}
+
+// Upcoming returns the events starting in the period from now. The events of the calendars
+// which could be read are returned along with the error of the others.
+func (c *Client) Upcoming(ctx context.Context, period time.Duration) ([]Event, error) {
+	var response eventsResponse
+	if err := c.do(ctx, http.MethodGet, "/v1/upcoming?for="+url.QueryEscape(period.String()), nil, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		return response.Events, errors.New(response.Error)
+	}
+	return response.Events, nil
+}
+
+// Refresh refetches the events of all calendars.
+func (c *Client) Refresh(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/refresh", struct{}{}, nil)
+}
+
+// Snooze shows the reminder of the event again after d.
+func (c *Client) Snooze(ctx context.Context, id string, d time.Duration) (Event, error) {
+	var response eventResponse
+	err := c.do(ctx, http.MethodPost, "/v1/snooze", idRequest{ID: id, For: d.String()}, &response)
+	return response.Event, err
+}
+
+// Ack stops the reminders of the event.
+func (c *Client) Ack(ctx context.Context, id string) (Event, error) {
+	var response eventResponse
+	err := c.do(ctx, http.MethodPost, "/v1/ack", idRequest{ID: id}, &response)
+	return response.Event, err
+}
+
+// SetDoNotDisturb turns do not disturb on for d, or until turned off if d is 0, or turns it off.
+func (c *Client) SetDoNotDisturb(ctx context.Context, on bool, d time.Duration) (DoNotDisturb, error) {
+	req := dndRequest{On: on}
+	if d > 0 {
+		req.For = d.String()
+	}
+	var response DoNotDisturb
+	err := c.do(ctx, http.MethodPost, "/v1/dnd", req, &response)
+	return response, err
+}
+
+// Reload reads the configuration again.
+func (c *Client) Reload(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/v1/reload", struct{}{}, nil)
+}
+
+// Health returns the state of the running instance.
+func (c *Client) Health(ctx context.Context) (Health, error) {
+	var response Health
+	err := c.do(ctx, http.MethodGet, "/v1/health", nil, &response)
+	return response, err
+}
+
+// do sends the request with the JSON of body, and decodes the response into result.
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	// The host is ignored, as requests are sent to the socket
+	req, err := http.NewRequestWithContext(ctx, method, "http://meeting-reminder"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if isNotListening(err) {
+		return fmt.Errorf("%w (no socket at %s)", ErrNotRunning, c.path)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var response errorResponse
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(&response); err != nil || response.Error == "" {
+			return fmt.Errorf("request failed with status: %s", resp.Status)
+		}
+		return &apiError{status: resp.StatusCode, message: response.Error}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// apiError is an error reported by the API.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func (e *apiError) Is(target error) bool {
+	return target == ErrNotFound && e.status == http.StatusNotFound
+}
@@ -0,0 +1,97 @@
+// Package control serves the control API of the running program as HTTP over a Unix socket,
+// and is its client.
+package control
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/daemon"
+)
+
+// ErrNotFound is returned by a Controller when the event of an id is not found.
+var ErrNotFound = errors.New("not found")
+
+// Controller is the running program, controlled through the API.
+type Controller interface {
+	// Upcoming returns the events starting in the period from now.
+	Upcoming(ctx context.Context, period time.Duration) ([]Event, error)
+	// Refresh refetches the events of all calendars.
+	Refresh(ctx context.Context) error
+	// Snooze shows the reminder of the event again after d.
+	Snooze(ctx context.Context, id string, d time.Duration) (Event, error)
+	// Ack stops the reminders of the event.
+	Ack(ctx context.Context, id string) (Event, error)
+	// SetDoNotDisturb turns do not disturb on for d, or until turned off if d is 0, or turns it off.
+	SetDoNotDisturb(on bool, d time.Duration) DoNotDisturb
+	// Reload reads the configuration again.
+	Reload(ctx context.Context) error
+	Health() Health
+}
+
+// Event is an upcoming event.
+type Event struct {
+	// ID is the id the event is snoozed or acknowledged by.
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Start    time.Time `json:"start"`
+	Link     string    `json:"link,omitempty"`
+	Calendar string    `json:"calendar,omitempty"`
+	Account  string    `json:"account,omitempty"`
+}
+
+// DoNotDisturb is the state of do not disturb.
+type DoNotDisturb struct {
+	On bool `json:"on"`
+	// Until is when do not disturb ends, nil if it lasts until turned off.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Health statuses
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+// Health is the state of the running program.
+type Health struct {
+	// Status is StatusOK, or StatusDegraded if there are problems.
+	Status    string    `json:"status"`
+	Problems  []string  `json:"problems,omitempty"`
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	// LastCheck is when the reminders were last checked, nil before the first check.
+	LastCheck    *time.Time      `json:"lastCheck,omitempty"`
+	DoNotDisturb DoNotDisturb    `json:"doNotDisturb"`
+	Snoozed      int             `json:"snoozed"`
+	Accounts     []AccountHealth `json:"accounts"`
+}
+
+// AccountHealth is the state of an account.
+type AccountHealth struct {
+	Name string `json:"name,omitempty"`
+	// Push is set if the account is updated by change notifications instead of being polled.
+	Push      bool             `json:"push"`
+	Calendars []CalendarHealth `json:"calendars"`
+}
+
+// CalendarHealth is the state of a calendar.
+type CalendarHealth struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// OK is set if the events of the calendar were fetched by the last request.
+	OK        bool       `json:"ok"`
+	FetchedAt *time.Time `json:"fetchedAt,omitempty"`
+}
+
+// SocketPath returns the path of the control socket of the instance of the user.
+func SocketPath() (string, error) {
+	dir, err := daemon.RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "control.sock"), nil
+}
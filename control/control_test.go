@@ -0,0 +1,138 @@
+//go:build unix
+
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var planning = Event{ID: "0123456789ab", Title: "Planning", Start: time.Date(2033, 3, 3, 10, 0, 0, 0, time.UTC), Account: "Work"}
+
+type fakeController struct {
+	period    time.Duration
+	refreshed bool
+	snoozed   time.Duration
+	acked     string
+	dnd       DoNotDisturb
+	reloadErr error
+}
+
+func (f *fakeController) Upcoming(ctx context.Context, period time.Duration) ([]Event, error) {
+	f.period = period
+	return []Event{planning}, errors.New(`calendar "team" of account "Work": offline`)
+}
+
+func (f *fakeController) Refresh(ctx context.Context) error {
+	f.refreshed = true
+	return nil
+}
+
+func (f *fakeController) Snooze(ctx context.Context, id string, d time.Duration) (Event, error) {
+	if id != planning.ID {
+		return Event{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	f.snoozed = d
+	return planning, nil
+}
+
+func (f *fakeController) Ack(ctx context.Context, id string) (Event, error) {
+	f.acked = id
+	return planning, nil
+}
+
+func (f *fakeController) SetDoNotDisturb(on bool, d time.Duration) DoNotDisturb {
+	f.dnd = DoNotDisturb{On: on}
+	if on && d > 0 {
+		until := time.Date(2033, 3, 3, 10, 0, 0, 0, time.UTC).Add(d)
+		f.dnd.Until = &until
+	}
+	return f.dnd
+}
+
+func (f *fakeController) Reload(ctx context.Context) error {
+	return f.reloadErr
+}
+
+func (f *fakeController) Health() Health {
+	return Health{Status: StatusOK, PID: 42, Accounts: []AccountHealth{{Name: "Work", Calendars: []CalendarHealth{{OK: true}}}}}
+}
+
+func TestClientServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "control.sock")
+	controller := &fakeController{}
+	server, err := Listen(path, controller)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	ctx := context.Background()
+	client := NewClient(path)
+
+	events, err := client.Upcoming(ctx, 72*time.Hour)
+	assert.EqualError(t, err, `calendar "team" of account "Work": offline`)
+	assert.Equal(t, []Event{planning}, events)
+	assert.Equal(t, 72*time.Hour, controller.period)
+
+	require.NoError(t, client.Refresh(ctx))
+	assert.True(t, controller.refreshed)
+
+	event, err := client.Snooze(ctx, planning.ID, 10*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, planning, event)
+	assert.Equal(t, 10*time.Minute, controller.snoozed)
+	_, err = client.Snooze(ctx, "unknown", time.Minute)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.EqualError(t, err, "not found: unknown")
+
+	_, err = client.Ack(ctx, planning.ID)
+	require.NoError(t, err)
+	assert.Equal(t, planning.ID, controller.acked)
+
+	dnd, err := client.SetDoNotDisturb(ctx, true, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, dnd.On)
+	require.NotNil(t, dnd.Until)
+	assert.Equal(t, time.Date(2033, 3, 3, 11, 0, 0, 0, time.UTC), dnd.Until.UTC())
+	dnd, err = client.SetDoNotDisturb(ctx, false, 0)
+	require.NoError(t, err)
+	assert.Equal(t, DoNotDisturb{}, dnd)
+
+	require.NoError(t, client.Reload(ctx))
+	controller.reloadErr = errors.New("line 3: unknown field")
+	assert.EqualError(t, client.Reload(ctx), "line 3: unknown field")
+
+	health, err := client.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, controller.Health(), health)
+
+	require.NoError(t, server.Shutdown(ctx))
+	_, err = client.Health(ctx)
+	assert.True(t, errors.Is(err, ErrNotRunning), "%v", err)
+}
+
+func TestInvalidRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	server, err := Listen(path, &fakeController{})
+	require.NoError(t, err)
+	defer server.Shutdown(context.Background())
+
+	ctx := context.Background()
+	client := NewClient(path)
+	_, err = client.Upcoming(ctx, -time.Hour)
+	assert.EqualError(t, err, `invalid period "-1h0m0s"`)
+	err = client.do(ctx, "POST", "/v1/snooze", idRequest{ID: planning.ID, For: "soon"}, nil)
+	assert.EqualError(t, err, `invalid duration "soon"`)
+	err = client.do(ctx, "GET", "/v1/refresh", nil, nil)
+	assert.EqualError(t, err, "request failed with status: 405 Method Not Allowed")
+}
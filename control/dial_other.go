@@ -0,0 +1,13 @@
+//go:build !plan9
+
+package control
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isNotListening reports whether the error of a request is that nothing listens on the socket.
+func isNotListening(err error) bool {
+	return errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ECONNREFUSED)
+}
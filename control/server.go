@@ -0,0 +1,198 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	maxBodySize = 1 << 16
+	// defaultSnooze is how long a reminder is snoozed if no duration is given
+	defaultSnooze = 5 * time.Minute
+)
+
+// Requests and responses of the API
+type (
+	eventsResponse struct {
+		Events []Event `json:"events"`
+		// Error describes the calendars which couldn't be read.
+		Error string `json:"error,omitempty"`
+	}
+	eventResponse struct {
+		Event Event `json:"event"`
+	}
+	idRequest struct {
+		ID string `json:"id"`
+		// For is the duration of a snooze, e.g. "10m".
+		For string `json:"for,omitempty"`
+	}
+	dndRequest struct {
+		On bool `json:"on"`
+		// For is how long do not disturb lasts, until turned off if empty.
+		For string `json:"for,omitempty"`
+	}
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewHandler returns the handler of the API.
+func NewHandler(controller Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/upcoming", func(w http.ResponseWriter, r *http.Request) {
+		period := 24 * time.Hour
+		if value := r.URL.Query().Get("for"); value != "" {
+			var err error
+			if period, err = time.ParseDuration(value); err != nil || period <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid period %q", value))
+				return
+			}
+		}
+		// Events of the calendars which could be read are listed along with the errors of the others
+		events, err := controller.Upcoming(r.Context(), period)
+		response := eventsResponse{Events: events}
+		if events == nil {
+			response.Events = []Event{}
+		}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		writeJSON(w, response)
+	})
+	mux.HandleFunc("POST /v1/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if err := controller.Refresh(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, struct{}{})
+	})
+	mux.HandleFunc("POST /v1/snooze", func(w http.ResponseWriter, r *http.Request) {
+		var req idRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		d := defaultSnooze
+		if req.For != "" {
+			var err error
+			if d, err = time.ParseDuration(req.For); err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", req.For))
+				return
+			}
+		}
+		event, err := controller.Snooze(r.Context(), req.ID, d)
+		writeEvent(w, event, err)
+	})
+	mux.HandleFunc("POST /v1/ack", func(w http.ResponseWriter, r *http.Request) {
+		var req idRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		event, err := controller.Ack(r.Context(), req.ID)
+		writeEvent(w, event, err)
+	})
+	mux.HandleFunc("POST /v1/dnd", func(w http.ResponseWriter, r *http.Request) {
+		var req dndRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		var d time.Duration
+		if req.For != "" {
+			var err error
+			if d, err = time.ParseDuration(req.For); err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid duration %q", req.For))
+				return
+			}
+		}
+		writeJSON(w, controller.SetDoNotDisturb(req.On, d))
+	})
+	mux.HandleFunc("POST /v1/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := controller.Reload(r.Context()); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, struct{}{})
+	})
+	mux.HandleFunc("GET /v1/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, controller.Health())
+	})
+	return mux
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
+
+func writeEvent(w http.ResponseWriter, event Event, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, eventResponse{Event: event})
+	}
+}
+
+// Server serves the API on a Unix socket, which only the user can connect to.
+type Server struct {
+	path   string
+	server *http.Server
+}
+
+// Listen serves the API of the controller on the socket of path. A socket left by a previous
+// instance is replaced, so the caller must make sure that no other instance is running.
+func Listen(path string, controller Controller) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s := &Server{path: path, server: &http.Server{Handler: NewHandler(controller)}}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Control socket stopped: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// Shutdown stops serving the API within the deadline of ctx, and removes the socket.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	os.Remove(s.path)
+	return err
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/control"
+	"github.com/kajikentaro/meeting-reminder/services"
+	"github.com/kajikentaro/meeting-reminder/ui"
+	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+)
+
+// controller controls the running reminders through the control socket.
+type controller struct {
+	r         *reloader
+	startedAt time.Time
+}
+
+func (c *controller) Upcoming(ctx context.Context, period time.Duration) ([]control.Event, error) {
+	now := xtime.Now()
+	agenda, err := c.r.calendarService.Agenda(ctx, now, now.Add(period))
+	events := make([]control.Event, len(agenda))
+	for i, event := range agenda {
+		events[i] = toControlEvent(event.ID, event.UIEvents)
+	}
+	return events, err
+}
+
+func (c *controller) Refresh(ctx context.Context) error {
+	return c.r.calendarService.RefreshAll(ctx)
+}
+
+func (c *controller) Snooze(ctx context.Context, id string, d time.Duration) (control.Event, error) {
+	event, err := c.r.calendarService.Snooze(ctx, id, d)
+	return toControlEvent(id, event), toControlError(err, id)
+}
+
+func (c *controller) Ack(ctx context.Context, id string) (control.Event, error) {
+	event, err := c.r.calendarService.Ack(ctx, id)
+	return toControlEvent(id, event), toControlError(err, id)
+}
+
+func (c *controller) SetDoNotDisturb(on bool, d time.Duration) control.DoNotDisturb {
+	var until time.Time
+	if on && d > 0 {
+		until = xtime.Now().Add(d)
+	}
+	c.r.calendarService.SetDoNotDisturb(on, until)
+	return toDoNotDisturb(c.r.calendarService.Status())
+}
+
+func (c *controller) Reload(ctx context.Context) error {
+	return c.r.reload(ctx)
+}
+
+// Health reports the program as degraded if the reminders are not checked anymore, or if
+// calendars couldn't be read.
+func (c *controller) Health() control.Health {
+	status := c.r.calendarService.Status()
+	health := control.Health{
+		Status:       control.StatusOK,
+		PID:          os.Getpid(),
+		StartedAt:    c.startedAt,
+		DoNotDisturb: toDoNotDisturb(status),
+		Snoozed:      status.Snoozed,
+	}
+	if !status.LastCheck.IsZero() {
+		health.LastCheck = &status.LastCheck
+		if xtime.Now().Sub(status.LastCheck) > 2*status.WatchInterval+time.Minute {
+			health.Problems = append(health.Problems, fmt.Sprintf("reminders were last checked at %s", status.LastCheck.Format(time.RFC3339)))
+		}
+	}
+	for _, account := range status.Accounts {
+		accountHealth := control.AccountHealth{Name: account.Name, Push: account.Pushed}
+		for _, calendar := range account.Calendars {
+			calendarHealth := control.CalendarHealth{ID: calendar.ID, Name: calendar.Name, Disabled: calendar.Disabled, OK: calendar.OK}
+			if !calendar.FetchedAt.IsZero() {
+				fetchedAt := calendar.FetchedAt
+				calendarHealth.FetchedAt = &fetchedAt
+			}
+			// Calendars are read on the first check
+			if !calendar.OK && !calendar.Disabled && !status.LastCheck.IsZero() {
+				health.Problems = append(health.Problems, fmt.Sprintf("calendar %q of account %q couldn't be read", calendar.ID, account.Name))
+			}
+			accountHealth.Calendars = append(accountHealth.Calendars, calendarHealth)
+		}
+		health.Accounts = append(health.Accounts, accountHealth)
+	}
+	if len(health.Problems) > 0 {
+		health.Status = control.StatusDegraded
+	}
+	return health
+}
+
+func toControlEvent(id string, event ui.UIEvents) control.Event {
+	return control.Event{
+		ID:       id,
+		Title:    event.Title,
+		Start:    event.StartTime,
+		Link:     event.Link,
+		Calendar: event.Calendar,
+		Account:  event.Account,
+	}
+}
+
+func toControlError(err error, id string) error {
+	if errors.Is(err, services.ErrEventNotFound) {
+		return fmt.Errorf("%w: no event of id %s today", control.ErrNotFound, id)
+	}
+	return err
+}
+
+func toDoNotDisturb(status services.Status) control.DoNotDisturb {
+	dnd := control.DoNotDisturb{On: status.DoNotDisturb}
+	if !status.DoNotDisturbUntil.IsZero() {
+		until := status.DoNotDisturbUntil
+		dnd.Until = &until
+	}
+	return dnd
+}
+
+// startControl serves the control socket, if it can be created.
+func startControl(r *reloader) *control.Server {
+	path, err := control.SocketPath()
+	if err == nil {
+		var server *control.Server
+		if server, err = control.Listen(path, &controller{r: r, startedAt: xtime.Now()}); err == nil {
+			log.Printf("Control socket listening on %s", path)
+			return server
+		}
+	}
+	log.Printf("Failed to start the control socket: %v", err)
+	return nil
+}
+
+// ctlCommands are the subcommands of ctl.
+var ctlCommands = []command{
+	{"upcoming", "[-for duration]", "List the upcoming meetings with their ids", runCtlUpcoming},
+	{"refresh", "", "Fetch the events of all calendars now", runCtlRefresh},
+	{"snooze", "[-for duration] id", "Show the reminder of a meeting of today again later", runCtlSnooze},
+	{"ack", "id", "Stop the reminders of a meeting of today", runCtlAck},
+	{"dnd", "[-for duration] on|off", "Turn do not disturb on, for a while or until turned off, or off", runCtlDoNotDisturb},
+	{"reload", "", "Read the configuration again", runCtlReload},
+	{"health", "[-json]", "Show the state of the running reminders, and fail if they are degraded", runCtlHealth},
+}
+
+// ctlSocket is the path of the control socket, set by the -socket flag of ctl.
+var ctlSocket string
+
+func runCommandCtl(flags *flag.FlagSet, opts *options, args []string) {
+	defaultSocket, err := control.SocketPath()
+	if err != nil {
+		fatalf("Error finding the control socket: %v", err)
+	}
+	flags.StringVar(&ctlSocket, "socket", defaultSocket, "control socket of the running reminders")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: %s ctl [-socket path] command [flags]\n\nCommands:\n", os.Args[0])
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, c := range ctlCommands {
+			fmt.Fprintf(w, "  %s %s\t%s\n", c.name, c.args, c.description)
+		}
+		w.Flush()
+		fmt.Fprint(out, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	for _, c := range ctlCommands {
+		if c.name != flags.Arg(0) {
+			continue
+		}
+		subflags := flag.NewFlagSet("ctl "+c.name, flag.ExitOnError)
+		subflags.Usage = func() {
+			fmt.Fprintf(subflags.Output(), "Usage: %s ctl %s %s\n\n%s\n", os.Args[0], c.name, c.args, c.description)
+			subflags.PrintDefaults()
+		}
+		c.run(subflags, opts, flags.Args()[1:])
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Unknown ctl command: %s\n\n", flags.Arg(0))
+	flags.Usage()
+	os.Exit(2)
+}
+
+// parseCtl parses the arguments of a ctl command, which takes exactly nargs arguments.
+func parseCtl(flags *flag.FlagSet, args []string, nargs int) []string {
+	flags.Parse(args)
+	if flags.NArg() != nargs {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return flags.Args()
+}
+
+func ctlClient() *control.Client {
+	return control.NewClient(ctlSocket)
+}
+
+func runCtlUpcoming(flags *flag.FlagSet, opts *options, args []string) {
+	period := flags.Duration("for", 24*time.Hour, "list the meetings starting in this period")
+	parseCtl(flags, args, 0)
+	events, err := ctlClient().Upcoming(context.Background(), *period)
+	// Events are nil unless the running reminders listed them
+	if err != nil && events == nil {
+		fatalf("%v", err)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Some calendars couldn't be read:\n%v\n\n", err)
+	}
+	if len(events) == 0 {
+		fmt.Println("No meetings")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, event := range events {
+		var labels []string
+		for _, label := range []string{event.Account, event.Calendar} {
+			if label != "" {
+				labels = append(labels, label)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", event.ID, event.Start.Local().Format("Mon Jan 2 15:04"), event.Title, strings.Join(labels, " / "), event.Link)
+	}
+	w.Flush()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func runCtlRefresh(flags *flag.FlagSet, opts *options, args []string) {
+	parseCtl(flags, args, 0)
+	if err := ctlClient().Refresh(context.Background()); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Println("Refreshed")
+}
+
+func runCtlSnooze(flags *flag.FlagSet, opts *options, args []string) {
+	d := flags.Duration("for", 5*time.Minute, "how long to snooze the reminder")
+	args = parseCtl(flags, args, 1)
+	event, err := ctlClient().Snooze(context.Background(), args[0], *d)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Snoozed %q until %s\n", event.Title, time.Now().Add(*d).Format("15:04"))
+}
+
+func runCtlAck(flags *flag.FlagSet, opts *options, args []string) {
+	args = parseCtl(flags, args, 1)
+	event, err := ctlClient().Ack(context.Background(), args[0])
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Acknowledged %q at %s\n", event.Title, event.Start.Local().Format("15:04"))
+}
+
+func runCtlDoNotDisturb(flags *flag.FlagSet, opts *options, args []string) {
+	d := flags.Duration("for", 0, "how long do not disturb lasts (default until turned off)")
+	args = parseCtl(flags, args, 1)
+	if args[0] != "on" && args[0] != "off" {
+		fatalf(`Do not disturb is turned "on" or "off", not %q`, args[0])
+	}
+	dnd, err := ctlClient().SetDoNotDisturb(context.Background(), args[0] == "on", *d)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Println(formatDoNotDisturb(dnd))
+}
+
+func runCtlReload(flags *flag.FlagSet, opts *options, args []string) {
+	parseCtl(flags, args, 0)
+	if err := ctlClient().Reload(context.Background()); err != nil {
+		fatalf("Invalid configuration, keeping the current one:\n%v", err)
+	}
+	fmt.Println("Configuration reloaded")
+}
+
+func runCtlHealth(flags *flag.FlagSet, opts *options, args []string) {
+	asJSON := flags.Bool("json", false, "print the state as JSON")
+	parseCtl(flags, args, 0)
+	health, err := ctlClient().Health(context.Background())
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(health, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		fmt.Printf("Status:          %s\n", health.Status)
+		for _, problem := range health.Problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		fmt.Printf("PID:             %d\nUp since:        %s\n", health.PID, health.StartedAt.Local().Format(time.RFC3339))
+		lastCheck := "not yet"
+		if health.LastCheck != nil {
+			lastCheck = health.LastCheck.Local().Format(time.RFC3339)
+		}
+		fmt.Printf("Last check:      %s\nDo not disturb:  %s\nSnoozed:         %d\n", lastCheck, formatDoNotDisturb(health.DoNotDisturb), health.Snoozed)
+		for _, account := range health.Accounts {
+			name, mode := account.Name, "polled"
+			if name == "" {
+				name = "Account"
+			}
+			if account.Push {
+				mode = "change notifications"
+			}
+			fmt.Printf("%s (%s)\n", name, mode)
+			for _, calendar := range account.Calendars {
+				fmt.Printf("  %s\n", formatCalendarHealth(calendar))
+			}
+		}
+	}
+	if health.Status != control.StatusOK {
+		os.Exit(1)
+	}
+}
+
+func formatDoNotDisturb(dnd control.DoNotDisturb) string {
+	switch {
+	case !dnd.On:
+		return "off"
+	case dnd.Until == nil:
+		return "on"
+	default:
+		return "on until " + dnd.Until.Local().Format("15:04")
+	}
+}
+
+func formatCalendarHealth(calendar control.CalendarHealth) string {
+	name := calendar.Name
+	if name == "" {
+		name = calendar.ID
+	}
+	if name == "" {
+		name = "default calendar"
+	}
+	switch {
+	case calendar.Disabled:
+		return name + ": disabled"
+	case calendar.OK:
+		return name + ": fetched at " + calendar.FetchedAt.Local().Format("15:04:05")
+	case calendar.FetchedAt != nil:
+		return name + ": failed, last fetched at " + calendar.FetchedAt.Local().Format("15:04:05")
+	default:
+		return name + ": not fetched yet"
+	}
+}
@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Lock when another process holds the lock.
+var ErrLocked = errors.New("already locked by another process")
+
+// RuntimeDir returns the directory of the files of the running instance of the user, in the
+// runtime directory if there is one, which is cleaned up on logout, or else in the cache directory.
+func RuntimeDir() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = cacheDir
+	}
+	return filepath.Join(dir, "meeting-reminder"), nil
+}
+
+// LockPath returns the path of the lock of the instance of the user.
+func LockPath() (string, error) {
+	dir, err := RuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "instance.lock"), nil
+}
+
+// InstanceLock is a file lock, which is released when the process exits, even if it crashes.
+type InstanceLock struct {
+	file *os.File
+}
+
+// Lock takes the lock of path, so that only one process runs with it, and writes the pid of
+// the process to the file. If another process holds it, ErrLocked is returned along with
+// the pid read from the file, or 0.
+func Lock(path string) (*InstanceLock, int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, 0, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := lockFile(file); err != nil {
+		pid := readPid(file)
+		file.Close()
+		return nil, pid, err
+	}
+
+	if err := writePid(file); err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return &InstanceLock{file: file}, 0, nil
+}
+
+// Unlock releases the lock.
+func (l *InstanceLock) Unlock() error {
+	return l.file.Close()
+}
+
+func writePid(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
+
+func readPid(file *os.File) int {
+	data := make([]byte, 32)
+	n, _ := file.ReadAt(data, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	return pid
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile fails on this platform, as a single instance can't be guaranteed.
+func lockFile(file *os.File) error {
+	return errors.New("locking files is not supported on this platform")
+}
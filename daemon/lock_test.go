@@ -0,0 +1,33 @@
+//go:build unix
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "instance.lock")
+	lock, _, err := Lock(path)
+	require.NoError(t, err)
+
+	// A lock taken by another open file of the same path conflicts, like in another process
+	_, pid, err := Lock(path)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Equal(t, os.Getpid(), pid)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+
+	require.NoError(t, lock.Unlock())
+	lock, _, err = Lock(path)
+	require.NoError(t, err)
+	lock.Unlock()
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package daemon
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// DOC: https://learn.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-lockfileex
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// lockFile takes an exclusive lock of the file without blocking. The byte locked is past the
+// pid, so that other processes can still read it.
+func lockFile(file *os.File) error {
+	overlapped := &syscall.Overlapped{OffsetHigh: 1}
+	r, _, err := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r != 0 {
+		return nil
+	}
+	if errors.Is(err, errorLockViolation) {
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+// Package daemon integrates the program with the service manager of the system.
+package daemon
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States sent to systemd by Notify.
+// DOC: https://www.freedesktop.org/software/systemd/man/latest/sd_notify.html
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends the state to systemd, if the program is run by a unit of Type=notify.
+// It reports whether the state was sent, which it is not when NOTIFY_SOCKET is unset.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A name starting with @ is in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often the watchdog of systemd must be notified, which is half
+// of WatchdogSec of the unit, or 0 if the watchdog is disabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServiceName is the name of the systemd user unit of the program.
+const ServiceName = "meeting-reminder.service"
+
+// UnitPath returns where the user unit is installed, in the config directory of systemd.
+func UnitPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user", ServiceName), nil
+}
+
+// Unit is a systemd user service running the program, which notifies systemd when it is
+// ready and pings its watchdog. Starting it doesn't time out.
+// DOC: https://www.freedesktop.org/software/systemd/man/latest/systemd.service.html
+type Unit struct {
+	Description string
+	// Command is the executable and its arguments.
+	Command          []string
+	WorkingDirectory string
+	Environment      map[string]string
+	// RestartDelay is how long to wait before restarting the program after a failure.
+	RestartDelay time.Duration
+	// Watchdog is how long the program may not ping the watchdog before it is restarted. 0 disables it.
+	Watchdog time.Duration
+	// StopTimeout is how long the program may take to stop before it is killed.
+	StopTimeout time.Duration
+}
+
+// String returns the unit file.
+func (u Unit) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=%s\nAfter=graphical-session.target\n\n", u.Description)
+
+	b.WriteString("[Service]\nType=notify\nNotifyAccess=main\n")
+	var args []string
+	for _, arg := range u.Command {
+		args = append(args, quote(arg, true))
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(args, " "))
+	if u.WorkingDirectory != "" {
+		// Paths are not unquoted
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", strings.ReplaceAll(u.WorkingDirectory, "%", "%%"))
+	}
+	var keys []string
+	for key := range u.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "Environment=%s\n", quote(key+"="+u.Environment[key], false))
+	}
+	fmt.Fprintf(&b, "Restart=on-failure\nRestartSec=%d\n", int(u.RestartDelay.Seconds()))
+	// The program is ready once signed in, which may wait for the user to sign in interactively
+	b.WriteString("TimeoutStartSec=infinity\n")
+	if u.Watchdog > 0 {
+		fmt.Fprintf(&b, "WatchdogSec=%d\n", int(u.Watchdog.Seconds()))
+	}
+	if u.StopTimeout > 0 {
+		fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int(u.StopTimeout.Seconds()))
+	}
+
+	b.WriteString("\n[Install]\nWantedBy=default.target\n")
+	return b.String()
+}
+
+// quote quotes a value of the unit file, escaping the specifiers. In a command line, where
+// variables are expanded, $ is escaped too.
+func quote(value string, commandLine bool) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "\n", `\n`).Replace(value)
+	if commandLine {
+		value = strings.ReplaceAll(value, "$", "$$")
+	}
+	return `"` + value + `"`
+}
@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitString(t *testing.T) {
+	unit := Unit{
+		Description:      "Meeting reminder",
+		Command:          []string{"/opt/meeting reminder/mr", "run", "-config", "/home/me/100%.yaml"},
+		WorkingDirectory: "/home/me",
+		Environment:      map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0", "TITLE": `say "hi" $HOME`},
+		RestartDelay:     10 * time.Second,
+		Watchdog:         time.Minute,
+		StopTimeout:      20 * time.Second,
+	}
+	assert.Equal(t, `[Unit]
+Description=Meeting reminder
+After=graphical-session.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart="/opt/meeting reminder/mr" "run" "-config" "/home/me/100%%.yaml"
+WorkingDirectory=/home/me
+Environment="DISPLAY=:0"
+Environment="TITLE=say \"hi\" $HOME"
+Environment="WAYLAND_DISPLAY=wayland-0"
+Restart=on-failure
+RestartSec=10
+TimeoutStartSec=infinity
+WatchdogSec=60
+TimeoutStopSec=20
+
+[Install]
+WantedBy=default.target
+`, unit.String())
+}
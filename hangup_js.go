@@ -0,0 +1,8 @@
+//go:build js
+
+package main
+
+import "os"
+
+// notifyHangup does nothing, as there is no SIGHUP.
+func notifyHangup(c chan<- os.Signal) {}
@@ -1,72 +1,391 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/kajikentaro/meeting-reminder/auth"
+	"github.com/kajikentaro/meeting-reminder/config"
+	"github.com/kajikentaro/meeting-reminder/control"
+	"github.com/kajikentaro/meeting-reminder/daemon"
+	"github.com/kajikentaro/meeting-reminder/metrics"
 	"github.com/kajikentaro/meeting-reminder/repositories"
 	"github.com/kajikentaro/meeting-reminder/services"
 	"github.com/kajikentaro/meeting-reminder/ui"
+	"github.com/kajikentaro/meeting-reminder/utils/ntlm"
+	"github.com/kajikentaro/meeting-reminder/webhooks"
+	"golang.org/x/oauth2"
 )
 
-// Load environment variables
-func loadEnv() {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-}
+// shutdownTimeout bounds the cleanup when the program is stopped
+const shutdownTimeout = 10 * time.Second
 
-func setupLogging() {
+// setupLogging writes the log to app.log, and returns the file to close when stopping.
+func setupLogging() *os.File {
 	logFile, err := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatal("Error opening log file:", err)
 	}
 	log.SetOutput(logFile)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	return logFile
+}
+
+// ledgerPath returns where the ledger of the reminders shown is saved between runs.
+func ledgerPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "meeting-reminder", "ledger.json"), nil
+}
+
+// Subscribe to change notifications if a public endpoint is configured, and return the manager
+// of the subscriptions and the server receiving them. Otherwise, or if subscribing fails,
+// calendars are polled.
+func startWebhooks(ctx context.Context, webhook config.Webhook, calendarService *services.CalendarService, subscribers map[string]webhooks.Subscriber) (*webhooks.Manager, *http.Server) {
+	if webhook.URL == "" {
+		log.Println("webhook.url is not set, polling calendars")
+		return nil, nil
+	}
+
+	manager := webhooks.NewManager(webhook.URL, calendarService)
+	listener, err := net.Listen("tcp", webhook.ListenAddr)
+	if err != nil {
+		log.Printf("Failed to start webhook receiver, polling calendars: %v", err)
+		return nil, nil
+	}
+	server := &http.Server{Handler: manager}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Webhook receiver stopped: %v", err)
+		}
+	}()
+	log.Printf("Webhook receiver listening on %s for %s", webhook.ListenAddr, webhook.URL)
+
+	for account, subscriber := range subscribers {
+		if err := manager.Subscribe(ctx, account, subscriber); err != nil {
+			log.Printf("Failed to subscribe to account %q, polling it: %v", account, err)
+		}
+	}
+	return manager, server
+}
+
+// startMetrics serves the Prometheus metrics at /metrics on the address, unless it is empty.
+func startMetrics(addr string) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Printf("Failed to serve metrics: %v", err)
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics on http://%s/metrics", listener.Addr())
+	return server
+}
+
+// loginRedirectURL returns the redirect URL of the browser login of a validated config.
+// Port 0 listens on a port chosen by the system, which the redirect URL is updated with on each login.
+func loginRedirectURL(login config.Login) string {
+	return "http://localhost:" + login.CallbackPort + login.CallbackPath
+}
+
+// newAccountAuth creates the auth of a Microsoft or Google account, without signing in.
+// deviceLogin overrides the login flow of the account with the device code flow.
+func newAccountAuth(account config.Account, c *config.Config, deviceLogin bool) *auth.Auth {
+	loginFlow := auth.LoginBrowser
+	if deviceLogin || account.LoginFlow == config.LoginDevice {
+		loginFlow = auth.LoginDeviceCode
+	}
+	redirectURL := loginRedirectURL(c.Login)
+	tokenStore := newTokenStore(account, c.Tokens)
+	if account.Type == config.AccountGoogle {
+		return auth.NewGoogle(account.ClientID, account.ClientSecret, redirectURL, tokenStore, loginFlow)
+	}
+	return auth.NewMicrosoft(account.ClientID, account.ClientSecret, redirectURL, account.TenantID, tokenStore, loginFlow)
+}
+
+// newAppOnlyTokenSource authenticates the app of an app-only account by its certificate, or else by its client secret.
+func newAppOnlyTokenSource(account config.Account) (oauth2.TokenSource, error) {
+	if account.CertificateFile == "" {
+		return auth.NewAppOnly(account.TenantID, account.ClientID, account.ClientSecret), nil
+	}
+	source, err := auth.NewAppOnlyWithCertificate(account.TenantID, account.ClientID, account.CertificateFile, account.CertificateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate of account %q: %w", account.Name, err)
+	}
+	return source, nil
+}
+
+// accountTokenPath returns the path of the token file of the account.
+func accountTokenPath(account config.Account) string {
+	if account.TokenFile != "" {
+		return account.TokenFile
+	}
+	tokenPath, err := auth.GetAccountTokenFilePath(account.Name)
+	if err != nil {
+		log.Fatal("Failed to get token file path:", err)
+	}
+	return tokenPath
+}
+
+// newTokenStore creates the store of the token of the account selected by tokens.Store.
+func newTokenStore(account config.Account, tokens config.Tokens) auth.TokenStore {
+	tokenPath := accountTokenPath(account)
+	switch tokens.Store {
+	case config.TokenStoreEncrypted:
+		encrypted, err := auth.NewEncryptedFileTokenStore(
+			strings.TrimSuffix(tokenPath, ".json")+".enc",
+			tokens.Passphrase,
+			tokens.KeyFile,
+		)
+		if err != nil {
+			log.Fatal("Failed to initialize encrypted token store:", err)
+		}
+		return encrypted
+	case config.TokenStoreSecretService:
+		return &auth.SecretServiceTokenStore{Account: account.Name}
+	}
+	return &auth.FileTokenStore{Path: tokenPath}
+}
+
+// migrateTokenFile moves the token of the account saved as plain JSON by an earlier version to
+// the store of authInstance. It is done when signing in, not by the commands only reading tokens.
+func migrateTokenFile(account config.Account, authInstance *auth.Auth) {
+	tokenPath := accountTokenPath(account)
+	if store, ok := authInstance.Store.(*auth.FileTokenStore); ok && store.Path == tokenPath {
+		return
+	}
+	if err := auth.MigrateTokenFile(authInstance.Store, tokenPath); err != nil {
+		log.Printf("Failed to move token of account %q to the token store: %v", account.Name, err)
+	}
 }
 
 func main() {
-	setupLogging()
+	opts := newOptions()
+	opts.register(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
 
-	log.Println("Program started")
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"run"}
+	}
+	runCommand(args, opts)
+}
 
-	// Load environment variables
-	loadEnv()
+// runReminders shows the reminders of the meetings of all accounts until the process is stopped.
+// The configuration is reloaded on SIGHUP, or when the config file changes.
+// On SIGINT or SIGTERM, the requests in flight are canceled and the state is saved before exiting.
+func runReminders(c *config.Config, opts *options) {
+	lock := lockInstance()
+	defer lock.Unlock()
+	logFile := setupLogging()
 
-	// Initialize UI
-	uiInstance := ui.NewUI(
-		os.Getenv("BROWSER_PATH"),
-		os.Getenv("OUTPUT_DIR"),
-		os.Getenv("OPEN_DIR"),
-	)
-
-	// Get configuration information from environment variables
-	tenantID := os.Getenv("TENANT_ID")
-	clientID := os.Getenv("CLIENT_ID")
-	clientSecret := os.Getenv("CLIENT_SECRET")
-	redirectURL := "http://localhost:9091/callback" // Fixed
-
-	// Initialize Auth
-	authInstance, err := auth.NewAuth(
-		clientID,
-		clientSecret,
-		redirectURL,
-		tenantID,
-	)
+	log.Println("Program started")
+
+	filter, err := newFilter(c)
 	if err != nil {
-		log.Fatal("Failed to initialize auth:", err)
+		log.Fatal("Invalid filter:", err)
 	}
 
-	// Initialize Repository with Auth
-	microsoftRepo := repositories.NewMicrosoftRepository(authInstance)
+	// Initialize UI
+	r := &reloader{opts: opts, config: c, uiInstance: ui.NewUI(c.UI.BrowserPath, c.UI.OutputDir, c.UI.OpenDir)}
+
+	var accounts []services.Account
+	subscribers := map[string]webhooks.Subscriber{}
+	for _, accountConfig := range c.Accounts {
+		account, subscriber, err := signInAccount(c, accountConfig, r.reloginPrompt, opts.deviceLogin, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if subscriber != nil {
+			subscribers[accountConfig.Name] = subscriber
+		}
+		accounts = append(accounts, account)
+		r.accounts = append(r.accounts, runningAccount{config: accountConfig, account: account, subscriber: subscriber})
+	}
 
 	// Initialize Calendar Service
-	calendarService := services.NewCalendarService(microsoftRepo, uiInstance, time.Minute)
+	r.calendarService = services.NewMultiAccountCalendarService(accounts, newNotifier(c, r.uiInstance), time.Duration(c.Reminders.Interval))
+	r.calendarService.SetFilter(filter)
+	if path, err := ledgerPath(); err == nil {
+		if err := r.calendarService.LoadLedger(path); err != nil {
+			log.Printf("Failed to load the reminders shown before: %v", err)
+		}
+	}
+
+	// Signals are handled once signed in, so that an interactive sign-in can still be interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var server *http.Server
+	r.manager, server = startWebhooks(ctx, c.Webhook, r.calendarService, subscribers)
+	go r.watch(ctx)
+	controlServer := startControl(r)
+	metricsServer := startMetrics(c.Metrics.ListenAddr)
+
+	notifySystemd(daemon.Ready)
+	if interval := daemon.WatchdogInterval(); interval > 0 {
+		go pingWatchdog(ctx, interval, r.calendarService)
+	}
 
 	// Start the event watcher
-	calendarService.StartEventWatcher()
+	r.calendarService.StartEventWatcher(ctx)
+
+	// A second signal stops the program at once
+	stop()
+	r.shutdown(server, controlServer, metricsServer, logFile)
+}
+
+// shutdown stops receiving change notifications and requests of the control socket and of the
+// metrics, deletes the subscriptions and saves the state, within shutdownTimeout.
+func (r *reloader) shutdown(server *http.Server, controlServer *control.Server, metricsServer *http.Server, logFile *os.File) {
+	log.Println("Stopping...")
+	notifySystemd(daemon.Stopping)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Failed to stop the webhook receiver: %v", err)
+		}
+	}
+	if controlServer != nil {
+		if err := controlServer.Shutdown(ctx); err != nil {
+			log.Printf("Failed to stop the control socket: %v", err)
+		}
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("Failed to stop the metrics server: %v", err)
+		}
+	}
+	if r.manager != nil {
+		r.manager.Close(ctx)
+	}
+	// The cached events are refetched at start, but the ledger prevents showing reminders again
+	if path, err := ledgerPath(); err != nil {
+		log.Printf("Failed to save the reminders shown: %v", err)
+	} else if err := r.calendarService.SaveLedger(path); err != nil {
+		log.Printf("Failed to save the reminders shown: %v", err)
+	}
+
+	log.Println("Program stopped")
+	logFile.Sync()
+	logFile.Close()
+}
+
+// signInAccounts creates the providers of the configured accounts, signing in to them
+// interactively if there is no valid token.
+func signInAccounts(c *config.Config, deviceLogin bool) []services.Account {
+	var accounts []services.Account
+	for _, accountConfig := range c.Accounts {
+		account, _, err := signInAccount(c, accountConfig, nil, deviceLogin, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// signInAccount creates the provider of the account, signing in to it interactively if there
+// is no valid token, unless interactive is false, and then auth.ErrReloginRequired is returned.
+// If relogin is not nil, it returns how to show where to sign in again when the token can't be
+// refreshed anymore.
+// A Microsoft account of a user is also returned as the subscriber of its change notifications.
+func signInAccount(c *config.Config, accountConfig config.Account, relogin func(account string) auth.Prompt, deviceLogin, interactive bool) (services.Account, webhooks.Subscriber, error) {
+	var authInstance *auth.Auth
+	if accountConfig.SignsIn() {
+		if accountConfig.Name != "" {
+			log.Printf("Signing in to account %q...", accountConfig.Name)
+		}
+		authInstance = newAccountAuth(accountConfig, c, deviceLogin)
+		migrateTokenFile(accountConfig, authInstance)
+		signIn := authInstance.SignIn
+		if !interactive {
+			signIn = authInstance.Resume
+		}
+		if err := signIn(); err != nil {
+			return services.Account{}, nil, fmt.Errorf("failed to initialize auth of account %q: %w", accountConfig.Name, err)
+		}
+		if relogin != nil {
+			authInstance.OnReloginRequired = relogin(accountConfig.Name)
+		}
+	}
+	return newAccount(accountConfig, authInstance, time.Duration(c.Reminders.LeadTime))
+}
+
+// newAccount creates the provider of the account. authInstance is the auth of the
+// accounts a user signs in to, and nil for the others. leadTime is the default lead time
+// of the calendars.
+// Microsoft accounts of a user are also returned as the subscriber of their change notifications.
+func newAccount(accountConfig config.Account, authInstance *auth.Auth, leadTime time.Duration) (services.Account, webhooks.Subscriber, error) {
+	account := services.Account{
+		Name:      accountConfig.Name,
+		Calendars: toCalendars(accountConfig, leadTime),
+	}
+	switch accountConfig.Type {
+	case config.AccountICS:
+		account.Provider = repositories.NewICSRepository(accountConfig.Email)
+	case config.AccountManual:
+		account.Provider = repositories.NewManualRepository()
+	case config.AccountCalDAV:
+		caldavRepo := repositories.NewCalDAVRepository(accountConfig.URL, accountConfig.Email)
+		caldavRepo.Username = accountConfig.Username
+		caldavRepo.Password = accountConfig.Password
+		caldavRepo.Token = accountConfig.Token
+		account.Provider = caldavRepo
+	case config.AccountEWS:
+		ewsRepo := repositories.NewEWSRepository(accountConfig.URL)
+		switch {
+		case accountConfig.Token != "":
+			ewsRepo.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accountConfig.Token})
+		case accountConfig.Auth == config.EWSAuthBasic:
+			ewsRepo.Username = accountConfig.Username
+			ewsRepo.Password = accountConfig.Password
+		default:
+			ewsRepo.Client.Transport = &ntlm.Transport{
+				Username: accountConfig.Username,
+				Password: accountConfig.Password,
+			}
+		}
+		account.Provider = ewsRepo
+	case config.AccountGoogle:
+		account.Provider = repositories.NewGoogleRepository(authInstance)
+	default:
+		if accountConfig.AppOnly {
+			// Change notifications are not subscribed, as they cover the calendars of the signed-in user
+			tokenSource, err := newAppOnlyTokenSource(accountConfig)
+			if err != nil {
+				return account, nil, err
+			}
+			account.Provider = repositories.NewMicrosoftRepository(tokenSource)
+			break
+		}
+		microsoftRepo := repositories.NewMicrosoftRepository(authInstance)
+		account.Provider = microsoftRepo
+		return account, microsoftRepo, nil
+	}
+	return account, nil, nil
 }
@@ -0,0 +1,90 @@
+// Package metrics counts what the program does, and exposes it to Prometheus.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the metrics of the program.
+var Registry = prometheus.NewRegistry()
+
+// Buckets of the durations of requests, in seconds
+var requestBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	GraphRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "meeting_reminder_graph_requests_total",
+		Help: "Requests to the Graph API by kind, http or batched in a JSON batch, and status code, or error if there is no response.",
+	}, []string{"kind", "code"})
+	GraphRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "meeting_reminder_graph_request_duration_seconds",
+		Help:    "Duration of the HTTP requests to the Graph API.",
+		Buckets: requestBuckets,
+	})
+
+	FetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "meeting_reminder_fetch_duration_seconds",
+		Help:    "Duration of the fetches of the events of the calendars of an account.",
+		Buckets: requestBuckets,
+	}, []string{"account"})
+	FetchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "meeting_reminder_fetch_errors_total",
+		Help: "Fetches of the events of a calendar which failed, by account.",
+	}, []string{"account"})
+	EventsFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "meeting_reminder_events_fetched_total",
+		Help: "Events fetched from the calendars, by account.",
+	}, []string{"account"})
+
+	TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "meeting_reminder_token_refreshes_total",
+		Help: "Refreshes of access tokens by result: success, failure, or reauth if the account must sign in again.",
+	}, []string{"result"})
+
+	RemindersScheduled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "meeting_reminder_reminders_scheduled_total",
+		Help: "Reminders found due when checking the events.",
+	})
+	RemindersFired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "meeting_reminder_reminders_fired_total",
+		Help: "Reminders shown.",
+	})
+	RemindersMissed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "meeting_reminder_reminders_missed_total",
+		Help: "Reminders which were due while the events were not checked, like while the computer was asleep.",
+	})
+	ReminderLateness = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "meeting_reminder_reminder_lateness_seconds",
+		Help:    "Delay between when reminders were due and when they were shown.",
+		Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	})
+
+	Notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "meeting_reminder_notifications_total",
+		Help: "Reminders delivered by notifier backend and result: success or failure.",
+	}, []string{"backend", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		GraphRequests, GraphRequestDuration,
+		FetchDuration, FetchErrors, EventsFetched,
+		TokenRefreshes,
+		RemindersScheduled, RemindersFired, RemindersMissed, ReminderLateness,
+		Notifications,
+	)
+}
+
+// Result label values
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Handler serves the metrics of the program.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	RemindersFired.Inc()
+	Notifications.WithLabelValues("browser", Success).Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "# TYPE meeting_reminder_reminders_fired_total counter\nmeeting_reminder_reminders_fired_total 1\n")
+	assert.Contains(t, w.Body.String(), `meeting_reminder_notifications_total{backend="browser",result="success"} 1`)
+	// Histograms without labels are exposed before any value is observed
+	assert.Contains(t, w.Body.String(), `meeting_reminder_reminder_lateness_seconds_count 0`)
+}
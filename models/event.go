@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// ResponseStatus is the response of an attendee to a meeting invitation.
+type ResponseStatus string
+
+const (
+	ResponseNone         ResponseStatus = "none"
+	ResponseOrganizer    ResponseStatus = "organizer"
+	ResponseAccepted     ResponseStatus = "accepted"
+	ResponseTentative    ResponseStatus = "tentative"
+	ResponseDeclined     ResponseStatus = "declined"
+	ResponseNotResponded ResponseStatus = "notResponded"
+)
+
+// AttendeeType tells whether an attendee is required, optional or a resource like a room.
+type AttendeeType string
+
+const (
+	AttendeeRequired AttendeeType = "required"
+	AttendeeOptional AttendeeType = "optional"
+	AttendeeResource AttendeeType = "resource"
+)
+
+type Attendee struct {
+	Name     string
+	Email    string
+	Type     AttendeeType
+	Response ResponseStatus
+}
+
+// Event is an occurrence of a calendar event, independent of the calendar provider.
+// Recurring events are expanded into one Event per occurrence.
+type Event struct {
+	// UID identifies the event across calendars and providers (iCalendar UID, Graph iCalUId).
+	// Occurrences of a recurring event share it. Optional.
+	UID      string
+	Title    string
+	Start    time.Time
+	End      time.Time
+	AllDay   bool
+	Location string
+	// JoinURL is the link to join an online meeting. Optional.
+	JoinURL string
+
+	// Organizer is the name of the organizer. Optional.
+	Organizer string
+	// IsOrganizer is set if the signed-in user organizes the event.
+	IsOrganizer bool
+	Attendees   []Attendee
+	// Response is the response of the signed-in user. Empty if unknown.
+	Response ResponseStatus
+
+	// Alarms are the reminders set on the event, as durations before its start.
+	Alarms []time.Duration
+}
+
+// CalendarView is the result of fetching the events of a calendar.
+type CalendarView struct {
+	Events []Event
+	// Err is set if the events of this calendar could not be fetched
+	Err error
+}
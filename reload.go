@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/auth"
+	"github.com/kajikentaro/meeting-reminder/config"
+	"github.com/kajikentaro/meeting-reminder/services"
+	"github.com/kajikentaro/meeting-reminder/ui"
+	"github.com/kajikentaro/meeting-reminder/webhooks"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// reloader applies the changes of the configuration to the running reminders.
+type reloader struct {
+	opts            *options
+	calendarService *services.CalendarService
+	// manager keeps the subscriptions of change notifications, nil if calendars are polled
+	manager *webhooks.Manager
+
+	// reloading serializes the reloads, which are requested by signals, file changes and the control socket
+	reloading sync.Mutex
+	config    *config.Config
+	accounts  []runningAccount
+
+	mu         sync.Mutex
+	uiInstance *ui.UI
+}
+
+// runningAccount is an account whose reminders are shown.
+type runningAccount struct {
+	config     config.Account
+	account    services.Account
+	subscriber webhooks.Subscriber
+}
+
+// watch reloads the configuration on SIGHUP, or when the config file or ACCOUNTS_FILE changes,
+// until ctx is canceled.
+func (r *reloader) watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	notifyHangup(hangup)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	stamp := r.filesStamp()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Println("Received SIGHUP, reloading the configuration")
+		case <-ticker.C:
+			if r.filesStamp() == stamp {
+				continue
+			}
+			log.Println("Configuration file changed, reloading it")
+		}
+		stamp = r.filesStamp()
+		r.reload(ctx)
+	}
+}
+
+// filesStamp returns the sizes and modification times of the files of the configuration,
+// including the env file, which change when the files are written.
+func (r *reloader) filesStamp() string {
+	var paths []string
+	if path, _, err := r.opts.configFile(); err == nil {
+		paths = append(paths, path)
+	}
+	if path := r.opts.getenv("ACCOUNTS_FILE"); path != "" {
+		paths = append(paths, path)
+	}
+	paths = append(paths, r.opts.envFile)
+
+	var stamps []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			stamps = append(stamps, path+" missing")
+			continue
+		}
+		stamps = append(stamps, fmt.Sprintf("%s %d %d", path, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(stamps, "\n")
+}
+
+// reload loads the configuration again and swaps it into the running reminders at once.
+// Accounts whose connection and credentials are unchanged keep their providers and
+// subscriptions, and only their calendars are replaced.
+// An invalid configuration is rejected, keeping the current one, and its error is returned.
+func (r *reloader) reload(ctx context.Context) error {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	c, err := r.opts.load()
+	if err == nil {
+		err = c.Validate()
+	}
+	var filter services.Filter
+	if err == nil {
+		filter, err = newFilter(c)
+	}
+	if err != nil {
+		log.Printf("Invalid configuration, keeping the current one:\n%v", err)
+		return err
+	}
+
+	leadTime := time.Duration(c.Reminders.LeadTime)
+	signInChanged := signInChanged(r.config, c)
+	kept := make([]bool, len(r.accounts))
+	var running []runningAccount
+	var accounts []services.Account
+	for _, accountConfig := range c.Accounts {
+		i := r.findAccount(accountConfig, kept)
+		if i >= 0 && !(signInChanged && accountConfig.SignsIn()) {
+			kept[i] = true
+			old := r.accounts[i]
+			// The calendars and the lead time of the reminders may have changed
+			old.config = accountConfig
+			old.account.Calendars = toCalendars(accountConfig, leadTime)
+			running = append(running, old)
+			accounts = append(accounts, old.account)
+			continue
+		}
+
+		// Signing in interactively would block the reloads until the user signs in
+		account, subscriber, err := signInAccount(c, accountConfig, r.reloginPrompt, r.opts.deviceLogin, false)
+		if errors.Is(err, auth.ErrReloginRequired) {
+			err = fmt.Errorf("%w; run `%s` first", err, strings.TrimSpace("meeting-reminder login "+accountConfig.Name))
+		}
+		if err != nil {
+			log.Printf("Failed to reload the configuration, keeping the current one: %v", err)
+			return err
+		}
+		running = append(running, runningAccount{config: accountConfig, account: account, subscriber: subscriber})
+		accounts = append(accounts, account)
+	}
+
+	uiInstance := ui.NewUI(c.UI.BrowserPath, c.UI.OutputDir, c.UI.OpenDir)
+	r.mu.Lock()
+	r.uiInstance = uiInstance
+	r.mu.Unlock()
+	r.calendarService.Reload(accounts, newNotifier(c, uiInstance), time.Duration(c.Reminders.Interval), filter)
+
+	if r.manager != nil {
+		for i, old := range r.accounts {
+			if !kept[i] && old.subscriber != nil {
+				r.manager.Unsubscribe(ctx, old.config.Name)
+			}
+		}
+		for _, account := range running {
+			if account.subscriber == nil || r.isRunning(account.subscriber) {
+				continue
+			}
+			if err := r.manager.Subscribe(ctx, account.config.Name, account.subscriber); err != nil {
+				log.Printf("Failed to subscribe to account %q, polling it: %v", account.config.Name, err)
+			}
+		}
+	}
+	if c.Webhook.URL != r.config.Webhook.URL || c.Webhook.ListenAddr != r.config.Webhook.ListenAddr {
+		log.Println("Changes of the webhook settings take effect after a restart")
+	}
+	if c.Metrics.ListenAddr != r.config.Metrics.ListenAddr {
+		log.Println("Changes of metrics.listenAddr take effect after a restart")
+	}
+
+	r.config = c
+	r.accounts = running
+	log.Println("Configuration reloaded")
+	return nil
+}
+
+// findAccount returns the index of the running account with the same connection which is
+// not kept yet, or -1.
+func (r *reloader) findAccount(accountConfig config.Account, kept []bool) int {
+	for i, account := range r.accounts {
+		if !kept[i] && account.config.SameConnection(accountConfig) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isRunning reports whether the subscriber is of a running account, so it is subscribed already.
+func (r *reloader) isRunning(subscriber webhooks.Subscriber) bool {
+	for _, account := range r.accounts {
+		if account.subscriber == subscriber {
+			return true
+		}
+	}
+	return false
+}
+
+// signInChanged reports whether the settings of signing in, which the auth of all accounts
+// is made with, differ.
+func signInChanged(old, c *config.Config) bool {
+	return old.Login.Flow != c.Login.Flow ||
+		old.Login.CallbackPort != c.Login.CallbackPort ||
+		old.Login.CallbackPath != c.Login.CallbackPath ||
+		old.Tokens.Store != c.Tokens.Store ||
+		old.Tokens.Passphrase != c.Tokens.Passphrase ||
+		old.Tokens.KeyFile != c.Tokens.KeyFile
+}
+
+// reloginPrompt shows where to sign in again to the account, when its token can't be refreshed while running.
+func (r *reloader) reloginPrompt(account string) auth.Prompt {
+	return func(url, userCode string) {
+		r.mu.Lock()
+		uiInstance := r.uiInstance
+		r.mu.Unlock()
+		uiInstance.ShowReloginRequired(account, url, userCode)
+	}
+}
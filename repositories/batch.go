@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kajikentaro/meeting-reminder/metrics"
+)
+
+// Maximum number of requests in a JSON batch
+const maxBatchSize = 20
+
+type batchRequest struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type batchResponse struct {
+	ID     string                 `json:"id"`
+	Status int                    `json:"status"`
+	Body   map[string]interface{} `json:"body"`
+}
+
+type batchResult struct {
+	body map[string]interface{}
+	err  error
+}
+
+// batch sends GET requests to the paths, keyed by an arbitrary index, in as
+// few JSON batches as possible. Errors of a single request are reported in
+// its result, while an error of a whole batch is returned.
+// DOC: https://learn.microsoft.com/en-us/graph/json-batching
+func (r *MicrosoftRepository) batch(ctx context.Context, paths map[int]string) (map[int]batchResult, error) {
+	keys := make([]int, 0, len(paths))
+	for key := range paths {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	results := map[int]batchResult{}
+	for start := 0; start < len(keys); start += maxBatchSize {
+		end := min(start+maxBatchSize, len(keys))
+
+		var requests []batchRequest
+		for _, key := range keys[start:end] {
+			requests = append(requests, batchRequest{
+				ID:     strconv.Itoa(key),
+				Method: "GET",
+				URL:    "/" + paths[key],
+			})
+		}
+
+		req, err := r.newRequest(ctx, "POST", "$batch", map[string]interface{}{"requests": requests})
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Responses []batchResponse `json:"responses"`
+		}
+		if err := r.do(req, &result); err != nil {
+			return nil, err
+		}
+
+		for _, resp := range result.Responses {
+			key, err := strconv.Atoi(resp.ID)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected batch response id: %q", resp.ID)
+			}
+			metrics.GraphRequests.WithLabelValues("batched", strconv.Itoa(resp.Status)).Inc()
+			if resp.Status < 200 || resp.Status >= 300 {
+				results[key] = batchResult{err: fmt.Errorf("API request failed with status: %d %s%s", resp.Status, http.StatusText(resp.Status), errorMessage(resp.Body))}
+				continue
+			}
+			results[key] = batchResult{body: resp.Body}
+		}
+		for _, key := range keys[start:end] {
+			if _, ok := results[key]; !ok {
+				results[key] = batchResult{err: fmt.Errorf("no response in batch")}
+			}
+		}
+	}
+	return results, nil
+}
+
+// errorMessage extracts the message of a Graph error response.
+func errorMessage(body map[string]interface{}) string {
+	errorBody, _ := body["error"].(map[string]interface{})
+	message, _ := errorBody["message"].(string)
+	if message == "" {
+		return ""
+	}
+	return ": " + message
+}
+
+// relativePath converts an absolute Graph URL, like @odata.nextLink, to a path relative to BaseURL.
+func (r *MicrosoftRepository) relativePath(link string) (string, error) {
+	// nextLink is returned with the public endpoint even when BaseURL points elsewhere
+	for _, base := range []string{r.BaseURL, graphBaseURL} {
+		if path, ok := strings.CutPrefix(link, base+"/"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected link: %s", link)
+}
@@ -0,0 +1,332 @@
+package repositories
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/kajikentaro/meeting-reminder/utils/ical"
+)
+
+// CalDAVRepository reads calendars from a CalDAV server, like Nextcloud or Fastmail.
+// DOC: https://www.rfc-editor.org/rfc/rfc4791
+type CalDAVRepository struct {
+	// BaseURL is the URL of the server, of the principal of the user, or of its calendar home
+	BaseURL string
+	// Username and Password are used for basic authentication, if set
+	Username string
+	Password string
+	// Token is used for bearer authentication, if set
+	Token string
+	// Owner is the email address of the user, to find the user's response to invitations. Optional.
+	Owner  string
+	Client *http.Client
+
+	mu sync.Mutex
+	// calendars found in the calendar home, nil until discovered
+	calendars []davCalendar
+	// objects are the calendar objects fetched so far, by calendar and object URL
+	objects map[string]map[string]davObject
+}
+
+type davCalendar struct {
+	url  string
+	name string
+}
+
+type davObject struct {
+	etag     string
+	calendar *ical.Calendar
+}
+
+func NewCalDAVRepository(baseURL, owner string) *CalDAVRepository {
+	return &CalDAVRepository{
+		BaseURL: baseURL,
+		Owner:   owner,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		objects: map[string]map[string]davObject{},
+	}
+}
+
+// FetchCalendarViews reads the calendars between start and end, in the same order.
+// Calendar ids are URLs or paths of calendars, or their display names, and an
+// empty id is the first calendar of the user.
+// Only calendar objects whose ETag changed since the last fetch are downloaded.
+func (r *CalDAVRepository) FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	views := make([]models.CalendarView, len(calendarIDs))
+	for i, id := range calendarIDs {
+		calendarURL, err := r.resolveCalendar(ctx, id)
+		if err != nil {
+			views[i] = models.CalendarView{Err: err}
+			continue
+		}
+		objects, err := r.sync(ctx, calendarURL, start, end)
+		if err != nil {
+			views[i] = models.CalendarView{Err: err}
+			continue
+		}
+		for _, object := range objects {
+			views[i].Events = append(views[i].Events, object.calendar.Events(start, end, r.Owner)...)
+		}
+	}
+	return views, nil
+}
+
+// resolveCalendar returns the URL of the calendar with the id.
+func (r *CalDAVRepository) resolveCalendar(ctx context.Context, id string) (string, error) {
+	if strings.HasPrefix(id, "http://") || strings.HasPrefix(id, "https://") || strings.HasPrefix(id, "/") {
+		return r.resolve(id)
+	}
+
+	if r.calendars == nil {
+		calendars, err := r.discover(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to discover calendars: %w", err)
+		}
+		r.calendars = calendars
+	}
+	for _, c := range r.calendars {
+		if id == "" || c.name == id || path.Base(strings.TrimSuffix(c.url, "/")) == id {
+			return c.url, nil
+		}
+	}
+	return "", fmt.Errorf("calendar not found: %q", id)
+}
+
+// discover finds the calendars of the user in the calendar home.
+func (r *CalDAVRepository) discover(ctx context.Context) ([]davCalendar, error) {
+	// The principal is found from the server URL, and the base URL is the principal if it isn't
+	principal := r.BaseURL
+	responses, err := r.propfind(ctx, r.BaseURL, "0", `<d:current-user-principal/>`)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range responses {
+		if p := resp.prop(); p.CurrentUserPrincipal != nil && p.CurrentUserPrincipal.Href != "" {
+			if principal, err = r.resolve(p.CurrentUserPrincipal.Href); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The base URL is the calendar home if the principal has none
+	home := r.BaseURL
+	responses, err = r.propfind(ctx, principal, "0", `<c:calendar-home-set/>`)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range responses {
+		if p := resp.prop(); p.CalendarHomeSet != nil && p.CalendarHomeSet.Href != "" {
+			if home, err = r.resolve(p.CalendarHomeSet.Href); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	responses, err = r.propfind(ctx, home, "1", `<d:resourcetype/><d:displayname/>`)
+	if err != nil {
+		return nil, err
+	}
+	var calendars []davCalendar
+	for _, resp := range responses {
+		p := resp.prop()
+		if p.ResourceType.Calendar == nil {
+			continue
+		}
+		calendarURL, err := r.resolve(resp.Href)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, davCalendar{url: calendarURL, name: p.DisplayName})
+	}
+	if len(calendars) == 0 {
+		return nil, fmt.Errorf("no calendar found in %s", home)
+	}
+	return calendars, nil
+}
+
+// sync returns the objects of the calendar with events between start and end.
+// The ETags of the objects are listed first, and only new or changed objects are downloaded.
+func (r *CalDAVRepository) sync(ctx context.Context, calendarURL string, start, end time.Time) ([]davObject, error) {
+	timeRange := fmt.Sprintf(`<c:time-range start="%s" end="%s"/>`, start.UTC().Format(davTimeLayout), end.UTC().Format(davTimeLayout))
+	responses, err := r.report(ctx, calendarURL, "1", `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/></d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT">`+timeRange+`</c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := r.objects[calendarURL]
+	current := map[string]davObject{}
+	var changed []string
+	for _, resp := range responses {
+		objectURL, err := r.resolve(resp.Href)
+		if err != nil {
+			return nil, err
+		}
+		if objectURL == calendarURL {
+			continue
+		}
+		etag := resp.prop().ETag
+		if object, ok := cached[objectURL]; ok && etag != "" && object.etag == etag {
+			current[objectURL] = object
+			continue
+		}
+		changed = append(changed, resp.Href)
+	}
+
+	if len(changed) > 0 {
+		var hrefs strings.Builder
+		for _, href := range changed {
+			hrefs.WriteString("<d:href>")
+			xml.EscapeText(&hrefs, []byte(href))
+			hrefs.WriteString("</d:href>")
+		}
+		responses, err := r.report(ctx, calendarURL, "", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+  <d:prop><d:getetag/><c:calendar-data/></d:prop>
+  `+hrefs.String()+`
+</c:calendar-multiget>`)
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range responses {
+			p := resp.prop()
+			if p.CalendarData == "" {
+				continue
+			}
+			objectURL, err := r.resolve(resp.Href)
+			if err != nil {
+				return nil, err
+			}
+			calendar, err := parseICS(strings.NewReader(p.CalendarData))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", resp.Href, err)
+			}
+			current[objectURL] = davObject{etag: p.ETag, calendar: calendar}
+		}
+	}
+
+	r.objects[calendarURL] = current
+	urls := make([]string, 0, len(current))
+	for objectURL := range current {
+		urls = append(urls, objectURL)
+	}
+	sort.Strings(urls)
+	objects := make([]davObject, 0, len(urls))
+	for _, objectURL := range urls {
+		objects = append(objects, current[objectURL])
+	}
+	return objects, nil
+}
+
+// Layout of the time-range filter
+const davTimeLayout = "20060102T150405Z"
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	CurrentUserPrincipal *davHref `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      *davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	ResourceType         struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	DisplayName  string `xml:"DAV: displayname"`
+	ETag         string `xml:"DAV: getetag"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+// prop returns the properties of the response which were found.
+func (resp davResponse) prop() davProp {
+	for _, propstat := range resp.Propstats {
+		if strings.Contains(propstat.Status, " 200 ") {
+			return propstat.Prop
+		}
+	}
+	return davProp{}
+}
+
+func (r *CalDAVRepository) propfind(ctx context.Context, target, depth, props string) ([]davResponse, error) {
+	return r.do(ctx, "PROPFIND", target, depth, `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop>`+props+`</d:prop></d:propfind>`)
+}
+
+func (r *CalDAVRepository) report(ctx context.Context, target, depth, body string) ([]davResponse, error) {
+	return r.do(ctx, "REPORT", target, depth, body)
+}
+
+// do sends a WebDAV request and decodes its multistatus response.
+func (r *CalDAVRepository) do(ctx context.Context, method, target, depth, body string) ([]davResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, strings.NewReader(`<?xml version="1.0" encoding="utf-8"?>`+body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `application/xml; charset="utf-8"`)
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	switch {
+	case r.Token != "":
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	case r.Username != "":
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("%s %s failed with status: %s", method, target, resp.Status)
+	}
+
+	var multistatus davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("invalid response of %s %s: %w", method, target, err)
+	}
+	return multistatus.Responses, nil
+}
+
+// resolve returns the absolute URL of an href, which is usually a path on the server.
+func (r *CalDAVRepository) resolve(href string) (string, error) {
+	base, err := url.Parse(r.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid CalDAV URL: %w", err)
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("invalid href %q: %w", href, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// calDAVServer is a minimal CalDAV server with a single user.
+type calDAVServer struct {
+	t  *testing.T
+	mu sync.Mutex
+	// objects of /dav/calendars/alice/work/ by name
+	objects map[string]calDAVObject
+	// multigets are the hrefs requested by each calendar-multiget
+	multigets [][]string
+}
+
+type calDAVObject struct {
+	etag string
+	data string
+}
+
+func (s *calDAVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, password, ok := r.BasicAuth(); !ok || user != "alice" || password != "secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	require.NoError(s.t, err)
+
+	var responses []string
+	switch {
+	case r.Method == "PROPFIND" && r.URL.Path == "/dav/":
+		assert.Equal(s.t, "0", r.Header.Get("Depth"))
+		responses = append(responses, davTestResponse("/dav/", `<d:current-user-principal><d:href>/dav/principals/alice/</d:href></d:current-user-principal>`))
+	case r.Method == "PROPFIND" && r.URL.Path == "/dav/principals/alice/":
+		assert.Contains(s.t, string(body), "calendar-home-set")
+		responses = append(responses, davTestResponse(r.URL.Path, `<c:calendar-home-set><d:href>/dav/calendars/alice/</d:href></c:calendar-home-set>`))
+	case r.Method == "PROPFIND" && r.URL.Path == "/dav/calendars/alice/":
+		assert.Equal(s.t, "1", r.Header.Get("Depth"))
+		responses = append(responses,
+			davTestResponse("/dav/calendars/alice/", `<d:resourcetype><d:collection/></d:resourcetype>`),
+			davTestResponse("/dav/calendars/alice/inbox/", `<d:resourcetype><d:collection/><c:schedule-inbox/></d:resourcetype>`),
+			davTestResponse("/dav/calendars/alice/work/", `<d:resourcetype><d:collection/><c:calendar/></d:resourcetype><d:displayname>Work</d:displayname>`),
+		)
+	case r.Method == "REPORT" && r.URL.Path == "/dav/calendars/alice/work/":
+		var query struct {
+			XMLName xml.Name
+			Hrefs   []string `xml:"DAV: href"`
+			Filter  struct {
+				Inner string `xml:",innerxml"`
+			} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+		}
+		require.NoError(s.t, xml.Unmarshal(body, &query))
+
+		switch query.XMLName.Local {
+		case "calendar-query":
+			assert.Contains(s.t, query.Filter.Inner, `start="20330303T000000Z" end="20330303T235959Z"`)
+			for name, object := range s.objects {
+				responses = append(responses, davTestResponse("/dav/calendars/alice/work/"+name, `<d:getetag>`+object.etag+`</d:getetag>`))
+			}
+		case "calendar-multiget":
+			s.multigets = append(s.multigets, query.Hrefs)
+			for _, href := range query.Hrefs {
+				object := s.objects[strings.TrimPrefix(href, "/dav/calendars/alice/work/")]
+				var data strings.Builder
+				xml.EscapeText(&data, []byte(object.data))
+				responses = append(responses, davTestResponse(href, `<d:getetag>`+object.etag+`</d:getetag><c:calendar-data>`+data.String()+`</c:calendar-data>`))
+			}
+		}
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">%s</d:multistatus>`, strings.Join(responses, ""))
+}
+
+func davTestResponse(href, props string) string {
+	return `<d:response><d:href>` + href + `</d:href><d:propstat><d:prop>` + props + `</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`
+}
+
+func calDAVEvent(uid, summary string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:" + uid + "\r\nSUMMARY:" + summary +
+		"\r\nDTSTART:20330303T090000Z\r\nDTEND:20330303T093000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+func TestCalDAVFetchCalendarViews(t *testing.T) {
+	dav := &calDAVServer{t: t, objects: map[string]calDAVObject{
+		"standup.ics": {etag: `"1"`, data: calDAVEvent("standup", "Standup")},
+		"review.ics":  {etag: `"1"`, data: calDAVEvent("review", "Review")},
+	}}
+	server := httptest.NewServer(dav)
+	t.Cleanup(server.Close)
+
+	repo := NewCalDAVRepository(server.URL+"/dav/", "alice@example.com")
+	repo.Username = "alice"
+	repo.Password = "secret"
+	start := time.Date(2033, 3, 3, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2033, 3, 3, 23, 59, 59, 0, time.UTC)
+
+	titles := func(ids ...string) [][]string {
+		views, err := repo.FetchCalendarViews(context.Background(), ids, start, end)
+		require.NoError(t, err)
+		var result [][]string
+		for _, view := range views {
+			require.NoError(t, view.Err)
+			var titles []string
+			for _, event := range view.Events {
+				titles = append(titles, event.Title)
+			}
+			result = append(result, titles)
+		}
+		return result
+	}
+
+	// The calendar is found by its display name, path or as the default calendar
+	assert.Equal(t, [][]string{{"Review", "Standup"}, {"Review", "Standup"}}, titles("Work", ""))
+	assert.Equal(t, [][]string{{"Review", "Standup"}}, titles("/dav/calendars/alice/work/"))
+	assert.Len(t, dav.multigets, 1)
+
+	// Only the changed object is downloaded again
+	dav.mu.Lock()
+	dav.objects["review.ics"] = calDAVObject{etag: `"2"`, data: calDAVEvent("review", "Review (moved)")}
+	delete(dav.objects, "standup.ics")
+	dav.mu.Unlock()
+	assert.Equal(t, [][]string{{"Review (moved)"}}, titles("Work"))
+	assert.Equal(t, []string{"/dav/calendars/alice/work/review.ics"}, dav.multigets[1])
+
+	views, err := repo.FetchCalendarViews(context.Background(), []string{"Personal"}, start, end)
+	require.NoError(t, err)
+	assert.EqualError(t, views[0].Err, `calendar not found: "Personal"`)
+}
+
+func TestCalDAVUnauthorized(t *testing.T) {
+	server := httptest.NewServer(&calDAVServer{t: t})
+	t.Cleanup(server.Close)
+
+	repo := NewCalDAVRepository(server.URL+"/dav/", "")
+	repo.Token = "token"
+	views, err := repo.FetchCalendarViews(context.Background(), []string{""}, time.Now(), time.Now())
+	require.NoError(t, err)
+	assert.ErrorContains(t, views[0].Err, "failed with status: 401 Unauthorized")
+}
@@ -0,0 +1,361 @@
+package repositories
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"golang.org/x/oauth2"
+)
+
+// EWSRepository reads calendars of on-premises Exchange with Exchange Web Services.
+// DOC: https://learn.microsoft.com/en-us/exchange/client-developer/web-service-reference/ews-reference-for-exchange
+type EWSRepository struct {
+	// URL is the EWS endpoint, like https://mail.example.com/EWS/Exchange.asmx
+	URL string
+	// Client sends the requests. Its transport signs in with NTLM if the server requires it.
+	Client *http.Client
+	// Username and Password are used for basic authentication, if set
+	Username string
+	Password string
+	// TokenSource gives OAuth tokens for bearer authentication, if set
+	TokenSource oauth2.TokenSource
+}
+
+func NewEWSRepository(url string) *EWSRepository {
+	return &EWSRepository{URL: url, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Layout of times in EWS requests
+const ewsTimeLayout = "2006-01-02T15:04:05Z"
+
+var ewsRequest = template.Must(template.New("ews").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"
+  xmlns:t="http://schemas.microsoft.com/exchange/services/2006/types"
+  xmlns:m="http://schemas.microsoft.com/exchange/services/2006/messages">
+  <soap:Header><t:RequestServerVersion Version="Exchange2013"/></soap:Header>
+  <soap:Body>
+{{- if .ItemIDs}}
+    <m:GetItem>
+      <m:ItemShape>
+        <t:BaseShape>IdOnly</t:BaseShape>
+        <t:AdditionalProperties>
+          <t:FieldURI FieldURI="calendar:RequiredAttendees"/>
+          <t:FieldURI FieldURI="calendar:OptionalAttendees"/>
+          <t:FieldURI FieldURI="calendar:Resources"/>
+          <t:FieldURI FieldURI="calendar:JoinOnlineMeetingUrl"/>
+        </t:AdditionalProperties>
+      </m:ItemShape>
+      <m:ItemIds>
+{{- range .ItemIDs}}
+        <t:ItemId Id="{{.ID | xml}}" ChangeKey="{{.ChangeKey | xml}}"/>
+{{- end}}
+      </m:ItemIds>
+    </m:GetItem>
+{{- else}}
+    <m:FindItem Traversal="Shallow">
+      <m:ItemShape>
+        <t:BaseShape>IdOnly</t:BaseShape>
+        <t:AdditionalProperties>
+          <t:FieldURI FieldURI="item:Subject"/>
+          <t:FieldURI FieldURI="calendar:Start"/>
+          <t:FieldURI FieldURI="calendar:End"/>
+          <t:FieldURI FieldURI="calendar:IsAllDayEvent"/>
+          <t:FieldURI FieldURI="calendar:Location"/>
+          <t:FieldURI FieldURI="calendar:Organizer"/>
+          <t:FieldURI FieldURI="calendar:MyResponseType"/>
+          <t:FieldURI FieldURI="calendar:UID"/>
+          <t:FieldURI FieldURI="calendar:IsMeeting"/>
+          <t:FieldURI FieldURI="item:ReminderIsSet"/>
+          <t:FieldURI FieldURI="item:ReminderMinutesBeforeStart"/>
+        </t:AdditionalProperties>
+      </m:ItemShape>
+      <m:CalendarView StartDate="{{.Start}}" EndDate="{{.End}}"/>
+      <m:ParentFolderIds>
+{{- if .FolderID}}
+        <t:FolderId Id="{{.FolderID | xml}}"/>
+{{- else}}
+        <t:DistinguishedFolderId Id="calendar">
+{{- if .Mailbox}}<t:Mailbox><t:EmailAddress>{{.Mailbox | xml}}</t:EmailAddress></t:Mailbox>{{end -}}
+        </t:DistinguishedFolderId>
+{{- end}}
+      </m:ParentFolderIds>
+    </m:FindItem>
+{{- end}}
+  </soap:Body>
+</soap:Envelope>
+`))
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+type ewsRequestParams struct {
+	Start, End string
+	// FolderID of the calendar, or Mailbox whose default calendar is read
+	FolderID string
+	Mailbox  string
+	ItemIDs  []ewsItemID
+}
+
+type ewsEnvelope struct {
+	Body struct {
+		Fault *struct {
+			String string `xml:"faultstring"`
+		} `xml:"Fault"`
+		FindItem []ewsResponseMessage `xml:"FindItemResponse>ResponseMessages>FindItemResponseMessage"`
+		GetItem  []ewsResponseMessage `xml:"GetItemResponse>ResponseMessages>GetItemResponseMessage"`
+	} `xml:"Body"`
+}
+
+type ewsResponseMessage struct {
+	ResponseClass string            `xml:"ResponseClass,attr"`
+	MessageText   string            `xml:"MessageText"`
+	ResponseCode  string            `xml:"ResponseCode"`
+	FoundItems    []ewsCalendarItem `xml:"RootFolder>Items>CalendarItem"`
+	Items         []ewsCalendarItem `xml:"Items>CalendarItem"`
+}
+
+type ewsItemID struct {
+	ID        string `xml:"Id,attr"`
+	ChangeKey string `xml:"ChangeKey,attr"`
+}
+
+// ewsCalendarItem is a CalendarItem element.
+// DOC: https://learn.microsoft.com/en-us/exchange/client-developer/web-service-reference/calendaritem
+type ewsCalendarItem struct {
+	ItemID                     ewsItemID `xml:"ItemId"`
+	Subject                    string    `xml:"Subject"`
+	Start                      string    `xml:"Start"`
+	End                        string    `xml:"End"`
+	IsAllDayEvent              bool      `xml:"IsAllDayEvent"`
+	Location                   string    `xml:"Location"`
+	UID                        string    `xml:"UID"`
+	MyResponseType             string    `xml:"MyResponseType"`
+	IsMeeting                  bool      `xml:"IsMeeting"`
+	ReminderIsSet              bool      `xml:"ReminderIsSet"`
+	ReminderMinutesBeforeStart int       `xml:"ReminderMinutesBeforeStart"`
+	Organizer                  struct {
+		Mailbox ewsMailbox `xml:"Mailbox"`
+	} `xml:"Organizer"`
+
+	RequiredAttendees    []ewsAttendee `xml:"RequiredAttendees>Attendee"`
+	OptionalAttendees    []ewsAttendee `xml:"OptionalAttendees>Attendee"`
+	Resources            []ewsAttendee `xml:"Resources>Attendee"`
+	JoinOnlineMeetingURL string        `xml:"JoinOnlineMeetingUrl"`
+}
+
+type ewsMailbox struct {
+	Name         string `xml:"Name"`
+	EmailAddress string `xml:"EmailAddress"`
+}
+
+type ewsAttendee struct {
+	Mailbox      ewsMailbox `xml:"Mailbox"`
+	ResponseType string     `xml:"ResponseType"`
+}
+
+// FetchCalendarViews returns the events of the calendars between start and end, in the same order.
+// Calendar ids are folder ids, or email addresses of mailboxes whose default calendar
+// is shared with the user, and an empty id is the default calendar of the user.
+func (r *EWSRepository) FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error) {
+	views := make([]models.CalendarView, len(calendarIDs))
+	for i, id := range calendarIDs {
+		params := ewsRequestParams{Start: start.UTC().Format(ewsTimeLayout), End: end.UTC().Format(ewsTimeLayout)}
+		if strings.Contains(id, "@") {
+			params.Mailbox = id
+		} else {
+			params.FolderID = id
+		}
+		events, err := r.findItems(ctx, params)
+		views[i] = models.CalendarView{Events: events, Err: err}
+	}
+	return views, nil
+}
+
+// findItems fetches the occurrences in the calendar view, and the attendees of the meetings among them.
+func (r *EWSRepository) findItems(ctx context.Context, params ewsRequestParams) ([]models.Event, error) {
+	// DOC: https://learn.microsoft.com/en-us/exchange/client-developer/web-service-reference/finditem-operation-calendar-item
+	envelope, err := r.call(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Body.FindItem) != 1 {
+		return nil, fmt.Errorf("unexpected response format")
+	}
+	message := envelope.Body.FindItem[0]
+	if err := message.err(); err != nil {
+		return nil, err
+	}
+
+	// Attendees can't be returned by FindItem
+	details := map[string]ewsCalendarItem{}
+	var meetings []ewsItemID
+	for _, item := range message.FoundItems {
+		if item.IsMeeting {
+			meetings = append(meetings, item.ItemID)
+		}
+	}
+	if len(meetings) > 0 {
+		// DOC: https://learn.microsoft.com/en-us/exchange/client-developer/web-service-reference/getitem-operation-calendar-item
+		envelope, err := r.call(ctx, ewsRequestParams{ItemIDs: meetings})
+		if err != nil {
+			log.Printf("Failed to get attendees of meetings: %v", err)
+		} else {
+			for _, message := range envelope.Body.GetItem {
+				for _, item := range message.Items {
+					details[item.ItemID.ID] = item
+				}
+			}
+		}
+	}
+
+	var events []models.Event
+	for _, item := range message.FoundItems {
+		if detail, ok := details[item.ItemID.ID]; ok {
+			item.RequiredAttendees = detail.RequiredAttendees
+			item.OptionalAttendees = detail.OptionalAttendees
+			item.Resources = detail.Resources
+			item.JoinOnlineMeetingURL = detail.JoinOnlineMeetingURL
+		}
+		event, err := parseEWSCalendarItem(item)
+		if err != nil {
+			log.Printf("Invalid event format: %v: %+v", err, item)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (m ewsResponseMessage) err() error {
+	if m.ResponseClass == "Error" {
+		return fmt.Errorf("EWS request failed: %s: %s", m.ResponseCode, m.MessageText)
+	}
+	return nil
+}
+
+// call sends a SOAP request.
+func (r *EWSRepository) call(ctx context.Context, params ewsRequestParams) (*ewsEnvelope, error) {
+	var body bytes.Buffer
+	if err := ewsRequest.Execute(&body, params); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", r.URL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	switch {
+	case r.TokenSource != nil:
+		token, err := r.TokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", err)
+		}
+		token.SetAuthHeader(req)
+	case r.Username != "":
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Faults are returned with 500
+	var envelope ewsEnvelope
+	decodeErr := xml.NewDecoder(resp.Body).Decode(&envelope)
+	if decodeErr == nil && envelope.Body.Fault != nil {
+		return nil, fmt.Errorf("EWS request failed: %s", envelope.Body.Fault.String)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("EWS request failed with status: %s", resp.Status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("invalid EWS response: %w", decodeErr)
+	}
+	return &envelope, nil
+}
+
+func parseEWSCalendarItem(item ewsCalendarItem) (models.Event, error) {
+	start, err := time.Parse(time.RFC3339, item.Start)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("invalid 'Start': %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, item.End)
+	if err != nil {
+		end = start
+	}
+
+	organizer := item.Organizer.Mailbox.Name
+	if organizer == "" {
+		organizer = item.Organizer.Mailbox.EmailAddress
+	}
+	event := models.Event{
+		UID:         item.UID,
+		Title:       item.Subject,
+		Start:       start,
+		End:         end,
+		AllDay:      item.IsAllDayEvent,
+		Location:    item.Location,
+		JoinURL:     item.JoinOnlineMeetingURL,
+		Organizer:   organizer,
+		IsOrganizer: item.MyResponseType == "Organizer",
+		Response:    parseEWSResponse(item.MyResponseType),
+	}
+	if !item.IsMeeting {
+		// Appointments have no attendees to respond to
+		event.Response = models.ResponseNone
+	}
+	if item.ReminderIsSet {
+		event.Alarms = []time.Duration{time.Duration(item.ReminderMinutesBeforeStart) * time.Minute}
+	}
+
+	for _, group := range []struct {
+		attendees    []ewsAttendee
+		attendeeType models.AttendeeType
+	}{
+		{item.RequiredAttendees, models.AttendeeRequired},
+		{item.OptionalAttendees, models.AttendeeOptional},
+		{item.Resources, models.AttendeeResource},
+	} {
+		for _, a := range group.attendees {
+			event.Attendees = append(event.Attendees, models.Attendee{
+				Name:     a.Mailbox.Name,
+				Email:    a.Mailbox.EmailAddress,
+				Type:     group.attendeeType,
+				Response: parseEWSResponse(a.ResponseType),
+			})
+		}
+	}
+	return event, nil
+}
+
+// parseEWSResponse converts a ResponseType of EWS.
+// DOC: https://learn.microsoft.com/en-us/exchange/client-developer/web-service-reference/responsetype
+func parseEWSResponse(response string) models.ResponseStatus {
+	switch response {
+	case "Organizer":
+		return models.ResponseOrganizer
+	case "Accept":
+		return models.ResponseAccepted
+	case "Tentative":
+		return models.ResponseTentative
+	case "Decline":
+		return models.ResponseDeclined
+	case "NoResponseReceived":
+		return models.ResponseNotResponded
+	default:
+		return models.ResponseNone
+	}
+}
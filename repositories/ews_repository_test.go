@@ -0,0 +1,123 @@
+package repositories
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// ewsServer serves recorded responses of Exchange 2016 to the requests.
+func ewsServer(t *testing.T, handle func(request string) string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/EWS/Exchange.asmx", r.URL.Path)
+		assert.Contains(t, r.Header.Get("Content-Type"), "text/xml")
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		name := handle(string(body))
+		if name == "fault.xml" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		data, err := os.ReadFile("testdata/ews/" + name)
+		require.NoError(t, err)
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEWSFetchCalendarViews(t *testing.T) {
+	var requests []string
+	server := ewsServer(t, func(request string) string {
+		requests = append(requests, request)
+		if strings.Contains(request, "<m:GetItem>") {
+			return "getitem.xml"
+		}
+		if strings.Contains(request, "missing") {
+			return "error.xml"
+		}
+		return "finditem.xml"
+	})
+
+	repo := NewEWSRepository(server.URL + "/EWS/Exchange.asmx")
+	repo.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	start := time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC)
+	views, err := repo.FetchCalendarViews(context.Background(), []string{"", "missing", "shared@example.com"}, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, views, 3)
+
+	// Default calendar
+	require.Contains(t, requests[0], `<m:CalendarView StartDate="2025-06-06T00:00:00Z" EndDate="2025-06-07T00:00:00Z"/>`)
+	assert.Contains(t, requests[0], `<t:DistinguishedFolderId Id="calendar"></t:DistinguishedFolderId>`)
+	assert.Contains(t, requests[1], `<t:ItemId Id="AAMkADk1Standup" ChangeKey="DwAAABYAAAA1"/>`)
+	assert.NotContains(t, requests[1], "AAMkADk1Focus", "attendees are fetched only for meetings")
+	require.NoError(t, views[0].Err)
+	assert.Equal(t, []models.Event{
+		{
+			UID:       "040000008200E00074C5B7101A82E0080000000010C0D8A4",
+			Title:     "Standup",
+			Start:     start.Add(time.Hour),
+			End:       start.Add(time.Hour + 15*time.Minute),
+			Location:  "Room 1",
+			JoinURL:   "https://meet.example.com/standup",
+			Organizer: "Bob",
+			Response:  models.ResponseNotResponded,
+			Attendees: []models.Attendee{
+				{Name: "Alice", Email: "alice@example.com", Type: models.AttendeeRequired, Response: models.ResponseNone},
+				{Name: "Carol", Email: "carol@example.com", Type: models.AttendeeRequired, Response: models.ResponseAccepted},
+				{Name: "Dave", Email: "dave@example.com", Type: models.AttendeeOptional, Response: models.ResponseTentative},
+				{Name: "Room 1", Email: "room1@example.com", Type: models.AttendeeResource, Response: models.ResponseAccepted},
+			},
+			Alarms: []time.Duration{15 * time.Minute},
+		},
+		{
+			UID:         "040000008200E00074C5B7101A82E0080000000020C0D8A4",
+			Title:       "Focus time",
+			Start:       start.Add(3 * time.Hour),
+			End:         start.Add(5 * time.Hour),
+			Organizer:   "Alice",
+			IsOrganizer: true,
+			Response:    models.ResponseNone,
+		},
+	}, views[0].Events)
+
+	// Folder which doesn't exist
+	assert.Contains(t, requests[2], `<t:FolderId Id="missing"/>`)
+	assert.ErrorContains(t, views[1].Err, "ErrorItemNotFound")
+
+	// Calendar of a shared mailbox
+	assert.Contains(t, requests[3], `<t:Mailbox><t:EmailAddress>shared@example.com</t:EmailAddress></t:Mailbox>`)
+	assert.NoError(t, views[2].Err)
+}
+
+func TestEWSBasicAuthAndFault(t *testing.T) {
+	server := ewsServer(t, func(string) string { return "fault.xml" })
+	var username, password string
+	repo := NewEWSRepository(server.URL + "/EWS/Exchange.asmx")
+	repo.Username, repo.Password = `EXAMPLE\alice`, "secret"
+	repo.Client.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		username, password, _ = r.BasicAuth()
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	views, err := repo.FetchCalendarViews(context.Background(), []string{""}, time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.ErrorContains(t, views[0].Err, "The request failed schema validation.")
+	assert.Equal(t, `EXAMPLE\alice`, username)
+	assert.Equal(t, "secret", password)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,348 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"golang.org/x/oauth2"
+)
+
+const googleBaseURL = "https://www.googleapis.com/calendar/v3"
+
+// GoogleRepository reads calendars of a Google account with the Google Calendar API.
+// DOC: https://developers.google.com/calendar/api/v3/reference/events/list
+type GoogleRepository struct {
+	// Auth gives the access tokens, like a signed-in *auth.Auth
+	Auth oauth2.TokenSource
+	// BaseURL is the Calendar API endpoint, including the version
+	BaseURL string
+	Client  *http.Client
+
+	mu sync.Mutex
+	// syncs are the events synchronized so far, by calendar id
+	syncs map[string]*googleSync
+}
+
+// googleSync is the state of the incremental synchronization of a calendar.
+type googleSync struct {
+	// Events are synchronized between start and end
+	start, end time.Time
+	token      string
+	// events by event id
+	events map[string]googleEvent
+	// defaultReminders of the calendar, which apply to events using the default
+	defaultReminders []googleReminder
+}
+
+// errSyncTokenExpired is returned when the sync token is no longer valid,
+// and a full synchronization is needed.
+var errSyncTokenExpired = errors.New("sync token expired")
+
+type googleEventList struct {
+	Items            []googleEvent    `json:"items"`
+	DefaultReminders []googleReminder `json:"defaultReminders"`
+	NextPageToken    string           `json:"nextPageToken"`
+	NextSyncToken    string           `json:"nextSyncToken"`
+}
+
+// googleEvent is an event resource.
+// DOC: https://developers.google.com/calendar/api/v3/reference/events
+type googleEvent struct {
+	ID          string           `json:"id"`
+	Status      string           `json:"status"`
+	Summary     string           `json:"summary"`
+	Location    string           `json:"location"`
+	ICalUID     string           `json:"iCalUID"`
+	Start       googleTime       `json:"start"`
+	End         googleTime       `json:"end"`
+	Organizer   googlePerson     `json:"organizer"`
+	Attendees   []googlePerson   `json:"attendees"`
+	HangoutLink string           `json:"hangoutLink"`
+	Reminders   *googleReminders `json:"reminders"`
+
+	ConferenceData struct {
+		EntryPoints []struct {
+			EntryPointType string `json:"entryPointType"`
+			URI            string `json:"uri"`
+		} `json:"entryPoints"`
+	} `json:"conferenceData"`
+}
+
+type googleTime struct {
+	// Date is set for all-day events, and DateTime for the others
+	Date     string `json:"date"`
+	DateTime string `json:"dateTime"`
+}
+
+type googlePerson struct {
+	Email          string `json:"email"`
+	DisplayName    string `json:"displayName"`
+	Self           bool   `json:"self"`
+	Organizer      bool   `json:"organizer"`
+	Optional       bool   `json:"optional"`
+	Resource       bool   `json:"resource"`
+	ResponseStatus string `json:"responseStatus"`
+}
+
+type googleReminders struct {
+	UseDefault bool             `json:"useDefault"`
+	Overrides  []googleReminder `json:"overrides"`
+}
+
+type googleReminder struct {
+	Method  string `json:"method"`
+	Minutes int    `json:"minutes"`
+}
+
+func NewGoogleRepository(auth oauth2.TokenSource) *GoogleRepository {
+	return &GoogleRepository{
+		Auth:    auth,
+		BaseURL: googleBaseURL,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		syncs:   map[string]*googleSync{},
+	}
+}
+
+// FetchCalendarViews returns the events of the calendars between start and end, in the same order.
+// Calendar ids are Google calendar ids, and an empty id is the primary calendar.
+// After the first fetch of a range, only the changes are fetched with the sync token.
+func (r *GoogleRepository) FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	views := make([]models.CalendarView, len(calendarIDs))
+	for i, id := range calendarIDs {
+		if id == "" {
+			id = "primary"
+		}
+		s, err := r.sync(ctx, id, start, end)
+		if err != nil {
+			views[i] = models.CalendarView{Err: err}
+			continue
+		}
+		views[i] = models.CalendarView{Events: s.eventsBetween(start, end)}
+	}
+	return views, nil
+}
+
+// sync brings the events of the calendar up to date.
+func (r *GoogleRepository) sync(ctx context.Context, calendarID string, start, end time.Time) (*googleSync, error) {
+	s := r.syncs[calendarID]
+	if s != nil && s.token != "" && s.start.Equal(start) && s.end.Equal(end) {
+		err := r.list(ctx, calendarID, s, url.Values{"syncToken": {s.token}})
+		if err == nil {
+			return s, nil
+		}
+		if !errors.Is(err, errSyncTokenExpired) {
+			return nil, err
+		}
+	}
+
+	// The range is only given in the full synchronization, as it can't be
+	// combined with a sync token. Changes are filtered by the range afterwards.
+	s = &googleSync{start: start, end: end, events: map[string]googleEvent{}}
+	query := url.Values{}
+	query.Set("timeMin", start.Format(time.RFC3339))
+	query.Set("timeMax", end.Format(time.RFC3339))
+	if err := r.list(ctx, calendarID, s, query); err != nil {
+		delete(r.syncs, calendarID)
+		return nil, err
+	}
+	r.syncs[calendarID] = s
+	return s, nil
+}
+
+// list fetches all pages of events.list and applies them to s.
+func (r *GoogleRepository) list(ctx context.Context, calendarID string, s *googleSync, query url.Values) error {
+	// Recurring events are expanded into their occurrences
+	query.Set("singleEvents", "true")
+	query.Set("maxResults", "250")
+
+	pageToken := ""
+	for {
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		var list googleEventList
+		if err := r.get(ctx, "calendars/"+url.PathEscape(calendarID)+"/events?"+query.Encode(), &list); err != nil {
+			return err
+		}
+
+		for _, event := range list.Items {
+			if event.Status == "cancelled" {
+				delete(s.events, event.ID)
+				continue
+			}
+			s.events[event.ID] = event
+		}
+		if list.DefaultReminders != nil {
+			s.defaultReminders = list.DefaultReminders
+		}
+
+		if list.NextPageToken == "" {
+			s.token = list.NextSyncToken
+			return nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+func (r *GoogleRepository) get(ctx context.Context, path string, result interface{}) error {
+	token, err := r.Auth.Token()
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", r.BaseURL+"/"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return errSyncTokenExpired
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("API request failed with status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// eventsBetween returns the synchronized events overlapping [start, end), sorted by start.
+func (s *googleSync) eventsBetween(start, end time.Time) []models.Event {
+	var events []models.Event
+	for _, e := range s.events {
+		event, err := parseGoogleEvent(e, s.defaultReminders)
+		if err != nil {
+			log.Printf("Invalid event format: %v: %+v", err, e)
+			continue
+		}
+		if !event.Start.Before(end) || !event.End.After(start) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Start.Equal(events[j].Start) {
+			return events[i].Start.Before(events[j].Start)
+		}
+		return events[i].UID < events[j].UID
+	})
+	return events
+}
+
+// parseGoogleEvent converts an event resource of the Calendar API.
+func parseGoogleEvent(e googleEvent, defaultReminders []googleReminder) (models.Event, error) {
+	start, allDay, err := parseGoogleTime(e.Start)
+	if err != nil {
+		return models.Event{}, fmt.Errorf("invalid 'start': %w", err)
+	}
+	end, _, err := parseGoogleTime(e.End)
+	if err != nil {
+		end = start
+	}
+
+	event := models.Event{
+		UID:         e.ICalUID,
+		Title:       e.Summary,
+		Start:       start,
+		End:         end,
+		AllDay:      allDay,
+		Location:    e.Location,
+		JoinURL:     googleJoinURL(e),
+		Organizer:   e.Organizer.DisplayName,
+		IsOrganizer: e.Organizer.Self,
+	}
+	if event.Organizer == "" {
+		event.Organizer = e.Organizer.Email
+	}
+	if event.IsOrganizer {
+		event.Response = models.ResponseOrganizer
+	}
+
+	for _, a := range e.Attendees {
+		attendee := models.Attendee{
+			Name:     a.DisplayName,
+			Email:    a.Email,
+			Type:     models.AttendeeRequired,
+			Response: parseGoogleResponse(a.ResponseStatus),
+		}
+		switch {
+		case a.Resource:
+			attendee.Type = models.AttendeeResource
+		case a.Optional:
+			attendee.Type = models.AttendeeOptional
+		}
+		if a.Organizer {
+			attendee.Response = models.ResponseOrganizer
+		}
+		if a.Self && !event.IsOrganizer {
+			event.Response = attendee.Response
+		}
+		event.Attendees = append(event.Attendees, attendee)
+	}
+
+	reminders := defaultReminders
+	if e.Reminders != nil && !e.Reminders.UseDefault {
+		reminders = e.Reminders.Overrides
+	}
+	for _, reminder := range reminders {
+		if reminder.Method == "popup" {
+			event.Alarms = append(event.Alarms, time.Duration(reminder.Minutes)*time.Minute)
+		}
+	}
+
+	return event, nil
+}
+
+func parseGoogleTime(t googleTime) (time.Time, bool, error) {
+	if t.DateTime != "" {
+		parsed, err := time.Parse(time.RFC3339, t.DateTime)
+		return parsed, false, err
+	}
+	if t.Date != "" {
+		// All-day events start at midnight of the user
+		parsed, err := time.ParseInLocation("2006-01-02", t.Date, time.Local)
+		return parsed, true, err
+	}
+	return time.Time{}, false, fmt.Errorf("missing field")
+}
+
+// googleJoinURL returns the link to join the video conference of the event.
+func googleJoinURL(e googleEvent) string {
+	for _, entryPoint := range e.ConferenceData.EntryPoints {
+		if entryPoint.EntryPointType == "video" && entryPoint.URI != "" {
+			return entryPoint.URI
+		}
+	}
+	return e.HangoutLink
+}
+
+func parseGoogleResponse(response string) models.ResponseStatus {
+	switch response {
+	case "accepted":
+		return models.ResponseAccepted
+	case "tentative":
+		return models.ResponseTentative
+	case "declined":
+		return models.ResponseDeclined
+	case "needsAction":
+		return models.ResponseNotResponded
+	default:
+		return models.ResponseNone
+	}
+}
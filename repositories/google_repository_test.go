@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func newTestGoogleRepository(t *testing.T, handler http.HandlerFunc) *GoogleRepository {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	authInstance := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token", Expiry: time.Now().Add(time.Hour)})
+	repo := NewGoogleRepository(authInstance)
+	repo.BaseURL = server.URL + "/calendar/v3"
+	return repo
+}
+
+func googleTestEvent(id, summary, start string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       id,
+		"status":   "confirmed",
+		"summary":  summary,
+		"iCalUID":  id + "@google.com",
+		"start":    map[string]interface{}{"dateTime": start},
+		"end":      map[string]interface{}{"dateTime": start},
+		"location": "Room 1",
+	}
+}
+
+func TestGoogleFetchCalendarViews(t *testing.T) {
+	var queries []map[string]string
+	// Responses by sync token, "" for the full synchronization
+	responses := map[string][]map[string]interface{}{}
+
+	repo := newTestGoogleRepository(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/calendar/v3/calendars/primary/events", r.URL.Path)
+		require.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		query := map[string]string{}
+		for key := range r.URL.Query() {
+			query[key] = r.URL.Query().Get(key)
+		}
+		queries = append(queries, query)
+		assert.Equal(t, "true", query["singleEvents"])
+
+		pages, ok := responses[query["syncToken"]]
+		if !ok {
+			http.Error(w, "gone", http.StatusGone)
+			return
+		}
+		page := pages[0]
+		if query["pageToken"] != "" {
+			page = pages[1]
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+
+	start := time.Date(2033, 3, 3, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2033, 3, 3, 23, 59, 59, 0, time.UTC)
+	titles := func() []string {
+		views, err := repo.FetchCalendarViews(context.Background(), []string{""}, start, end)
+		require.NoError(t, err)
+		require.Len(t, views, 1)
+		require.NoError(t, views[0].Err)
+		var titles []string
+		for _, event := range views[0].Events {
+			titles = append(titles, event.Title)
+		}
+		return titles
+	}
+
+	// The full synchronization has two pages
+	responses[""] = []map[string]interface{}{
+		{
+			"items":         []interface{}{googleTestEvent("a", "Standup", "2033-03-03T09:00:00Z")},
+			"nextPageToken": "page-2",
+		},
+		{
+			"items":         []interface{}{googleTestEvent("b", "Review", "2033-03-03T08:00:00Z")},
+			"nextSyncToken": "sync-1",
+		},
+	}
+	assert.Equal(t, []string{"Review", "Standup"}, titles())
+	require.Len(t, queries, 2)
+	assert.Equal(t, "2033-03-03T00:00:00Z", queries[0]["timeMin"])
+	assert.Equal(t, "2033-03-03T23:59:59Z", queries[0]["timeMax"])
+	assert.Equal(t, "page-2", queries[1]["pageToken"])
+
+	// Only changes are fetched afterwards, and events outside the range, which is half-open, are ignored
+	responses["sync-1"] = []map[string]interface{}{{
+		"items": []interface{}{
+			map[string]interface{}{"id": "a", "status": "cancelled"},
+			googleTestEvent("c", "Retro", "2033-03-03T10:00:00Z"),
+			googleTestEvent("d", "Tomorrow", "2033-03-04T10:00:00Z"),
+			googleTestEvent("e", "At End", "2033-03-03T23:59:59Z"),
+			func() map[string]interface{} {
+				event := googleTestEvent("f", "Ending At Start", "2033-03-02T23:00:00Z")
+				event["end"] = map[string]interface{}{"dateTime": "2033-03-03T00:00:00Z"}
+				return event
+			}(),
+		},
+		"nextSyncToken": "sync-2",
+	}}
+	assert.Equal(t, []string{"Review", "Retro"}, titles())
+	assert.Equal(t, "sync-1", queries[2]["syncToken"])
+	assert.Empty(t, queries[2]["timeMin"])
+
+	// An expired sync token starts over with a full synchronization
+	delete(responses, "sync-2")
+	assert.Equal(t, []string{"Review", "Standup"}, titles())
+	assert.Equal(t, "sync-2", queries[3]["syncToken"])
+	assert.Empty(t, queries[4]["syncToken"])
+}
+
+func TestParseGoogleEvent(t *testing.T) {
+	var e googleEvent
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "abc",
+		"summary": "Design Review",
+		"iCalUID": "abc@google.com",
+		"start": {"dateTime": "2033-03-03T12:00:00+09:00", "timeZone": "Asia/Tokyo"},
+		"end": {"dateTime": "2033-03-03T12:30:00+09:00", "timeZone": "Asia/Tokyo"},
+		"organizer": {"email": "bob@example.com", "displayName": "Bob"},
+		"attendees": [
+			{"email": "bob@example.com", "displayName": "Bob", "organizer": true, "responseStatus": "accepted"},
+			{"email": "me@example.com", "self": true, "optional": true, "responseStatus": "needsAction"},
+			{"email": "room@resource.calendar.google.com", "resource": true, "responseStatus": "accepted"}
+		],
+		"hangoutLink": "https://meet.google.com/abc-defg-hij",
+		"conferenceData": {"entryPoints": [
+			{"entryPointType": "phone", "uri": "tel:+1-555-0100"},
+			{"entryPointType": "video", "uri": "https://meet.google.com/abc-defg-hij?authuser=0"}
+		]},
+		"reminders": {"useDefault": false, "overrides": [{"method": "email", "minutes": 60}, {"method": "popup", "minutes": 5}]}
+	}`), &e))
+
+	event, err := parseGoogleEvent(e, []googleReminder{{Method: "popup", Minutes: 10}})
+	require.NoError(t, err)
+	assert.Equal(t, models.Event{
+		UID:       "abc@google.com",
+		Title:     "Design Review",
+		Start:     event.Start,
+		End:       event.End,
+		JoinURL:   "https://meet.google.com/abc-defg-hij?authuser=0",
+		Organizer: "Bob",
+		Response:  models.ResponseNotResponded,
+		Attendees: []models.Attendee{
+			{Name: "Bob", Email: "bob@example.com", Type: models.AttendeeRequired, Response: models.ResponseOrganizer},
+			{Email: "me@example.com", Type: models.AttendeeOptional, Response: models.ResponseNotResponded},
+			{Email: "room@resource.calendar.google.com", Type: models.AttendeeResource, Response: models.ResponseAccepted},
+		},
+		Alarms: []time.Duration{5 * time.Minute},
+	}, event)
+	assert.Equal(t, time.Date(2033, 3, 3, 3, 0, 0, 0, time.UTC), event.Start.UTC())
+	assert.Equal(t, 30*time.Minute, event.End.Sub(event.Start))
+
+	// Without conference data, the Meet link is used, and the default reminders apply
+	e.ConferenceData.EntryPoints = nil
+	e.Reminders = &googleReminders{UseDefault: true}
+	e.Start = googleTime{Date: "2033-03-03"}
+	event, err = parseGoogleEvent(e, []googleReminder{{Method: "popup", Minutes: 10}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://meet.google.com/abc-defg-hij", event.JoinURL)
+	assert.Equal(t, []time.Duration{10 * time.Minute}, event.Alarms)
+	assert.True(t, event.AllDay)
+}
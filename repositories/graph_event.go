@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+)
+
+// Fields of an event which are fetched
+const graphEventFields = "subject,start,end,isAllDay,location,iCalUId,organizer,isOrganizer,attendees,responseStatus"
+
+// parseGraphEvent converts an event resource of the Graph API.
+// DOC: https://learn.microsoft.com/en-us/graph/api/resources/event
+func parseGraphEvent(value interface{}) (models.Event, error) {
+	event, ok := value.(map[string]interface{})
+	if !ok {
+		return models.Event{}, fmt.Errorf("event is not an object")
+	}
+
+	start, err := parseDateTimeTimeZone(event["start"])
+	if err != nil {
+		return models.Event{}, fmt.Errorf("invalid 'start': %w", err)
+	}
+	end, err := parseDateTimeTimeZone(event["end"])
+	if err != nil {
+		// The end is not needed for reminders
+		end = start
+	}
+
+	subject, ok := event["subject"].(string)
+	if !ok {
+		return models.Event{}, fmt.Errorf("'subject' is not a string")
+	}
+
+	location, _ := event["location"].(map[string]interface{})
+	locationName, _ := location["displayName"].(string)
+	uid, _ := event["iCalUId"].(string)
+	allDay, _ := event["isAllDay"].(bool)
+	isOrganizer, _ := event["isOrganizer"].(bool)
+	responseStatus, _ := event["responseStatus"].(map[string]interface{})
+	response, _ := responseStatus["response"].(string)
+
+	result := models.Event{
+		UID:         uid,
+		Title:       subject,
+		Start:       start,
+		End:         end,
+		AllDay:      allDay,
+		Location:    locationName,
+		Organizer:   emailAddressName(event["organizer"]),
+		IsOrganizer: isOrganizer,
+		Response:    parseResponse(response),
+	}
+
+	attendees, _ := event["attendees"].([]interface{})
+	for _, a := range attendees {
+		attendee, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		attendeeType, _ := attendee["type"].(string)
+		status, _ := attendee["status"].(map[string]interface{})
+		response, _ := status["response"].(string)
+		emailAddress, _ := attendee["emailAddress"].(map[string]interface{})
+		name, _ := emailAddress["name"].(string)
+		address, _ := emailAddress["address"].(string)
+		result.Attendees = append(result.Attendees, models.Attendee{
+			Name:     name,
+			Email:    address,
+			Type:     models.AttendeeType(attendeeType),
+			Response: parseResponse(response),
+		})
+	}
+
+	return result, nil
+}
+
+// parseDateTimeTimeZone parses a dateTimeTimeZone resource.
+// DOC: https://learn.microsoft.com/en-us/graph/api/resources/datetimetimezone
+func parseDateTimeTimeZone(value interface{}) (time.Time, error) {
+	dateTimeTimeZone, ok := value.(map[string]interface{})
+	if !ok {
+		return time.Time{}, fmt.Errorf("missing field")
+	}
+	dateTime, ok := dateTimeTimeZone["dateTime"].(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("'dateTime' is not a string")
+	}
+
+	// Times are in UTC unless another time zone is preferred with the Prefer header
+	loc := time.UTC
+	if timeZone, _ := dateTimeTimeZone["timeZone"].(string); timeZone != "" && timeZone != "UTC" {
+		if l, err := time.LoadLocation(timeZone); err == nil {
+			loc = l
+		}
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05.0000000", dateTime, loc)
+}
+
+// parseResponse converts a response of a responseStatus resource.
+// DOC: https://learn.microsoft.com/en-us/graph/api/resources/responsestatus
+func parseResponse(response string) models.ResponseStatus {
+	switch response {
+	case "organizer":
+		return models.ResponseOrganizer
+	case "accepted":
+		return models.ResponseAccepted
+	case "tentativelyAccepted":
+		return models.ResponseTentative
+	case "declined":
+		return models.ResponseDeclined
+	case "notResponded":
+		return models.ResponseNotResponded
+	default:
+		return models.ResponseNone
+	}
+}
+
+// emailAddressName returns the name of a recipient, or its address if it has no name.
+func emailAddressName(recipient interface{}) string {
+	r, _ := recipient.(map[string]interface{})
+	emailAddress, _ := r["emailAddress"].(map[string]interface{})
+	if name, _ := emailAddress["name"].(string); name != "" {
+		return name
+	}
+	address, _ := emailAddress["address"].(string)
+	return address
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/kajikentaro/meeting-reminder/utils/ical"
+)
+
+// ICSRepository reads iCalendar (.ics) feeds from URLs or local files.
+type ICSRepository struct {
+	// Owner is the email address of the user, to find the user's response to invitations. Optional.
+	Owner  string
+	Client *http.Client
+
+	mu sync.Mutex
+	// feeds are the feeds fetched so far, by URL
+	feeds map[string]icsFeed
+}
+
+// icsFeed is a feed with the validators of its response, which is reused while it is not modified.
+type icsFeed struct {
+	etag         string
+	lastModified string
+	calendar     *ical.Calendar
+}
+
+func NewICSRepository(owner string) *ICSRepository {
+	return &ICSRepository{
+		Owner:  owner,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		feeds:  map[string]icsFeed{},
+	}
+}
+
+// FetchCalendarViews reads the calendars between start and end, in the same order.
+// Calendar ids are http(s) or webcal URLs, file URLs or file paths.
+// Feeds are requested with the ETag or the modification time of the last response, and
+// are not downloaded again while they are not modified.
+func (r *ICSRepository) FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error) {
+	views := make([]models.CalendarView, len(calendarIDs))
+	for i, id := range calendarIDs {
+		calendar, err := r.read(ctx, id)
+		if err != nil {
+			views[i] = models.CalendarView{Err: err}
+			continue
+		}
+		views[i] = models.CalendarView{Events: calendar.Events(start, end, r.Owner)}
+	}
+	return views, nil
+}
+
+func (r *ICSRepository) read(ctx context.Context, id string) (*ical.Calendar, error) {
+	if id == "" {
+		return nil, fmt.Errorf("no URL or path of the calendar")
+	}
+
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// A path, or a Windows path with a drive letter
+		return readICSFile(id)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "file":
+		return readICSFile(u.Path)
+	case "webcal":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+
+	return r.download(ctx, u.String())
+}
+
+// download fetches the feed of the URL, unless it was not modified since the last response.
+func (r *ICSRepository) download(ctx context.Context, feedURL string) (*ical.Calendar, error) {
+	r.mu.Lock()
+	cached, ok := r.feeds[feedURL]
+	r.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ok && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if ok && cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && ok {
+		return cached.calendar, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with status: %s", resp.Status)
+	}
+	calendar, err := parseICS(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := icsFeed{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified"), calendar: calendar}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if feed.etag != "" || feed.lastModified != "" {
+		r.feeds[feedURL] = feed
+	} else {
+		delete(r.feeds, feedURL)
+	}
+	return calendar, nil
+}
+
+func readICSFile(path string) (*ical.Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseICS(f)
+}
+
+func parseICS(r io.Reader) (*ical.Calendar, error) {
+	calendar, err := ical.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iCalendar data: %w", err)
+	}
+	return calendar, nil
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testICS = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:standup@example.com
+SUMMARY:Standup
+DTSTART:20330303T090000Z
+DTEND:20330303T091500Z
+RRULE:FREQ=DAILY;COUNT=3
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestICSFetchCalendarViews(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(testICS))
+	}))
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "calendar.ics")
+	require.NoError(t, os.WriteFile(path, []byte(strings.ReplaceAll(testICS, "\n", "\r\n")), 0600))
+
+	repo := NewICSRepository("me@example.com")
+	start := time.Date(2033, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2033, 3, 4, 23, 59, 59, 0, time.UTC)
+	views, err := repo.FetchCalendarViews(context.Background(), []string{
+		server.URL + "/calendar.ics",
+		path,
+		"file://" + path,
+		server.URL + "/missing.ics",
+		"ftp://example.com/calendar.ics",
+	}, start, end)
+	require.NoError(t, err)
+	require.Len(t, views, 5)
+
+	for _, view := range views[:3] {
+		require.NoError(t, view.Err)
+		require.Len(t, view.Events, 1)
+		assert.Equal(t, "Standup", view.Events[0].Title)
+		assert.Equal(t, time.Date(2033, 3, 4, 9, 0, 0, 0, time.UTC), view.Events[0].Start.UTC())
+	}
+	assert.EqualError(t, views[3].Err, "request failed with status: 404 Not Found")
+	assert.EqualError(t, views[4].Err, "unsupported URL scheme: ftp")
+}
+
+func TestICSConditionalRequests(t *testing.T) {
+	var downloads, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(testICS))
+	}))
+	t.Cleanup(server.Close)
+
+	repo := NewICSRepository("")
+	start := time.Date(2033, 3, 4, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2033, 3, 4, 23, 59, 59, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		views, err := repo.FetchCalendarViews(context.Background(), []string{server.URL + "/calendar.ics"}, start, end)
+		require.NoError(t, err)
+		require.NoError(t, views[0].Err)
+		require.Len(t, views[0].Events, 1, "the parsed feed is reused when not modified")
+		assert.Equal(t, "Standup", views[0].Events[0].Title)
+	}
+	assert.Equal(t, 1, downloads)
+	assert.Equal(t, 2, notModified)
+}
@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/kajikentaro/meeting-reminder/utils/cron"
+	"github.com/kajikentaro/meeting-reminder/utils/ical"
+	"gopkg.in/yaml.v3"
+)
+
+// ManualRepository reads events defined by hand in local YAML or JSON files.
+// A file is read again when it changes.
+type ManualRepository struct {
+	mu    sync.Mutex
+	files map[string]*manualFile
+}
+
+// manualFile is the content of an events file.
+type manualFile struct {
+	// TimeZone of the times without offset and of cron schedules. Defaults to the local time zone.
+	TimeZone string        `yaml:"timezone"`
+	Events   []manualEvent `yaml:"events"`
+
+	modTime  time.Time
+	size     int64
+	location *time.Location
+}
+
+// manualEvent is a one-off event, or a recurring event with either an RRULE or a cron schedule.
+type manualEvent struct {
+	Title string `yaml:"title"`
+	// Start of a one-off event, or the first occurrence of an RRULE
+	Start string `yaml:"start"`
+	// Duration like "30m". Optional.
+	Duration string `yaml:"duration"`
+	Location string `yaml:"location"`
+	Link     string `yaml:"link"`
+	RRule    string `yaml:"rrule"`
+	Cron     string `yaml:"cron"`
+	// Alarms are durations before the start, like "10m"
+	Alarms []string `yaml:"alarms"`
+
+	start    time.Time
+	allDay   bool
+	duration time.Duration
+	alarms   []time.Duration
+	schedule *cron.Schedule
+}
+
+// Layouts of the start of a manual event, in the time zone of the file unless they have an offset
+var manualTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+func NewManualRepository() *ManualRepository {
+	return &ManualRepository{files: map[string]*manualFile{}}
+}
+
+// FetchCalendarViews returns the events of the files between start and end, in the same order.
+// Calendar ids are paths of the files, which are read regardless of ctx.
+func (r *ManualRepository) FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	views := make([]models.CalendarView, len(calendarIDs))
+	for i, path := range calendarIDs {
+		file, err := r.load(path)
+		if err != nil {
+			views[i] = models.CalendarView{Err: err}
+			continue
+		}
+		views[i] = models.CalendarView{Events: file.between(start, end)}
+	}
+	return views, nil
+}
+
+// load returns the content of the file, reading it again if it changed since the last time.
+func (r *ManualRepository) load(path string) (*manualFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no path of the events file")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if cached := r.files[path]; cached != nil && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached, nil
+	}
+
+	file, err := readManualFile(path)
+	if err != nil {
+		delete(r.files, path)
+		return nil, err
+	}
+	file.modTime = info.ModTime()
+	file.size = info.Size()
+	if r.files[path] != nil {
+		log.Printf("Reloaded %d events from %s", len(file.Events), path)
+	}
+	r.files[path] = file
+	return file, nil
+}
+
+func readManualFile(path string) (*manualFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is also read as YAML
+	var file manualFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid events file %s: %w", path, err)
+	}
+
+	file.location = time.Local
+	if file.TimeZone != "" {
+		if file.location, err = time.LoadLocation(file.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid timezone in %s: %w", path, err)
+		}
+	}
+	for i := range file.Events {
+		if err := file.Events[i].parse(file.location); err != nil {
+			return nil, fmt.Errorf("invalid event %d (%q) in %s: %w", i+1, file.Events[i].Title, path, err)
+		}
+	}
+	return &file, nil
+}
+
+func (e *manualEvent) parse(loc *time.Location) error {
+	if e.Title == "" {
+		return fmt.Errorf("missing title")
+	}
+
+	var err error
+	if e.Duration != "" {
+		if e.duration, err = time.ParseDuration(e.Duration); err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+	}
+	for _, alarm := range e.Alarms {
+		d, err := time.ParseDuration(alarm)
+		if err != nil {
+			return fmt.Errorf("invalid alarm: %w", err)
+		}
+		e.alarms = append(e.alarms, d)
+	}
+
+	if e.Cron != "" {
+		if e.RRule != "" {
+			return fmt.Errorf("only one of cron and rrule can be set")
+		}
+		if e.schedule, err = cron.Parse(e.Cron); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if e.Start == "" {
+		return fmt.Errorf("missing start or cron")
+	}
+	if e.start, err = time.ParseInLocation("2006-01-02", e.Start, loc); err == nil {
+		e.allDay = true
+		if e.duration == 0 {
+			e.duration = 24 * time.Hour
+		}
+	} else {
+		for _, layout := range manualTimeLayouts {
+			if e.start, err = time.ParseInLocation(layout, e.Start, loc); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid start: %q", e.Start)
+		}
+	}
+
+	if e.RRule != "" {
+		// Check the rule now, so that an invalid one is reported when the file is read
+		if _, err := ical.Recurrences(e.RRule, e.start, e.start, e.start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// between returns the occurrences of the events overlapping start and end, sorted by start.
+func (f *manualFile) between(start, end time.Time) []models.Event {
+	var events []models.Event
+	for _, e := range f.Events {
+		// Occurrences which started before start may still be in progress
+		from := start.Add(-e.duration)
+
+		var starts []time.Time
+		switch {
+		case e.schedule != nil:
+			starts = e.schedule.Between(from.In(f.location), end)
+		case e.RRule != "":
+			starts, _ = ical.Recurrences(e.RRule, e.start, from, end)
+		case !e.start.Before(from) && e.start.Before(end):
+			starts = []time.Time{e.start}
+		}
+
+		for _, s := range starts {
+			events = append(events, models.Event{
+				Title:    e.Title,
+				Start:    s,
+				End:      s.Add(e.duration),
+				AllDay:   e.allDay,
+				Location: e.Location,
+				JoinURL:  e.Link,
+				Alarms:   e.alarms,
+			})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
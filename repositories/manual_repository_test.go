@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testManualEvents = `
+timezone: Asia/Tokyo
+events:
+  - title: Deploy window
+    start: 2025-06-06 15:00
+    duration: 1h
+    alarms: [10m]
+  - title: Standup
+    start: 2025-06-02T09:30:00
+    rrule: FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+    duration: 15m
+    link: https://meet.example.com/standup
+  - title: Timesheet
+    cron: "0 17 * * FRI"
+  - title: Company Holiday
+    start: 2025-06-06
+`
+
+func TestManualFetchCalendarViews(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testManualEvents), 0600))
+
+	repo := NewManualRepository()
+	start := time.Date(2025, 6, 6, 0, 0, 0, 0, tokyo)
+	end := time.Date(2025, 6, 6, 23, 59, 59, 0, tokyo)
+	views, err := repo.FetchCalendarViews(context.Background(), []string{path, filepath.Join(dir, "missing.yaml")}, start, end)
+	require.NoError(t, err)
+	require.Len(t, views, 2)
+	require.NoError(t, views[0].Err)
+	assert.Error(t, views[1].Err)
+
+	events := views[0].Events
+	require.Len(t, events, 4)
+	assert.Equal(t, "Company Holiday", events[0].Title)
+	assert.True(t, events[0].AllDay)
+	assert.Equal(t, "Standup", events[1].Title)
+	assert.Equal(t, time.Date(2025, 6, 6, 9, 30, 0, 0, tokyo), events[1].Start)
+	assert.Equal(t, 15*time.Minute, events[1].End.Sub(events[1].Start))
+	assert.Equal(t, "https://meet.example.com/standup", events[1].JoinURL)
+	assert.Equal(t, "Deploy window", events[2].Title)
+	assert.Equal(t, time.Date(2025, 6, 6, 15, 0, 0, 0, tokyo), events[2].Start)
+	assert.Equal(t, []time.Duration{10 * time.Minute}, events[2].Alarms)
+	assert.Equal(t, "Timesheet", events[3].Title)
+	assert.Equal(t, time.Date(2025, 6, 6, 17, 0, 0, 0, tokyo), events[3].Start)
+
+	// Changes of the file are picked up, also from JSON
+	json := `{"timezone": "Asia/Tokyo", "events": [{"title": "Moved Deploy", "start": "2025-06-06T16:00:00+09:00"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(json), 0600))
+	views, err = repo.FetchCalendarViews(context.Background(), []string{path}, start, end)
+	require.NoError(t, err)
+	require.NoError(t, views[0].Err)
+	require.Len(t, views[0].Events, 1)
+	assert.Equal(t, "Moved Deploy", views[0].Events[0].Title)
+
+	// Invalid events are reported
+	require.NoError(t, os.WriteFile(path, []byte("events:\n  - title: Broken\n    cron: \"0 25 * * *\"\n"), 0600))
+	views, err = repo.FetchCalendarViews(context.Background(), []string{path}, start, end)
+	require.NoError(t, err)
+	assert.ErrorContains(t, views[0].Err, `invalid event 1 ("Broken")`)
+}
@@ -1,76 +1,174 @@
 package repositories
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
-	"github.com/kajikentaro/meeting-reminder/auth"
-	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+	"github.com/kajikentaro/meeting-reminder/metrics"
+	"github.com/kajikentaro/meeting-reminder/models"
+	"golang.org/x/oauth2"
 )
 
+const graphBaseURL = "https://graph.microsoft.com/v1.0"
+
 type MicrosoftRepository struct {
-	Auth *auth.Auth
+	// Auth gives the access tokens, like a signed-in *auth.Auth
+	Auth oauth2.TokenSource
+	// BaseURL is the Graph API endpoint, including the version
+	BaseURL string
+	Client  *http.Client
 }
 
-func NewMicrosoftRepository(auth *auth.Auth) *MicrosoftRepository {
-	return &MicrosoftRepository{Auth: auth}
+// Calendar identifies a calendar to read from.
+// The zero value is the default calendar of the signed-in user.
+type Calendar struct {
+	// UserID is the id or userPrincipalName of the mailbox owner.
+	// Empty for the signed-in user, set for shared or delegated calendars.
+	UserID string
+	// GroupID is the calendar group the calendar belongs to. Optional.
+	GroupID string
+	// ID is the calendar id. Empty for the owner's default calendar.
+	ID string
 }
 
-func (r *MicrosoftRepository) FetchCalendarEvents() ([]map[string]interface{}, error) {
+// Path returns the Graph API path of the calendar, relative to the API version.
+func (c Calendar) Path() string {
+	owner := "me"
+	if c.UserID != "" {
+		owner = "users/" + url.PathEscape(c.UserID)
+	}
+	if c.ID == "" {
+		return owner + "/calendar"
+	}
+	if c.GroupID != "" {
+		return owner + "/calendarGroups/" + url.PathEscape(c.GroupID) + "/calendars/" + url.PathEscape(c.ID)
+	}
+	return owner + "/calendars/" + url.PathEscape(c.ID)
+}
+
+func NewMicrosoftRepository(auth oauth2.TokenSource) *MicrosoftRepository {
+	return &MicrosoftRepository{Auth: auth, BaseURL: graphBaseURL, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// newRequest creates an authorized request to the Graph API.
+// path is relative to BaseURL and may contain a query string.
+func (r *MicrosoftRepository) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
 	// Fetch access token from the auth struct
-	token, err := r.Auth.GetAccessToken()
+	token, err := r.Auth.Token()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	// DOC: https://learn.microsoft.com/en-us/graph/api/user-list-calendarview
-	graphAPIEndpoint, err := url.Parse("https://graph.microsoft.com/v1.0/me/calendar/calendarView")
-	if err != nil {
-		return nil, err
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
 	}
 
-	startDateTime := xtime.Now().Truncate(24 * time.Hour).Format(time.RFC3339)
-	endDateTime := xtime.Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Second).Format(time.RFC3339)
-	query := url.Values{}
-	query.Set("startDateTime", startDateTime)
-	query.Set("endDateTime", endDateTime)
-	graphAPIEndpoint.RawQuery = query.Encode()
-
-	req, err := http.NewRequest("GET", graphAPIEndpoint.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, method, r.BaseURL+"/"+path, reader)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends the request and decodes the JSON response into result, if not nil.
+func (r *MicrosoftRepository) do(req *http.Request, result interface{}) error {
+	start := time.Now()
+	resp, err := r.Client.Do(req)
+	metrics.GraphRequestDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		return nil, err
+		metrics.GraphRequests.WithLabelValues("http", "error").Inc()
+		return err
 	}
 	defer resp.Body.Close()
+	metrics.GraphRequests.WithLabelValues("http", strconv.Itoa(resp.StatusCode)).Inc()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %s", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("API request failed with status: %s", resp.Status)
 	}
 
-	var result map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return nil, err
+	if result == nil {
+		return nil
 	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
 
-	events, ok := result["value"].([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("unexpected response format")
+// FetchCalendarViews fetches the events of the calendars between start and end, in the same order.
+// Calendar ids are paths returned by Calendar.Path, and an empty id is the default calendar.
+// The calendars are fetched together with JSON batching, and a failure of a
+// single calendar is reported in its CalendarView.
+func (r *MicrosoftRepository) FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error) {
+	// DOC: https://learn.microsoft.com/en-us/graph/api/user-list-calendarview
+	query := url.Values{}
+	query.Set("startDateTime", start.Format(time.RFC3339))
+	query.Set("endDateTime", end.Format(time.RFC3339))
+	query.Set("$select", graphEventFields)
+
+	views := make([]models.CalendarView, len(calendarIDs))
+	// Next page to fetch of each calendar, relative to BaseURL
+	pending := map[int]string{}
+	for i, id := range calendarIDs {
+		if id == "" {
+			id = Calendar{}.Path()
+		}
+		pending[i] = id + "/calendarView?" + query.Encode()
 	}
 
-	var calendarEvents []map[string]interface{}
-	for _, event := range events {
-		calendarEvents = append(calendarEvents, event.(map[string]interface{}))
+	for len(pending) > 0 {
+		responses, err := r.batch(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+
+		next := map[int]string{}
+		for i, resp := range responses {
+			if resp.err != nil {
+				views[i] = models.CalendarView{Err: resp.err}
+				continue
+			}
+
+			events, ok := resp.body["value"].([]interface{})
+			if !ok {
+				views[i] = models.CalendarView{Err: fmt.Errorf("unexpected response format")}
+				continue
+			}
+			for _, e := range events {
+				event, err := parseGraphEvent(e)
+				if err != nil {
+					log.Printf("Invalid event format: %v: %+v", err, e)
+					continue
+				}
+				views[i].Events = append(views[i].Events, event)
+			}
+
+			if nextLink, _ := resp.body["@odata.nextLink"].(string); nextLink != "" {
+				path, err := r.relativePath(nextLink)
+				if err != nil {
+					views[i] = models.CalendarView{Err: err}
+					continue
+				}
+				next[i] = path
+			}
+		}
+		pending = next
 	}
 
-	return calendarEvents, nil
+	return views, nil
 }
@@ -0,0 +1,178 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func newTestRepository(t *testing.T, handler http.HandlerFunc) *MicrosoftRepository {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	authInstance := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token", Expiry: time.Now().Add(time.Hour)})
+	repo := NewMicrosoftRepository(authInstance)
+	repo.BaseURL = server.URL + "/v1.0"
+	return repo
+}
+
+func TestCalendarPath(t *testing.T) {
+	assert.Equal(t, "me/calendar", Calendar{}.Path())
+	assert.Equal(t, "me/calendars/AAMk%2Fa=", Calendar{ID: "AAMk/a="}.Path())
+	assert.Equal(t, "me/calendarGroups/group/calendars/id", Calendar{GroupID: "group", ID: "id"}.Path())
+	assert.Equal(t, "users/alice@example.com/calendar", Calendar{UserID: "alice@example.com"}.Path())
+	assert.Equal(t, "users/alice@example.com/calendars/id", Calendar{UserID: "alice@example.com", ID: "id"}.Path())
+}
+
+// graphEvent returns an event resource of the Graph API with the given subject.
+func graphEvent(subject string) map[string]interface{} {
+	return map[string]interface{}{
+		"subject": subject,
+		"start":   map[string]interface{}{"dateTime": "2033-03-03T03:03:00.0000000", "timeZone": "UTC"},
+	}
+}
+
+func TestFetchCalendarViews(t *testing.T) {
+	var batchSizes []int
+	start := time.Date(2033, 3, 3, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2033, 3, 3, 23, 59, 59, 0, time.UTC)
+
+	repo := newTestRepository(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1.0/$batch", r.URL.Path)
+		require.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+
+		var body struct {
+			Requests []batchRequest `json:"requests"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		batchSizes = append(batchSizes, len(body.Requests))
+
+		var responses []map[string]interface{}
+		for _, req := range body.Requests {
+			switch {
+			case strings.HasPrefix(req.URL, "/me/calendars/missing/"):
+				responses = append(responses, map[string]interface{}{
+					"id":     req.ID,
+					"status": 404,
+					"body":   map[string]interface{}{"error": map[string]interface{}{"message": "The specified object was not found in the store."}},
+				})
+			case strings.HasPrefix(req.URL, "/me/calendar/calendarView?"):
+				query, err := url.ParseQuery(strings.SplitN(req.URL, "?", 2)[1])
+				require.NoError(t, err)
+				assert.Equal(t, "2033-03-03T00:00:00Z", query.Get("startDateTime"))
+				assert.Equal(t, "2033-03-03T23:59:59Z", query.Get("endDateTime"))
+				assert.Equal(t, graphEventFields, query.Get("$select"))
+
+				// The default calendar has two pages, and an invalid event which is skipped
+				responses = append(responses, map[string]interface{}{
+					"id":     req.ID,
+					"status": 200,
+					"body": map[string]interface{}{
+						"value":           []interface{}{graphEvent("Page 1"), map[string]interface{}{"subject": "No Start"}},
+						"@odata.nextLink": "https://graph.microsoft.com/v1.0/me/calendar/calendarView/next?$skiptoken=abc",
+					},
+				})
+			case req.URL == "/me/calendar/calendarView/next?$skiptoken=abc":
+				responses = append(responses, map[string]interface{}{
+					"id":     req.ID,
+					"status": 200,
+					"body":   map[string]interface{}{"value": []interface{}{graphEvent("Page 2")}},
+				})
+			default:
+				responses = append(responses, map[string]interface{}{
+					"id":     req.ID,
+					"status": 200,
+					"body":   map[string]interface{}{"value": []interface{}{graphEvent(req.URL)}},
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+	})
+
+	calendars := []string{"", Calendar{ID: "missing"}.Path()}
+	for i := 0; i < 20; i++ {
+		calendars = append(calendars, Calendar{ID: fmt.Sprintf("calendar-%d", i)}.Path())
+	}
+
+	views, err := repo.FetchCalendarViews(context.Background(), calendars, start, end)
+	require.NoError(t, err)
+	require.Len(t, views, len(calendars))
+
+	// 22 calendars need two batches, and the second page one more
+	assert.Equal(t, []int{20, 2, 1}, batchSizes)
+
+	assert.NoError(t, views[0].Err)
+	require.Len(t, views[0].Events, 2)
+	assert.Equal(t, "Page 1", views[0].Events[0].Title)
+	assert.Equal(t, "Page 2", views[0].Events[1].Title)
+
+	assert.EqualError(t, views[1].Err, "API request failed with status: 404 Not Found: The specified object was not found in the store.")
+
+	for i := 2; i < len(calendars); i++ {
+		assert.NoError(t, views[i].Err)
+		require.Len(t, views[i].Events, 1)
+		assert.True(t, strings.HasPrefix(views[i].Events[0].Title, "/"+calendars[i]+"/calendarView?"))
+	}
+}
+
+func TestFetchCalendarViews_BatchFailure(t *testing.T) {
+	repo := newTestRepository(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "throttled", http.StatusTooManyRequests)
+	})
+
+	_, err := repo.FetchCalendarViews(context.Background(), []string{""}, time.Now(), time.Now())
+	assert.EqualError(t, err, "API request failed with status: 429 Too Many Requests")
+}
+
+func TestParseGraphEvent(t *testing.T) {
+	event, err := parseGraphEvent(map[string]interface{}{
+		"subject":     "Design Review",
+		"iCalUId":     "uid-1",
+		"start":       map[string]interface{}{"dateTime": "2033-03-03T03:00:00.0000000", "timeZone": "UTC"},
+		"end":         map[string]interface{}{"dateTime": "2033-03-03T12:30:00.0000000", "timeZone": "Asia/Tokyo"},
+		"location":    map[string]interface{}{"displayName": "Room 1"},
+		"isOrganizer": false,
+		"organizer": map[string]interface{}{
+			"emailAddress": map[string]interface{}{"address": "bob@example.com"},
+		},
+		"responseStatus": map[string]interface{}{"response": "tentativelyAccepted"},
+		"attendees": []interface{}{
+			map[string]interface{}{
+				"type":         "optional",
+				"status":       map[string]interface{}{"response": "accepted"},
+				"emailAddress": map[string]interface{}{"name": "Alice", "address": "alice@example.com"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.Event{
+		UID:       "uid-1",
+		Title:     "Design Review",
+		Start:     time.Date(2033, 3, 3, 3, 0, 0, 0, time.UTC),
+		End:       event.End,
+		Location:  "Room 1",
+		Organizer: "bob@example.com",
+		Response:  models.ResponseTentative,
+		Attendees: []models.Attendee{
+			{Name: "Alice", Email: "alice@example.com", Type: models.AttendeeOptional, Response: models.ResponseAccepted},
+		},
+	}, event)
+	assert.Equal(t, 30*time.Minute, event.End.Sub(event.Start))
+
+	_, err = parseGraphEvent(map[string]interface{}{"subject": "No Start"})
+	assert.Error(t, err)
+	_, err = parseGraphEvent(map[string]interface{}{"start": map[string]interface{}{"dateTime": "2033-03-03T03:00:00.0000000"}})
+	assert.Error(t, err)
+}
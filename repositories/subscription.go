@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// Subscription is a Graph change notification subscription.
+// DOC: https://learn.microsoft.com/en-us/graph/api/resources/subscription
+type Subscription struct {
+	ID                       string    `json:"id,omitempty"`
+	Resource                 string    `json:"resource,omitempty"`
+	ChangeType               string    `json:"changeType,omitempty"`
+	NotificationURL          string    `json:"notificationUrl,omitempty"`
+	LifecycleNotificationURL string    `json:"lifecycleNotificationUrl,omitempty"`
+	ClientState              string    `json:"clientState,omitempty"`
+	ExpirationDateTime       time.Time `json:"expirationDateTime"`
+}
+
+// CreateSubscription subscribes to changes of the events of the signed-in user.
+// Graph validates notificationURL before responding, so the receiver must already be running.
+func (r *MicrosoftRepository) CreateSubscription(ctx context.Context, notificationURL, clientState string, expiration time.Time) (*Subscription, error) {
+	// DOC: https://learn.microsoft.com/en-us/graph/api/subscription-post-subscriptions
+	req, err := r.newRequest(ctx, "POST", "subscriptions", Subscription{
+		Resource:                 "/me/events",
+		ChangeType:               "created,updated,deleted",
+		NotificationURL:          notificationURL,
+		LifecycleNotificationURL: notificationURL,
+		ClientState:              clientState,
+		ExpirationDateTime:       expiration.UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var subscription Subscription
+	if err := r.do(req, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// RenewSubscription extends the expiration of a subscription.
+func (r *MicrosoftRepository) RenewSubscription(ctx context.Context, id string, expiration time.Time) (*Subscription, error) {
+	// DOC: https://learn.microsoft.com/en-us/graph/api/subscription-update
+	req, err := r.newRequest(ctx, "PATCH", "subscriptions/"+url.PathEscape(id), Subscription{
+		ExpirationDateTime: expiration.UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var subscription Subscription
+	if err := r.do(req, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// DeleteSubscription stops a subscription.
+func (r *MicrosoftRepository) DeleteSubscription(ctx context.Context, id string) error {
+	// DOC: https://learn.microsoft.com/en-us/graph/api/subscription-delete
+	req, err := r.newRequest(ctx, "DELETE", "subscriptions/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	return r.do(req, nil)
+}
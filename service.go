@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/daemon"
+	"github.com/kajikentaro/meeting-reminder/services"
+)
+
+// sessionEnvironment are the variables of the graphical session, which the services of systemd
+// may not have, copied to the unit so that the browser and the notifiers can be shown.
+var sessionEnvironment = []string{"DISPLAY", "WAYLAND_DISPLAY", "XAUTHORITY", "DBUS_SESSION_BUS_ADDRESS", "PATH"}
+
+// watchdogTimeout is how long the program may stop pinging the watchdog of systemd, or a check of
+// the event watcher may take, before it is restarted
+const watchdogTimeout = 5 * time.Minute
+
+func runCommandInstallService(flags *flag.FlagSet, opts *options, args []string) {
+	printUnit := flags.Bool("print", false, "print the unit instead of installing it")
+	parseCommand(flags, opts, args, 0)
+	if runtime.GOOS != "linux" {
+		fatalf("Services are only supported with systemd on Linux")
+	}
+
+	unit, err := serviceUnit(opts)
+	if err != nil {
+		fatalf("Error creating the unit: %v", err)
+	}
+	if *printUnit {
+		fmt.Print(unit)
+		return
+	}
+
+	path, err := daemon.UnitPath()
+	if err != nil {
+		fatalf("Error finding the unit directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		fatalf("Error creating the unit directory: %v", err)
+	}
+	// The unit may contain the settings of the environment and the flags, some of which are secret
+	if err := os.WriteFile(path, []byte(unit.String()), 0600); err != nil {
+		fatalf("Error writing the unit: %v", err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", daemon.ServiceName}} {
+		if err := systemctl(args...); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	fmt.Printf("Started %s, see its status with: systemctl --user status %s\n", daemon.ServiceName, daemon.ServiceName)
+}
+
+func runCommandUninstallService(flags *flag.FlagSet, opts *options, args []string) {
+	opts.register(flags)
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fatalf("Too many arguments of %s", flags.Name())
+	}
+
+	path, err := daemon.UnitPath()
+	if err != nil {
+		fatalf("Error finding the unit directory: %v", err)
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		fatalf("%s is not installed", daemon.ServiceName)
+	}
+	if err := systemctl("disable", "--now", daemon.ServiceName); err != nil {
+		fatalf("%v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		fatalf("Error removing the unit: %v", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("Stopped and removed %s\n", path)
+}
+
+// serviceUnit returns the unit running the reminders with the current executable, working
+// directory, shared flags and settings of the environment, so that the service reads the same settings.
+func serviceUnit(opts *options) (daemon.Unit, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return daemon.Unit{}, err
+	}
+	// go run builds the program in a temporary directory, which is removed when it exits
+	if strings.HasPrefix(executable, os.TempDir()) {
+		return daemon.Unit{}, fmt.Errorf("%s is a temporary build, install the program with go build or go install first", executable)
+	}
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return daemon.Unit{}, err
+	}
+
+	command := []string{executable, "run"}
+	if opts.envFileSet {
+		envFile, err := filepath.Abs(opts.envFile)
+		if err != nil {
+			return daemon.Unit{}, err
+		}
+		command = append(command, "-env-file", envFile)
+	}
+	if opts.configPath != "" {
+		configPath, err := filepath.Abs(opts.configPath)
+		if err != nil {
+			return daemon.Unit{}, err
+		}
+		command = append(command, "-config", configPath)
+	}
+
+	environment := map[string]string{}
+	for _, key := range sessionEnvironment {
+		if value, ok := os.LookupEnv(key); ok {
+			environment[key] = value
+		}
+	}
+	if path, ok := os.LookupEnv(configPathEnv); ok && opts.configPath == "" {
+		environment[configPathEnv] = path
+	}
+	// The env file is read by the service itself
+	for _, s := range settings {
+		if source := opts.settingSource(s.env); source == sourceFlag || source == sourceEnvironment {
+			environment[s.env] = opts.getenv(s.env)
+		}
+	}
+
+	return daemon.Unit{
+		Description:      "Meeting reminder",
+		Command:          command,
+		WorkingDirectory: workingDirectory,
+		Environment:      environment,
+		RestartDelay:     10 * time.Second,
+		Watchdog:         watchdogTimeout,
+		// The program is killed if it doesn't stop by itself
+		StopTimeout: shutdownTimeout + 5*time.Second,
+	}, nil
+}
+
+// systemctl runs systemctl on the services of the user.
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl --user %v failed: %w", args, err)
+	}
+	return nil
+}
+
+// lockInstance makes sure that the reminders of the user are shown by a single process,
+// so that they don't pop up twice. The lock is released when the process exits, and must be
+// kept referenced until then, as its file is closed when it is garbage collected.
+func lockInstance() *daemon.InstanceLock {
+	path, err := daemon.LockPath()
+	if err != nil {
+		fatalf("Error finding the lock file: %v", err)
+	}
+	lock, pid, err := daemon.Lock(path)
+	if errors.Is(err, daemon.ErrLocked) {
+		if pid > 0 {
+			fatalf("Another instance is already running (pid %d)", pid)
+		}
+		fatalf("Another instance is already running")
+	}
+	if err != nil {
+		fatalf("Error locking %s: %v", path, err)
+	}
+	return lock
+}
+
+// notifySystemd sends the state to systemd, if the program runs as its service.
+func notifySystemd(state string) {
+	if _, err := daemon.Notify(state); err != nil {
+		log.Printf("Failed to notify systemd of %s: %v", state, err)
+	}
+}
+
+// pingWatchdog tells systemd that the program is alive, until ctx is canceled. The watchdog is
+// not pinged while a check of the event watcher takes longer than the watchdog timeout, so that
+// systemd restarts the program if the watcher is stuck.
+func pingWatchdog(ctx context.Context, interval time.Duration, calendarService *services.CalendarService) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// The interval is half of the timeout
+			if d := calendarService.CheckDuration(); d > 2*interval {
+				log.Printf("The event watcher is stuck for %s, not pinging the watchdog", d.Round(time.Second))
+				continue
+			}
+			notifySystemd(daemon.Watchdog)
+		}
+	}
+}
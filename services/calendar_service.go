@@ -1,37 +1,428 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kajikentaro/meeting-reminder/metrics"
+	"github.com/kajikentaro/meeting-reminder/models"
 	"github.com/kajikentaro/meeting-reminder/ui"
 	"github.com/kajikentaro/meeting-reminder/utils/xtime"
 )
 
-//go:generate mockgen -destination=../mocks/mock_microsoft_repository.go -package=mocks . MicrosoftRepository,UI
-type MicrosoftRepository interface {
-	FetchCalendarEvents() ([]map[string]interface{}, error)
+//go:generate mockgen -destination=../mocks/mock_calendar_provider.go -package=mocks . CalendarProvider,UI
+
+// CalendarProvider reads events from a calendar backend, like Microsoft Graph or an iCalendar feed.
+type CalendarProvider interface {
+	// FetchCalendarViews returns the events between start and end of the calendars, in the same order.
+	// Calendar ids are provider specific, and an empty id is the default calendar of the provider.
+	// A failure of a single calendar is reported in its CalendarView.
+	FetchCalendarViews(ctx context.Context, calendarIDs []string, start, end time.Time) ([]models.CalendarView, error)
 }
 
 type UI interface {
-	ShowMeetingReminder(events []ui.UIEvents)
+	ShowMeetingReminder(ctx context.Context, events []ui.UIEvents)
+}
+
+// ReminderPolicy controls when reminders are shown for the events of a calendar.
+type ReminderPolicy struct {
+	// LeadTime is how long before the start of an event the reminder is shown.
+	LeadTime time.Duration
+	// Disabled turns off reminders for the calendar.
+	Disabled bool
+	// UseAlarms also shows reminders at the alarms set on the events.
+	UseAlarms bool
+}
+
+// Calendar is a watched calendar with its display settings.
+type Calendar struct {
+	// ID identifies the calendar in its provider.
+	ID     string
+	Name   string
+	Color  string
+	Policy ReminderPolicy
+	// Pushable is set if changes of the calendar are delivered by the
+	// change notifications of its account, so it doesn't need polling.
+	Pushable bool
+}
+
+// Account is a calendar provider, like a signed-in Microsoft account, and the calendars watched in it.
+type Account struct {
+	// Name labels the reminders of the account. Optional.
+	Name     string
+	Provider CalendarProvider
+	// Calendars to watch. If empty, the default calendar is watched.
+	Calendars []Calendar
+}
+
+// Filter selects the events reminded of, in addition to the policies of the calendars.
+type Filter struct {
+	// ExcludeTitles match the titles of the events not reminded of.
+	ExcludeTitles []*regexp.Regexp
+	// SkipDeclined skips the events the user declined.
+	SkipDeclined bool
+	// QuietHours are the periods no reminder is shown in.
+	QuietHours []QuietHours
+}
+
+// QuietHours is a period of the day, which continues into the next day if End is before Start.
+type QuietHours struct {
+	// Start and End are the times since midnight.
+	Start time.Duration
+	End   time.Duration
+	// Days are the days of the week the period starts on. Every day if empty.
+	Days []time.Weekday
+}
+
+// excludes reports whether the event is not reminded of.
+func (f Filter) excludes(event models.Event) bool {
+	if f.SkipDeclined && event.Response == models.ResponseDeclined {
+		return true
+	}
+	for _, pattern := range f.ExcludeTitles {
+		if pattern.MatchString(event.Title) {
+			return true
+		}
+	}
+	return false
+}
+
+// isQuiet reports whether t is in the quiet hours.
+func (f Filter) isQuiet(t time.Time) bool {
+	for _, q := range f.QuietHours {
+		if q.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q QuietHours) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if q.Start <= q.End {
+		return q.startsOn(midnight.Weekday()) && q.Start <= offset && offset < q.End
+	}
+	// The period started yesterday, or starts today
+	return (q.startsOn(midnight.AddDate(0, 0, -1).Weekday()) && offset < q.End) ||
+		(q.startsOn(midnight.Weekday()) && q.Start <= offset)
+}
+
+func (q QuietHours) startsOn(day time.Weekday) bool {
+	if len(q.Days) == 0 {
+		return true
+	}
+	for _, d := range q.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Events of accounts with change notifications are refetched at least this
+// often, in case a notification is lost.
+const resyncInterval = 30 * time.Minute
+
+type calendarCache struct {
+	events    []models.Event
+	fetchedAt time.Time
+	valid     bool
 }
 
 type CalendarService struct {
-	repo          MicrosoftRepository
+	accounts      []Account
 	ui            UI
 	watchInterval time.Duration
+
+	mu     sync.Mutex
+	filter Filter
+	// pushed holds the accounts whose changes are notified by Graph instead of being polled
+	pushed map[string]bool
+	caches [][]calendarCache // by account and calendar
+	// generation counts the reloads of the accounts, so that the events of an account fetched
+	// before a reload are not cached in the calendars of another
+	generation int
+	// notified is the ledger of the reminders shown, with the times they were due, so that
+	// a reminder is not shown twice when the interval changes
+	notified map[string]time.Time
+	// checkedUntil is the end of the last interval checked for starting events
+	checkedUntil time.Time
+	// resumeFrom is set by Reload to the end of the last interval checked before, so that
+	// reminders due in between are not lost when the interval changes
+	resumeFrom time.Time
+	// lastCheck is when the reminders were last checked
+	lastCheck time.Time
+	// acked holds the events acknowledged by id, with their start, which are not reminded of anymore
+	acked map[string]time.Time
+	// snoozed holds the reminders snoozed by id, which are shown again at their time instead of when due
+	snoozed map[string]snooze
+	// agendaUntil is the latest end of the ranges listed by Agenda, up to which the events of
+	// their ids are looked for
+	agendaUntil time.Time
+	// doNotDisturb stops showing reminders, until dndUntil if it is set
+	doNotDisturb bool
+	dndUntil     time.Time
+
+	// checkStarted is when the running check of the watcher started, in Unix nanoseconds, or 0
+	// while the watcher waits. It is not guarded by s.mu, which a stuck check may hold.
+	checkStarted atomic.Int64
+}
+
+// NewCalendarService creates a service watching the given calendars of a single provider.
+// If no calendar is given, the default calendar of the provider is watched.
+func NewCalendarService(provider CalendarProvider, ui UI, watchInterval time.Duration, calendars ...Calendar) *CalendarService {
+	return NewMultiAccountCalendarService([]Account{{Provider: provider, Calendars: calendars}}, ui, watchInterval)
 }
 
-func NewCalendarService(repo MicrosoftRepository, ui UI, watchInterval time.Duration) *CalendarService {
-	return &CalendarService{repo: repo, ui: ui, watchInterval: watchInterval}
+// NewMultiAccountCalendarService creates a service merging the events of several accounts.
+func NewMultiAccountCalendarService(accounts []Account, ui UI, watchInterval time.Duration) *CalendarService {
+	withDefaultCalendars(accounts)
+	caches := make([][]calendarCache, len(accounts))
+	for i := range accounts {
+		caches[i] = make([]calendarCache, len(accounts[i].Calendars))
+	}
+	return &CalendarService{
+		accounts:      accounts,
+		ui:            ui,
+		watchInterval: watchInterval,
+		pushed:        map[string]bool{},
+		caches:        caches,
+		notified:      map[string]time.Time{},
+		acked:         map[string]time.Time{},
+		snoozed:       map[string]snooze{},
+	}
 }
 
-func (s *CalendarService) WaitUntilNextInterval() {
+// withDefaultCalendars makes the accounts without calendars watch their default calendar.
+func withDefaultCalendars(accounts []Account) {
+	for i := range accounts {
+		if len(accounts[i].Calendars) == 0 {
+			accounts[i].Calendars = []Calendar{{}}
+		}
+	}
+}
+
+// Reload replaces the accounts, the UI, the interval and the filter at once, while the
+// service is running. The cached events of the calendars whose provider is kept, the
+// accounts updated by change notifications and the ledger of the reminders shown are
+// kept, so that no reminder is shown twice or lost.
+func (s *CalendarService) Reload(accounts []Account, ui UI, watchInterval time.Duration, filter Filter) {
+	withDefaultCalendars(accounts)
+	caches := make([][]calendarCache, len(accounts))
+	for i, account := range accounts {
+		caches[i] = make([]calendarCache, len(account.Calendars))
+		for j, calendar := range account.Calendars {
+			caches[i][j] = s.cachedEvents(account, calendar)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = accounts
+	s.caches = caches
+	s.generation++
+	s.ui = ui
+	s.watchInterval = watchInterval
+	s.filter = filter
+	if s.resumeFrom.IsZero() {
+		s.resumeFrom = s.checkedUntil
+	}
+}
+
+// cachedEvents returns the cache of the calendar if it was watched with the same provider.
+func (s *CalendarService) cachedEvents(account Account, calendar Calendar) calendarCache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, old := range s.accounts {
+		if old.Name != account.Name || old.Provider != account.Provider {
+			continue
+		}
+		for j, oldCalendar := range old.Calendars {
+			if oldCalendar.ID == calendar.ID {
+				return s.caches[i][j]
+			}
+		}
+	}
+	return calendarCache{}
+}
+
+// SetPushEnabled switches the account between change notifications and polling.
+func (s *CalendarService) SetPushEnabled(account string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushed[account] = enabled
+	if enabled {
+		log.Printf("Account %q is now updated by change notifications", account)
+	} else {
+		log.Printf("Account %q is now polled", account)
+	}
+}
+
+// SetFilter sets the filter of the events reminded of.
+func (s *CalendarService) SetFilter(filter Filter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = filter
+}
+
+// Refresh refetches the events of the account which are covered by change notifications.
+func (s *CalendarService) Refresh(ctx context.Context, account string) {
+	s.mu.Lock()
+	for i := range s.accounts {
+		if s.accounts[i].Name != account {
+			continue
+		}
+		for j, calendar := range s.accounts[i].Calendars {
+			if calendar.Pushable {
+				s.caches[i][j].valid = false
+			}
+		}
+	}
+	s.mu.Unlock()
+	s.fetchAccounts(ctx, true, account)
+}
+
+// isFresh reports whether the cached events of a calendar can be used instead of fetching them.
+// It must be called with s.mu held.
+func (s *CalendarService) isFresh(accountIndex, calendarIndex int, now time.Time) bool {
+	account := s.accounts[accountIndex]
+	cache := s.caches[accountIndex][calendarIndex]
+	// The calendar view covers the current day, so it is refetched when the day changes
+	return s.pushed[account.Name] && account.Calendars[calendarIndex].Pushable && cache.valid &&
+		now.Sub(cache.fetchedAt) < resyncInterval &&
+		startOfDay(now).Equal(startOfDay(cache.fetchedAt))
+}
+
+// accountFetch is a request for the events of the calendars of an account, planned with s.mu
+// held and sent without it, so that a slow provider doesn't block the service.
+type accountFetch struct {
+	account Account
+	// accountIndex and generation identify the account in s.accounts
+	accountIndex int
+	generation   int
+	// indexes are the indexes in the account of the calendars of ids
+	indexes []int
+	ids     []string
+	now     time.Time
+}
+
+// fetchAccounts updates the cached events of the calendars of the accounts, in a single request
+// per account. All accounts are fetched if no name is given.
+// Calendars kept up to date by change notifications are not fetched, and if
+// pushableOnly is set, neither are the calendars which are polled.
+// The errors, which are logged, are also returned.
+// It must be called without s.mu held, as it is released while waiting for the providers.
+func (s *CalendarService) fetchAccounts(ctx context.Context, pushableOnly bool, names ...string) error {
+	s.mu.Lock()
+	var fetches []accountFetch
 	now := xtime.Now()
-	now = now.Truncate(time.Duration(s.watchInterval))
-	next := now.Add(s.watchInterval)
-	time.Sleep(time.Until(next))
+	for i, account := range s.accounts {
+		if len(names) > 0 && !slices.Contains(names, account.Name) {
+			continue
+		}
+		fetch := accountFetch{account: account, accountIndex: i, generation: s.generation, now: now}
+		for j, calendar := range account.Calendars {
+			if calendar.Policy.Disabled || s.isFresh(i, j, now) || (pushableOnly && !calendar.Pushable) {
+				continue
+			}
+			fetch.indexes = append(fetch.indexes, j)
+			fetch.ids = append(fetch.ids, calendar.ID)
+		}
+		if len(fetch.ids) > 0 {
+			fetches = append(fetches, fetch)
+		}
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, fetch := range fetches {
+		if err := s.fetchAccount(ctx, fetch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fetchAccount sends the request of the fetch, and caches the events it returns unless the
+// accounts were reloaded meanwhile.
+func (s *CalendarService) fetchAccount(ctx context.Context, fetch accountFetch) error {
+	account, ids := fetch.account, fetch.ids
+	var calendars []Calendar
+	for _, j := range fetch.indexes {
+		calendars = append(calendars, account.Calendars[j])
+	}
+	start, end := viewRange(fetch.now, calendars)
+	fetchStart := time.Now()
+	views, err := account.Provider.FetchCalendarViews(ctx, ids, start, end)
+	metrics.FetchDuration.WithLabelValues(account.Name).Observe(time.Since(fetchStart).Seconds())
+	if err == nil && len(views) != len(ids) {
+		err = fmt.Errorf("got %d calendar views for %d calendars", len(views), len(ids))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The calendars of the account may have changed
+	current := fetch.generation == s.generation
+	caches := s.caches[fetch.accountIndex]
+	if err != nil {
+		log.Printf("Error fetching calendar events of account %q: %v", account.Name, err)
+		metrics.FetchErrors.WithLabelValues(account.Name).Add(float64(len(ids)))
+		for _, j := range fetch.indexes {
+			if current {
+				caches[j].valid = false
+			}
+		}
+		return fmt.Errorf("account %q: %w", account.Name, err)
+	}
+
+	var errs []error
+	for k, j := range fetch.indexes {
+		if views[k].Err != nil {
+			log.Printf("Error fetching calendar events from %q of account %q: %v", ids[k], account.Name, views[k].Err)
+			if current {
+				caches[j].valid = false
+			}
+			metrics.FetchErrors.WithLabelValues(account.Name).Inc()
+			errs = append(errs, fmt.Errorf("calendar %q of account %q: %w", ids[k], account.Name, views[k].Err))
+			continue
+		}
+		if current {
+			caches[j] = calendarCache{events: views[k].Events, fetchedAt: fetch.now, valid: true}
+		}
+		metrics.EventsFetched.WithLabelValues(account.Name).Add(float64(len(views[k].Events)))
+	}
+	return errors.Join(errs...)
+}
+
+// WaitUntilNextInterval sleeps until the start of the next interval, or returns the error of ctx
+// if it is done before.
+func (s *CalendarService) WaitUntilNextInterval(ctx context.Context) error {
+	s.mu.Lock()
+	watchInterval := s.watchInterval
+	s.mu.Unlock()
+
+	now := xtime.Now()
+	now = now.Truncate(watchInterval)
+	next := now.Add(watchInterval)
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (s *CalendarService) isSameTime(t1, t2 time.Time) bool {
@@ -40,69 +431,371 @@ func (s *CalendarService) isSameTime(t1, t2 time.Time) bool {
 	return t1.Equal(t2)
 }
 
-func (s *CalendarService) FetchAndDisplayEvents() {
-	events, err := s.repo.FetchCalendarEvents()
-	if err != nil {
-		log.Printf("Error fetching calendar events: %v", err)
+func (s *CalendarService) FetchAndDisplayEvents(ctx context.Context) {
+	filteredEvents, dues := s.findStartingEvents(ctx)
+	if len(filteredEvents) <= 0 {
+		log.Println("No meetings found at this time.")
+		return
+	}
+
+	s.mu.Lock()
+	ui := s.ui
+	s.mu.Unlock()
+	ui.ShowMeetingReminder(ctx, filteredEvents)
+	if ctx.Err() != nil {
 		return
 	}
 
+	metrics.RemindersFired.Add(float64(len(filteredEvents)))
+	now := xtime.Now()
+	for _, due := range dues {
+		metrics.ReminderLateness.Observe(max(now.Sub(due), 0).Seconds())
+	}
+}
+
+// findStartingEvents returns the events whose reminder is due in the current interval, and
+// when each reminder was due.
+func (s *CalendarService) findStartingEvents(ctx context.Context) ([]ui.UIEvents, []time.Time) {
 	var filteredEvents []ui.UIEvents
+	var dues []time.Time
+	// Events shared across calendars or accounts (e.g. an invitation that also
+	// shows up in a delegated calendar) are reminded only once.
+	seen := map[string]bool{}
 
-	for _, event := range events {
-		start, ok := event["start"].(map[string]interface{})
-		if !ok {
-			log.Printf("Invalid event format: missing 'start' field: %+v", event)
-			continue
+	s.mu.Lock()
+	now := xtime.Now()
+	quiet := s.filter.isQuiet(now) || s.isDoNotDisturb(now)
+	s.mu.Unlock()
+	// The lock is not held while fetching, so that the control API stays responsive
+	if !quiet {
+		s.fetchAccounts(ctx, false)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	intervalStart := now.Truncate(s.watchInterval)
+	intervalEnd := intervalStart.Add(s.watchInterval)
+	defer func() {
+		s.lastCheck = now
+		s.checkedUntil = intervalEnd
+		s.resumeFrom = time.Time{}
+		for key, due := range s.notified {
+			if due.Before(intervalStart) {
+				delete(s.notified, key)
+			}
+		}
+		// Events of the previous days are not fetched anymore
+		for id, start := range s.acked {
+			if start.Before(intervalStart.Add(-24 * time.Hour)) {
+				delete(s.acked, id)
+			}
+		}
+	}()
+
+	if s.filter.isQuiet(now) {
+		log.Println("In quiet hours, no reminder is shown.")
+		return nil, nil
+	}
+	if s.isDoNotDisturb(now) {
+		log.Println("Do not disturb is on, no reminder is shown.")
+		return nil, nil
+	}
+
+	for i, account := range s.accounts {
+		for j, calendar := range account.Calendars {
+			cache := s.caches[i][j]
+			if calendar.Policy.Disabled || !cache.valid {
+				continue
+			}
+
+			for _, event := range cache.events {
+				key := eventKey(event, calendar, account)
+				if event.UID != "" {
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				id := eventID(key)
+				if _, ok := s.acked[id]; ok {
+					continue
+				}
+				if _, ok := s.snoozed[id]; ok {
+					continue
+				}
+
+				if s.filter.excludes(event) {
+					continue
+				}
+				metrics.RemindersMissed.Add(float64(s.countMissed(event, calendar.Policy, now)))
+				due, ok := s.isDue(event, calendar.Policy)
+				if !ok {
+					continue
+				}
+				key += fmt.Sprintf("-%d", due.Unix())
+				if _, ok := s.notified[key]; ok {
+					continue
+				}
+				s.notified[key] = due
+
+				log.Println("Meeting found:", event.Title, "at", event.Start.Format("15:04"))
+				filteredEvents = append(filteredEvents, toUIEvent(event, calendar, account))
+				dues = append(dues, due)
+			}
+		}
+	}
+
+	for id, snooze := range s.snoozed {
+		if snooze.until.Before(intervalEnd) {
+			delete(s.snoozed, id)
+			log.Println("Snoozed meeting found:", snooze.event.Title, "at", snooze.event.StartTime.Format("15:04"))
+			filteredEvents = append(filteredEvents, snooze.event)
+			dues = append(dues, snooze.until)
+		}
+	}
+
+	metrics.RemindersScheduled.Add(float64(len(filteredEvents)))
+	return filteredEvents, dues
+}
+
+// eventKey identifies an occurrence of the event. Occurrences of a recurring event share the
+// UID, which also identifies the event across calendars and accounts. Events without a UID are
+// identified in their calendar by their title.
+func eventKey(event models.Event, calendar Calendar, account Account) string {
+	if event.UID != "" {
+		return fmt.Sprintf("%s@%d", event.UID, event.Start.Unix())
+	}
+	return fmt.Sprintf("%s/%s/%s@%d", account.Name, calendar.ID, event.Title, event.Start.Unix())
+}
+
+// eventID returns the short id of the event of the key, by which it is snoozed or acknowledged.
+func eventID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Upcoming fetches the events of the enabled calendars between start and end, ordered by
+// their start, like for an agenda. Events found in several calendars are listed once.
+// Events excluded by the filter are left out, but not those in quiet hours.
+// The events of the calendars which could be fetched are returned along with the errors of the others.
+func (s *CalendarService) Upcoming(ctx context.Context, start, end time.Time) ([]ui.UIEvents, error) {
+	agenda, err := s.Agenda(ctx, start, end)
+	events := make([]ui.UIEvents, len(agenda))
+	for i, event := range agenda {
+		events[i] = event.UIEvents
+	}
+	return events, err
+}
+
+// AgendaEvent is an event listed by Agenda, with the id it is snoozed or acknowledged by.
+type AgendaEvent struct {
+	ID string
+	ui.UIEvents
+}
+
+// Agenda is Upcoming with the ids of the events.
+func (s *CalendarService) Agenda(ctx context.Context, start, end time.Time) ([]AgendaEvent, error) {
+	s.mu.Lock()
+	filter := s.filter
+	accounts := s.accounts
+	if end.After(s.agendaUntil) {
+		s.agendaUntil = end
+	}
+	s.mu.Unlock()
+
+	var events []AgendaEvent
+	var errs []error
+	seen := map[string]bool{}
+	for _, account := range accounts {
+		var calendars []Calendar
+		var ids []string
+		for _, calendar := range account.Calendars {
+			if !calendar.Policy.Disabled {
+				calendars = append(calendars, calendar)
+				ids = append(ids, calendar.ID)
+			}
 		}
-		startStr, ok := start["dateTime"].(string)
-		if !ok {
-			log.Printf("Invalid event format: 'start.dateTime' is not a string: %+v", event)
+		if len(ids) == 0 {
 			continue
 		}
 
-		startTime, err := parseTime(startStr)
+		views, err := account.Provider.FetchCalendarViews(ctx, ids, start, end)
+		if err == nil && len(views) != len(ids) {
+			err = fmt.Errorf("got %d calendar views for %d calendars", len(views), len(ids))
+		}
 		if err != nil {
-			log.Printf("Error parsing start time for event: %+v, error: %v", event, err)
+			errs = append(errs, fmt.Errorf("account %q: %w", account.Name, err))
 			continue
 		}
+		for k, view := range views {
+			if view.Err != nil {
+				errs = append(errs, fmt.Errorf("calendar %q of account %q: %w", ids[k], account.Name, view.Err))
+				continue
+			}
+			for _, event := range view.Events {
+				key := eventKey(event, calendars[k], account)
+				if event.UID != "" {
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+				}
+				// Events in progress at start are included by the providers
+				if event.Start.Before(start) || filter.excludes(event) {
+					continue
+				}
+				events = append(events, AgendaEvent{ID: eventID(key), UIEvents: toUIEvent(event, calendars[k], account)})
+			}
+		}
+	}
 
-		subject, ok := event["subject"].(string)
-		if !ok {
-			log.Printf("Invalid event format: 'subject' is not a string: %+v", event)
-			continue
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartTime.Before(events[j].StartTime)
+	})
+	return events, errors.Join(errs...)
+}
+
+// toUIEvent describes the event of the calendar for the UI.
+func toUIEvent(event models.Event, calendar Calendar, account Account) ui.UIEvents {
+	link := event.JoinURL
+	if link == "" {
+		link = event.Location
+	}
+	attendance, needsResponse := summarizeAttendees(event)
+	return ui.UIEvents{
+		Title:         event.Title,
+		StartTime:     event.Start,
+		Link:          link,
+		Calendar:      calendar.Name,
+		Color:         calendar.Color,
+		Account:       account.Name,
+		Organizer:     organizerName(event),
+		Attendance:    attendance,
+		NeedsResponse: needsResponse,
+	}
+}
+
+// StartEventWatcher shows the reminders due in each interval until ctx is canceled,
+// which also cancels the requests in flight.
+func (s *CalendarService) StartEventWatcher(ctx context.Context) {
+	log.Println("Starting calendar event watcher...")
+	for s.WaitUntilNextInterval(ctx) == nil {
+		s.checkStarted.Store(time.Now().UnixNano())
+		s.FetchAndDisplayEvents(ctx)
+		s.checkStarted.Store(0)
+	}
+	log.Println("Calendar event watcher stopped")
+}
+
+// CheckDuration returns how long the watcher has been checking the events, or 0 while it
+// waits for the next interval.
+func (s *CalendarService) CheckDuration() time.Duration {
+	started := s.checkStarted.Load()
+	if started == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, started))
+}
+
+// alarmLookahead is how long after the current day the events of the calendars using alarms are
+// fetched, as their alarms may be due today.
+const alarmLookahead = 24 * time.Hour
+
+// viewRange returns the range of events of the calendars fetched at now, which is the current
+// local day, extended by the largest lead time of the calendars, so that the reminders due today of the
+// events starting early the next day are not missed.
+func viewRange(now time.Time, calendars []Calendar) (time.Time, time.Time) {
+	var lookahead time.Duration
+	for _, calendar := range calendars {
+		lookahead = max(lookahead, calendar.Policy.LeadTime)
+		if calendar.Policy.UseAlarms {
+			lookahead = max(lookahead, alarmLookahead)
 		}
+	}
+	start := startOfDay(now)
+	return start, start.AddDate(0, 0, 1).Add(lookahead - time.Second)
+}
 
-		if !s.isSameTime(startTime, xtime.Now()) {
-			continue
+// startOfDay returns the midnight starting the day of t in its location.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// isDue reports whether a reminder of the event is due in the current interval, and when.
+// It must be called with s.mu held.
+func (s *CalendarService) isDue(event models.Event, policy ReminderPolicy) (time.Time, bool) {
+	now := xtime.Now()
+	for _, due := range reminderTimes(event, policy) {
+		if s.isSameTime(due, now) || s.isResumed(due, now) {
+			return due, true
 		}
+	}
+	return time.Time{}, false
+}
 
-		log.Println("Meeting found:", subject, "at", startTime.Format("15:04"))
-		location, _ := event["location"].(map[string]interface{})["displayName"].(string)
-		filteredEvents = append(filteredEvents, ui.UIEvents{
-			Title:     subject,
-			StartTime: startTime,
-			Link:      location,
-		})
+// reminderTimes returns when the reminders of the event are due.
+func reminderTimes(event models.Event, policy ReminderPolicy) []time.Time {
+	dues := []time.Time{event.Start.Add(-policy.LeadTime)}
+	if policy.UseAlarms {
+		for _, alarm := range event.Alarms {
+			dues = append(dues, event.Start.Add(-alarm))
+		}
 	}
+	return dues
+}
 
-	if len(filteredEvents) <= 0 {
-		log.Println("No meetings found at this time.")
-		return
+// countMissed returns the number of reminders of the event which were due in the intervals
+// skipped since the last check, like while the computer was asleep.
+func (s *CalendarService) countMissed(event models.Event, policy ReminderPolicy, now time.Time) int {
+	if s.checkedUntil.IsZero() || !s.resumeFrom.IsZero() {
+		return 0
+	}
+	missed := 0
+	for _, due := range reminderTimes(event, policy) {
+		if !due.Before(s.checkedUntil) && due.Before(now.Truncate(s.watchInterval)) {
+			missed++
+		}
 	}
+	return missed
+}
 
-	s.ui.ShowMeetingReminder(filteredEvents)
+// isResumed reports whether due is between the last interval checked before Reload and the
+// current interval, which are not contiguous if the interval has changed.
+func (s *CalendarService) isResumed(due, now time.Time) bool {
+	return !s.resumeFrom.IsZero() && !due.Before(s.resumeFrom) && due.Before(now.Truncate(s.watchInterval))
 }
 
-func (s *CalendarService) StartEventWatcher() {
-	log.Println("Starting calendar event watcher...")
-	for {
-		s.WaitUntilNextInterval()
-		s.FetchAndDisplayEvents()
+func organizerName(event models.Event) string {
+	if event.IsOrganizer {
+		return "you"
 	}
+	return event.Organizer
 }
 
-func parseTime(s string) (time.Time, error) {
-	layout := "2006-01-02T15:04:05.0000000"
-	return time.Parse(layout, s)
+// summarizeAttendees counts the responses of the attendees, and tells
+// whether the signed-in user has yet to respond.
+func summarizeAttendees(event models.Event) (attendance ui.Attendance, needsResponse bool) {
+	for _, attendee := range event.Attendees {
+		// Rooms and equipment are not counted as people
+		if attendee.Type == models.AttendeeResource {
+			continue
+		}
+		switch attendee.Response {
+		case models.ResponseAccepted:
+			attendance.Accepted++
+		case models.ResponseTentative:
+			attendance.Tentative++
+		case models.ResponseDeclined:
+			attendance.Declined++
+		case models.ResponseOrganizer:
+		default:
+			attendance.NotResponded++
+		}
+	}
+
+	// "none" is also returned for events without attendees, which need no response
+	needsResponse = event.Response == models.ResponseNotResponded ||
+		(event.Response == models.ResponseNone && len(event.Attendees) > 0 && !event.IsOrganizer)
+	return attendance, needsResponse
 }
@@ -1,32 +1,35 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"regexp"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/kajikentaro/meeting-reminder/metrics"
 	"github.com/kajikentaro/meeting-reminder/mocks"
+	"github.com/kajikentaro/meeting-reminder/models"
 	"github.com/kajikentaro/meeting-reminder/ui"
 	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
-func createMockEvent(time time.Time, subject string) map[string]interface{} {
-	return map[string]interface{}{
-		"start": map[string]interface{}{
-			"dateTime": time.Format(TIME_LAYOUT),
-		},
-		"subject": subject,
-		"location": map[string]interface{}{
-			"displayName": "Test Location",
-		},
+func createMockEvent(time time.Time, subject string) models.Event {
+	return models.Event{
+		Title:    subject,
+		Start:    time,
+		End:      time,
+		Location: "Test Location",
 	}
 }
 
-var TIME_LAYOUT = "2006-01-02T15:04:05.0000000"
-
 func TestFetchAndDisplayEvents(t *testing.T) {
 	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
 	xtime.Mock(NOW)
@@ -79,14 +82,14 @@ func TestFetchAndDisplayEvents(t *testing.T) {
 		t.Run(tc.title, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			events := []map[string]interface{}{}
+			events := []models.Event{}
 
 			for _, event := range tc.events {
 				events = append(events, createMockEvent(event.start, "Test Meeting"))
 			}
 
-			repo := mocks.NewMockMicrosoftRepository(ctrl)
-			repo.EXPECT().FetchCalendarEvents().Return(events, nil)
+			provider := mocks.NewMockCalendarProvider(ctrl)
+			provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: events}}, nil)
 			uiMock := mocks.NewMockUI(ctrl)
 			expectedEvents := []ui.UIEvents{}
 			for _, event := range tc.events {
@@ -99,13 +102,13 @@ func TestFetchAndDisplayEvents(t *testing.T) {
 				}
 			}
 			if len(expectedEvents) > 0 {
-				uiMock.EXPECT().ShowMeetingReminder(expectedEvents).Times(1)
+				uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), expectedEvents).Times(1)
 			} else {
-				uiMock.EXPECT().ShowMeetingReminder(gomock.Any()).Times(0)
+				uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), gomock.Any()).Times(0)
 			}
 
-			service := NewCalendarService(repo, uiMock, tc.watchInterval)
-			service.FetchAndDisplayEvents()
+			service := NewCalendarService(provider, uiMock, tc.watchInterval)
+			service.FetchAndDisplayEvents(context.Background())
 		})
 	}
 }
@@ -120,16 +123,16 @@ func TestMultipleEventsAtSameTime(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	events := []map[string]interface{}{
+	events := []models.Event{
 		createMockEvent(eventTime, "Event A"),
 		createMockEvent(eventTime, "Event B"),
 	}
 
-	repo := mocks.NewMockMicrosoftRepository(ctrl)
-	repo.EXPECT().FetchCalendarEvents().Return(events, nil)
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: events}}, nil)
 	uiMock := mocks.NewMockUI(ctrl)
 
-	uiMock.EXPECT().ShowMeetingReminder([]ui.UIEvents{
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
 		{
 			Title:     "Event A",
 			StartTime: eventTime,
@@ -142,23 +145,111 @@ func TestMultipleEventsAtSameTime(t *testing.T) {
 		},
 	}).Times(1)
 
-	service := NewCalendarService(repo, uiMock, time.Minute)
-	service.FetchAndDisplayEvents()
+	service := NewCalendarService(provider, uiMock, time.Minute)
+	service.FetchAndDisplayEvents(context.Background())
 }
 
 func TestFetchAndDisplayEvents_NoEvents(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	repo := mocks.NewMockMicrosoftRepository(ctrl)
+	provider := mocks.NewMockCalendarProvider(ctrl)
 	uiMock := mocks.NewMockUI(ctrl)
 
-	service := NewCalendarService(repo, uiMock, time.Minute)
+	service := NewCalendarService(provider, uiMock, time.Minute)
+
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{}}, nil)
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), gomock.Any()).Times(0)
+
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestFetchRange(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	repo.EXPECT().FetchCalendarEvents().Return([]map[string]interface{}{}, nil)
-	uiMock.EXPECT().ShowMeetingReminder(gomock.Any()).Times(0)
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{""},
+		time.Date(2033, 3, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2033, 3, 3, 23, 59, 59, 0, time.UTC),
+	).Return([]models.CalendarView{{}}, nil)
 
-	service.FetchAndDisplayEvents()
+	service := NewCalendarService(provider, mocks.NewMockUI(ctrl), time.Minute)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestReminderBeforeMidnight(t *testing.T) {
+	xtime.Mock(time.Date(2033, 3, 3, 23, 55, 10, 0, time.UTC))
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The view of the calendars reaches the events of the next day whose reminders are due today
+	event := createMockEvent(time.Date(2033, 3, 4, 0, 5, 0, 0, time.UTC), "Early")
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"lead-time", "alarms"},
+		time.Date(2033, 3, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2033, 3, 4, 23, 59, 59, 0, time.UTC),
+	).Return([]models.CalendarView{{Events: []models.Event{event}}, {}}, nil)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"lead-time"},
+		time.Date(2033, 3, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2033, 3, 4, 0, 9, 59, 0, time.UTC),
+	).Return([]models.CalendarView{{Events: []models.Event{event}}}, nil)
+	uiMock := mocks.NewMockUI(ctrl)
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Early", StartTime: event.Start, Link: "Test Location"},
+	}).Times(1)
+
+	service := NewCalendarService(provider, uiMock, time.Minute,
+		Calendar{ID: "lead-time", Policy: ReminderPolicy{LeadTime: 10 * time.Minute}},
+		Calendar{ID: "alarms", Policy: ReminderPolicy{UseAlarms: true}},
+	)
+	service.FetchAndDisplayEvents(context.Background())
+
+	service.Reload([]Account{{Provider: provider, Calendars: []Calendar{
+		{ID: "lead-time", Policy: ReminderPolicy{LeadTime: 10 * time.Minute}},
+	}}}, uiMock, time.Minute, Filter{})
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestViewRangeInLocalDay(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("JST", 9*60*60)
+	defer func() { time.Local = local }()
+	xtime.Mock(time.Date(2033, 3, 3, 23, 55, 10, 0, time.Local))
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The view starts at the local midnight, not at the midnight of UTC
+	event := createMockEvent(time.Date(2033, 3, 4, 0, 5, 0, 0, time.Local), "Early")
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"lead-time"},
+		time.Date(2033, 3, 3, 0, 0, 0, 0, time.Local),
+		time.Date(2033, 3, 4, 0, 9, 59, 0, time.Local),
+	).Return([]models.CalendarView{{Events: []models.Event{event}}}, nil)
+	uiMock := mocks.NewMockUI(ctrl)
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Early", StartTime: event.Start, Link: "Test Location"},
+	}).Times(1)
+
+	service := NewCalendarService(provider, uiMock, time.Minute,
+		Calendar{ID: "lead-time", Policy: ReminderPolicy{LeadTime: 10 * time.Minute}, Pushable: true},
+	)
+	service.FetchAndDisplayEvents(context.Background())
+
+	// The cache of a pushed calendar is reset at the local midnight
+	service.SetPushEnabled("", true)
+	before := time.Date(2033, 3, 3, 23, 59, 0, 0, time.Local)
+	service.caches[0][0].fetchedAt = before
+	assert.True(t, service.isFresh(0, 0, before.Add(30*time.Second)))
+	assert.False(t, service.isFresh(0, 0, before.Add(90*time.Second)))
 }
 
 func TestIsSameTime(t *testing.T) {
@@ -179,7 +270,7 @@ func TestWaitUntilNextInterval(t *testing.T) {
 	var lock sync.Mutex
 
 	go func() {
-		service.WaitUntilNextInterval()
+		service.WaitUntilNextInterval(context.Background())
 
 		lock.Lock()
 		isFinished = true
@@ -196,3 +287,458 @@ func TestWaitUntilNextInterval(t *testing.T) {
 	require.True(t, isFinished)
 	lock.Unlock()
 }
+
+func TestStartEventWatcherStopsOnCancel(t *testing.T) {
+	service := NewCalendarService(nil, nil, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		service.StartEventWatcher(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("StartEventWatcher did not return after cancel")
+	}
+}
+
+func TestMultipleCalendars(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	eventTime := time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	duplicated := createMockEvent(eventTime, "Team Sync")
+	duplicated.UID = "uid-team-sync"
+
+	// All calendars but the disabled one are fetched in a single request
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"primary", "shared", "early", "failing"}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{duplicated}},
+		{Events: []models.Event{
+			duplicated,
+			createMockEvent(eventTime, "Alice 1on1"),
+		}},
+		{Events: []models.Event{
+			createMockEvent(eventTime.Add(10*time.Minute), "Deploy"),
+		}},
+		{Err: errors.New("API request failed with status: 404 Not Found")},
+	}, nil)
+	uiMock := mocks.NewMockUI(ctrl)
+
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{
+			Title:     "Team Sync",
+			StartTime: eventTime,
+			Link:      "Test Location",
+			Calendar:  "Work",
+			Color:     "#0078D7",
+		},
+		{
+			Title:     "Alice 1on1",
+			StartTime: eventTime,
+			Link:      "Test Location",
+			Calendar:  "Alice",
+			Color:     "green",
+		},
+		{
+			Title:     "Deploy",
+			StartTime: eventTime.Add(10 * time.Minute),
+			Link:      "Test Location",
+			Calendar:  "Ops",
+		},
+	}).Times(1)
+
+	service := NewCalendarService(provider, uiMock, time.Minute,
+		Calendar{ID: "primary", Name: "Work", Color: "#0078D7"},
+		Calendar{ID: "shared", Name: "Alice", Color: "green"},
+		Calendar{ID: "muted", Name: "Muted", Policy: ReminderPolicy{Disabled: true}},
+		Calendar{ID: "early", Name: "Ops", Policy: ReminderPolicy{LeadTime: 10 * time.Minute}},
+		Calendar{ID: "failing", Name: "Failing"},
+	)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestUseAlarms(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// An event in 15 minutes with an alarm 15 minutes before it
+	withAlarm := createMockEvent(time.Date(2033, 3, 3, 3, 18, 0, 0, time.UTC), "Planning")
+	withAlarm.Alarms = []time.Duration{15 * time.Minute}
+	starting := createMockEvent(time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC), "Standup")
+	// Alarms are ignored unless the calendar uses them
+	ignoredAlarm := withAlarm
+	ignoredAlarm.Title = "Ignored Alarm"
+
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"alarms", "lead-time"}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{withAlarm, starting}},
+		{Events: []models.Event{ignoredAlarm}},
+	}, nil)
+	uiMock := mocks.NewMockUI(ctrl)
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Planning", StartTime: withAlarm.Start, Link: "Test Location"},
+		{Title: "Standup", StartTime: starting.Start, Link: "Test Location"},
+	}).Times(1)
+
+	service := NewCalendarService(provider, uiMock, time.Minute,
+		Calendar{ID: "alarms", Policy: ReminderPolicy{UseAlarms: true}},
+		Calendar{ID: "lead-time"},
+	)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestMultipleAccounts(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	eventTime := time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The same meeting is invited to both tenants
+	shared := createMockEvent(eventTime, "Steering Committee")
+	shared.UID = "uid-steering"
+
+	contoso := mocks.NewMockCalendarProvider(ctrl)
+	contoso.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{
+		shared,
+		createMockEvent(eventTime, "Contoso Standup"),
+	}}}, nil)
+	fabrikam := mocks.NewMockCalendarProvider(ctrl)
+	fabrikam.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{
+		shared,
+		createMockEvent(eventTime, "Fabrikam Review"),
+	}}}, nil)
+	failing := mocks.NewMockCalendarProvider(ctrl)
+	failing.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return(nil, errors.New("token expired"))
+	uiMock := mocks.NewMockUI(ctrl)
+
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{
+			Title:     "Steering Committee",
+			StartTime: eventTime,
+			Link:      "Test Location",
+			Account:   "Contoso",
+		},
+		{
+			Title:     "Contoso Standup",
+			StartTime: eventTime,
+			Link:      "Test Location",
+			Account:   "Contoso",
+		},
+		{
+			Title:     "Fabrikam Review",
+			StartTime: eventTime,
+			Link:      "Test Location",
+			Account:   "Fabrikam",
+		},
+	}).Times(1)
+
+	service := NewMultiAccountCalendarService([]Account{
+		{Name: "Contoso", Provider: contoso},
+		{Name: "Broken", Provider: failing},
+		{Name: "Fabrikam", Provider: fabrikam},
+	}, uiMock, time.Minute)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestPushEnabledAccountUsesCache(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	eventTime := time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	uiMock := mocks.NewMockUI(ctrl)
+	service := NewMultiAccountCalendarService([]Account{{
+		Name:      "Contoso",
+		Provider:  provider,
+		Calendars: []Calendar{{ID: "own", Pushable: true}, {ID: "shared"}},
+	}}, uiMock, time.Minute)
+	service.SetPushEnabled("Contoso", true)
+
+	// The own calendar is fetched once and then served from the cache,
+	// while the shared calendar is not covered by notifications and keeps being polled.
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"own", "shared"}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{createMockEvent(eventTime, "Before Change")}},
+		{},
+	}, nil).Times(1)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"shared"}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{}}, nil).Times(2)
+	// The reminder is shown once, as it is in the ledger the second time
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Before Change", StartTime: eventTime, Link: "Test Location", Account: "Contoso"},
+	}).Times(1)
+	service.FetchAndDisplayEvents(context.Background())
+	service.FetchAndDisplayEvents(context.Background())
+
+	// A change notification refetches the own calendar
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"own"}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{createMockEvent(eventTime, "After Change")}},
+	}, nil).Times(1)
+	service.Refresh(context.Background(), "Contoso")
+
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "After Change", StartTime: eventTime, Link: "Test Location", Account: "Contoso"},
+	}).Times(1)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	standup := createMockEvent(time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC), "Standup")
+	review := createMockEvent(time.Date(2033, 3, 3, 3, 6, 0, 0, time.UTC), "Review")
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{standup, review}},
+	}, nil).AnyTimes()
+	oldUI := mocks.NewMockUI(ctrl)
+	newUI := mocks.NewMockUI(ctrl)
+
+	xtime.Mock(time.Date(2033, 3, 3, 3, 0, 0, 0, time.UTC))
+	defer xtime.Unmock()
+	service := NewCalendarService(provider, oldUI, 5*time.Minute)
+	oldUI.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Standup", StartTime: standup.Start, Link: "Test Location"},
+	}).Times(1)
+	service.FetchAndDisplayEvents(context.Background())
+
+	// With a shorter interval, the standup is not reminded again
+	service.Reload([]Account{{Provider: provider}}, newUI, time.Minute, Filter{})
+	xtime.Mock(time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC))
+	newUI.EXPECT().ShowMeetingReminder(gomock.Any(), gomock.Any()).Times(0)
+	service.FetchAndDisplayEvents(context.Background())
+
+	// With a longer interval, the review due before the next check is not lost
+	service.Reload([]Account{{Provider: provider}}, newUI, 10*time.Minute, Filter{})
+	xtime.Mock(time.Date(2033, 3, 3, 3, 10, 0, 0, time.UTC))
+	newUI.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Review", StartTime: review.Start, Link: "Test Location"},
+	}).Times(1)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestAttendeeInsight(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	eventTime := time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	attendee := func(response models.ResponseStatus, attendeeType models.AttendeeType) models.Attendee {
+		return models.Attendee{Type: attendeeType, Response: response}
+	}
+
+	invited := createMockEvent(eventTime, "Design Review")
+	invited.Organizer = "Bob"
+	invited.Response = models.ResponseNotResponded
+	invited.Attendees = []models.Attendee{
+		attendee(models.ResponseAccepted, models.AttendeeRequired),
+		attendee(models.ResponseAccepted, models.AttendeeOptional),
+		attendee(models.ResponseTentative, models.AttendeeRequired),
+		attendee(models.ResponseDeclined, models.AttendeeRequired),
+		attendee(models.ResponseNone, models.AttendeeRequired),
+		attendee(models.ResponseAccepted, models.AttendeeResource),
+	}
+
+	organized := createMockEvent(eventTime, "My Meeting")
+	organized.IsOrganizer = true
+	organized.Response = models.ResponseOrganizer
+	organized.Attendees = []models.Attendee{attendee(models.ResponseAccepted, models.AttendeeRequired)}
+
+	// Feeds without the response of the user don't ask for one
+	unknown := createMockEvent(eventTime, "Feed Meeting")
+	unknown.Attendees = []models.Attendee{attendee(models.ResponseAccepted, models.AttendeeRequired)}
+
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{invited, organized, unknown}},
+	}, nil)
+	uiMock := mocks.NewMockUI(ctrl)
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{
+			Title:         "Design Review",
+			StartTime:     eventTime,
+			Link:          "Test Location",
+			Organizer:     "Bob",
+			Attendance:    ui.Attendance{Accepted: 2, Tentative: 1, Declined: 1, NotResponded: 1},
+			NeedsResponse: true,
+		},
+		{
+			Title:      "My Meeting",
+			StartTime:  eventTime,
+			Link:       "Test Location",
+			Organizer:  "you",
+			Attendance: ui.Attendance{Accepted: 1},
+		},
+		{
+			Title:      "Feed Meeting",
+			StartTime:  eventTime,
+			Link:       "Test Location",
+			Attendance: ui.Attendance{Accepted: 1},
+		},
+	}).Times(1)
+
+	service := NewCalendarService(provider, uiMock, time.Minute)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestUpcoming(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	start := time.Date(2033, 3, 3, 9, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	shared := createMockEvent(start.Add(2*time.Hour), "Review")
+	shared.UID = "uid-review"
+	inProgress := createMockEvent(start.Add(-time.Hour), "Workshop")
+
+	work := mocks.NewMockCalendarProvider(ctrl)
+	work.EXPECT().FetchCalendarViews(gomock.Any(), []string{"work", "team"}, start, end).Return([]models.CalendarView{
+		{Events: []models.Event{inProgress, shared}},
+		{Events: []models.Event{shared, createMockEvent(start.Add(time.Hour), "Standup")}},
+	}, nil)
+	failing := mocks.NewMockCalendarProvider(ctrl)
+	failing.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, start, end).Return(nil, errors.New("token expired"))
+
+	service := NewMultiAccountCalendarService([]Account{
+		{Name: "Contoso", Provider: work, Calendars: []Calendar{
+			{ID: "work", Name: "Work"},
+			{ID: "holidays", Policy: ReminderPolicy{Disabled: true}},
+			{ID: "team", Name: "Team"},
+		}},
+		{Name: "Broken", Provider: failing},
+	}, mocks.NewMockUI(ctrl), time.Minute)
+
+	events, err := service.Upcoming(context.Background(), start, end)
+	assert.ErrorContains(t, err, "token expired")
+	assert.Equal(t, []ui.UIEvents{
+		{Title: "Standup", StartTime: start.Add(time.Hour), Link: "Test Location", Calendar: "Team", Account: "Contoso"},
+		{Title: "Review", StartTime: start.Add(2 * time.Hour), Link: "Test Location", Calendar: "Work", Account: "Contoso"},
+	}, events)
+}
+
+func TestFilter(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	eventTime := time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC)
+	declined := createMockEvent(eventTime, "Town Hall")
+	declined.Response = models.ResponseDeclined
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{
+		createMockEvent(eventTime, "Focus time"),
+		declined,
+		createMockEvent(eventTime, "Standup"),
+	}}}, nil)
+	uiMock := mocks.NewMockUI(ctrl)
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Standup", StartTime: eventTime, Link: "Test Location"},
+	}).Times(1)
+
+	service := NewCalendarService(provider, uiMock, time.Minute)
+	service.SetFilter(Filter{
+		ExcludeTitles: []*regexp.Regexp{regexp.MustCompile("^Focus time$")},
+		SkipDeclined:  true,
+	})
+	service.FetchAndDisplayEvents(context.Background())
+
+	// No reminder is shown, nor are calendars fetched, in quiet hours
+	service.SetFilter(Filter{QuietHours: []QuietHours{{Start: 22 * time.Hour, End: 7 * time.Hour}}})
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestQuietHours(t *testing.T) {
+	// 2033-03-05 is a Saturday
+	night := QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour, Days: []time.Weekday{time.Friday, time.Saturday}}
+	lunch := QuietHours{Start: 12 * time.Hour, End: 13 * time.Hour}
+	testCases := []struct {
+		hours QuietHours
+		at    time.Time
+		quiet bool
+	}{
+		{night, time.Date(2033, 3, 5, 23, 0, 0, 0, time.UTC), true},
+		{night, time.Date(2033, 3, 5, 6, 59, 0, 0, time.UTC), true},
+		{night, time.Date(2033, 3, 5, 7, 0, 0, 0, time.UTC), false},
+		// Sunday night is not quiet, but the morning after Saturday night is
+		{night, time.Date(2033, 3, 6, 23, 0, 0, 0, time.UTC), false},
+		{night, time.Date(2033, 3, 6, 6, 0, 0, 0, time.UTC), true},
+		{night, time.Date(2033, 3, 7, 6, 0, 0, 0, time.UTC), false},
+		{lunch, time.Date(2033, 3, 7, 12, 30, 0, 0, time.UTC), true},
+		{lunch, time.Date(2033, 3, 7, 13, 0, 0, 0, time.UTC), false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.quiet, tc.hours.contains(tc.at), tc.at)
+	}
+}
+
+func TestReminderMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	standup := createMockEvent(time.Date(2033, 3, 3, 3, 1, 0, 0, time.UTC), "Standup")
+	review := createMockEvent(time.Date(2033, 3, 3, 3, 5, 0, 0, time.UTC), "Review")
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.CalendarView{
+		{Events: []models.Event{standup, review}},
+	}, nil).AnyTimes()
+	uiMock := mocks.NewMockUI(ctrl)
+	service := NewCalendarService(provider, uiMock, time.Minute)
+
+	scheduled, fired, missed := testutil.ToFloat64(metrics.RemindersScheduled), testutil.ToFloat64(metrics.RemindersFired), testutil.ToFloat64(metrics.RemindersMissed)
+	lateness := sampleCount(t, metrics.ReminderLateness)
+	fetched := testutil.ToFloat64(metrics.EventsFetched.WithLabelValues(""))
+
+	xtime.Mock(time.Date(2033, 3, 3, 3, 0, 10, 0, time.UTC))
+	defer xtime.Unmock()
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), gomock.Any()).Times(0)
+	service.FetchAndDisplayEvents(context.Background())
+
+	// The standup was due while asleep, and the review is shown 20 seconds late
+	xtime.Mock(time.Date(2033, 3, 3, 3, 5, 20, 0, time.UTC))
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), []ui.UIEvents{
+		{Title: "Review", StartTime: review.Start, Link: "Test Location"},
+	}).Times(1)
+	service.FetchAndDisplayEvents(context.Background())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RemindersScheduled)-scheduled)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RemindersFired)-fired)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.RemindersMissed)-missed)
+	assert.Equal(t, uint64(1), sampleCount(t, metrics.ReminderLateness)-lateness)
+	assert.Equal(t, 4.0, testutil.ToFloat64(metrics.EventsFetched.WithLabelValues(""))-fetched)
+}
+
+// sampleCount returns the number of values observed by the histogram.
+func sampleCount(t *testing.T, h prometheus.Histogram) uint64 {
+	var m dto.Metric
+	require.NoError(t, h.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
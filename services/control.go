@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/ui"
+	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+)
+
+// ErrEventNotFound is returned when snoozing or acknowledging an event which is neither among
+// the events of the current day nor among the upcoming ones.
+var ErrEventNotFound = errors.New("event not found among the upcoming events")
+
+// agendaLookahead is how long after now the events of the ids given by Agenda are looked for,
+// at least, which is the default period of the upcoming events of the control API.
+const agendaLookahead = 24 * time.Hour
+
+// snooze is a reminder shown again at a later time.
+type snooze struct {
+	event ui.UIEvents
+	until time.Time
+}
+
+// RefreshAll refetches the events of all calendars, including those updated by change notifications.
+func (s *CalendarService) RefreshAll(ctx context.Context) error {
+	s.mu.Lock()
+	for i := range s.accounts {
+		for j := range s.caches[i] {
+			s.caches[i][j].valid = false
+		}
+	}
+	s.mu.Unlock()
+	return s.fetchAccounts(ctx, false)
+}
+
+// Ack acknowledges the event of the id given by Agenda, which is not reminded of anymore.
+// It returns the event.
+func (s *CalendarService) Ack(ctx context.Context, id string) (ui.UIEvents, error) {
+	event, ok := s.findEvent(ctx, id)
+	if !ok {
+		return ui.UIEvents{}, fmt.Errorf("%w: %s", ErrEventNotFound, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked[id] = event.StartTime
+	delete(s.snoozed, id)
+	log.Printf("Meeting acknowledged: %s at %s", event.Title, event.StartTime.Format("15:04"))
+	return event, nil
+}
+
+// Snooze shows the reminder of the event of the id given by Agenda again after d, instead of
+// when it is due. It returns the event.
+func (s *CalendarService) Snooze(ctx context.Context, id string, d time.Duration) (ui.UIEvents, error) {
+	event, ok := s.findEvent(ctx, id)
+	if !ok {
+		return ui.UIEvents{}, fmt.Errorf("%w: %s", ErrEventNotFound, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until := xtime.Now().Add(d)
+	s.snoozed[id] = snooze{event: event, until: until}
+	delete(s.acked, id)
+	log.Printf("Meeting snoozed until %s: %s at %s", until.Format("15:04"), event.Title, event.StartTime.Format("15:04"))
+	return event, nil
+}
+
+// findEvent returns the event of the id among the events of the current day, which are
+// fetched if they are not cached, like before the first check, or else among the events
+// listed by Agenda, which are fetched again up to the end of the longest range it listed.
+// It must be called without s.mu held.
+func (s *CalendarService) findEvent(ctx context.Context, id string) (ui.UIEvents, bool) {
+	s.mu.Lock()
+	event, ok := s.findCachedEvent(id)
+	s.mu.Unlock()
+	if ok {
+		return event, true
+	}
+	s.fetchAccounts(ctx, false)
+	now := xtime.Now()
+	s.mu.Lock()
+	event, ok = s.findCachedEvent(id)
+	until := now.Add(agendaLookahead)
+	if s.agendaUntil.After(until) {
+		until = s.agendaUntil
+	}
+	s.mu.Unlock()
+	if ok {
+		return event, true
+	}
+
+	// The events of the calendars which could not be fetched are not found
+	agenda, _ := s.Agenda(ctx, now, until)
+	for _, event := range agenda {
+		if event.ID == id {
+			return event.UIEvents, true
+		}
+	}
+	return ui.UIEvents{}, false
+}
+
+// findCachedEvent returns the cached event of the id.
+// It must be called with s.mu held.
+func (s *CalendarService) findCachedEvent(id string) (ui.UIEvents, bool) {
+	for i, account := range s.accounts {
+		for j, calendar := range account.Calendars {
+			if !s.caches[i][j].valid {
+				continue
+			}
+			for _, event := range s.caches[i][j].events {
+				if eventID(eventKey(event, calendar, account)) == id {
+					return toUIEvent(event, calendar, account), true
+				}
+			}
+		}
+	}
+	return ui.UIEvents{}, false
+}
+
+// SetDoNotDisturb turns do not disturb on or off. When on, no reminder is shown until it is
+// turned off, or until until if it is not zero.
+func (s *CalendarService) SetDoNotDisturb(on bool, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doNotDisturb = on
+	s.dndUntil = until
+	switch {
+	case !on:
+		log.Println("Do not disturb turned off")
+	case until.IsZero():
+		log.Println("Do not disturb turned on")
+	default:
+		log.Printf("Do not disturb turned on until %s", until.Format(time.RFC3339))
+	}
+}
+
+// isDoNotDisturb reports whether do not disturb is on at now.
+// It must be called with s.mu held.
+func (s *CalendarService) isDoNotDisturb(now time.Time) bool {
+	return s.doNotDisturb && (s.dndUntil.IsZero() || now.Before(s.dndUntil))
+}
+
+// Status describes the state of the service, for health checks.
+type Status struct {
+	// LastCheck is when the reminders were last checked, zero before the first check.
+	LastCheck     time.Time
+	WatchInterval time.Duration
+	DoNotDisturb  bool
+	// DoNotDisturbUntil is when do not disturb ends, zero if it lasts until turned off.
+	DoNotDisturbUntil time.Time
+	Snoozed           int
+	Accounts          []AccountStatus
+}
+
+// AccountStatus describes the state of an account.
+type AccountStatus struct {
+	Name string
+	// Pushed is set if the account is updated by change notifications instead of being polled.
+	Pushed    bool
+	Calendars []CalendarStatus
+}
+
+// CalendarStatus describes the state of a calendar.
+type CalendarStatus struct {
+	ID       string
+	Name     string
+	Disabled bool
+	// OK is set if the events of the calendar were fetched by the last request.
+	OK        bool
+	FetchedAt time.Time
+}
+
+// Status returns the state of the service.
+func (s *CalendarService) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{
+		LastCheck:     s.lastCheck,
+		WatchInterval: s.watchInterval,
+		DoNotDisturb:  s.isDoNotDisturb(xtime.Now()),
+		Snoozed:       len(s.snoozed),
+	}
+	if status.DoNotDisturb {
+		status.DoNotDisturbUntil = s.dndUntil
+	}
+	for i, account := range s.accounts {
+		accountStatus := AccountStatus{Name: account.Name, Pushed: s.pushed[account.Name]}
+		for j, calendar := range account.Calendars {
+			cache := s.caches[i][j]
+			accountStatus.Calendars = append(accountStatus.Calendars, CalendarStatus{
+				ID:        calendar.ID,
+				Name:      calendar.Name,
+				Disabled:  calendar.Policy.Disabled,
+				OK:        cache.valid,
+				FetchedAt: cache.fetchedAt,
+			})
+		}
+		status.Accounts = append(status.Accounts, accountStatus)
+	}
+	return status
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/mocks"
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/kajikentaro/meeting-reminder/ui"
+	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAgendaIDs(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	withUID := createMockEvent(NOW.Add(time.Hour), "Planning")
+	withUID.UID = "planning"
+	withoutUID := createMockEvent(NOW.Add(2*time.Hour), "Review")
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{withUID, withoutUID}}}, nil).Times(2)
+
+	service := NewMultiAccountCalendarService([]Account{{Name: "Work", Provider: provider}}, nil, time.Minute)
+	agenda, err := service.Agenda(context.Background(), NOW, NOW.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, agenda, 2)
+	assert.Equal(t, eventID(fmt.Sprintf("planning@%d", withUID.Start.Unix())), agenda[0].ID)
+	assert.Equal(t, eventID(fmt.Sprintf("Work//Review@%d", withoutUID.Start.Unix())), agenda[1].ID)
+	assert.Len(t, agenda[0].ID, 12)
+
+	// The ids are stable
+	again, err := service.Agenda(context.Background(), NOW, NOW.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, agenda, again)
+}
+
+func TestAckAndSnooze(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Reminders of both events are due in 10 minutes
+	planning := createMockEvent(time.Date(2033, 3, 3, 3, 23, 0, 0, time.UTC), "Planning")
+	planning.UID = "planning"
+	review := createMockEvent(time.Date(2033, 3, 3, 3, 23, 0, 0, time.UTC), "Review")
+	review.UID = "review"
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{planning, review}}}, nil).AnyTimes()
+	uiMock := mocks.NewMockUI(ctrl)
+
+	// The events are fetched to be found before the first check
+	service := NewCalendarService(provider, uiMock, time.Minute, Calendar{Policy: ReminderPolicy{LeadTime: 10 * time.Minute}})
+	planningID := eventID(fmt.Sprintf("planning@%d", planning.Start.Unix()))
+	reviewID := eventID(fmt.Sprintf("review@%d", review.Start.Unix()))
+
+	acked, err := service.Ack(context.Background(), planningID)
+	require.NoError(t, err)
+	assert.Equal(t, "Planning", acked.Title)
+	_, err = service.Snooze(context.Background(), reviewID, 5*time.Minute)
+	require.NoError(t, err)
+	_, err = service.Snooze(context.Background(), "unknown", 5*time.Minute)
+	assert.True(t, errors.Is(err, ErrEventNotFound))
+
+	// The snoozed one is reminded of 5 minutes after being snoozed, once, and again when due,
+	// unlike the acknowledged one
+	reminder := []ui.UIEvents{{Title: "Review", StartTime: review.Start, Link: "Test Location"}}
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), reminder).Times(2)
+	xtime.Mock(time.Date(2033, 3, 3, 3, 8, 10, 0, time.UTC))
+	service.FetchAndDisplayEvents(context.Background())
+	service.FetchAndDisplayEvents(context.Background())
+	xtime.Mock(time.Date(2033, 3, 3, 3, 13, 10, 0, time.UTC))
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestAckUpcomingEvent(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 20, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The event is tomorrow morning, after the events of the current day
+	planning := createMockEvent(time.Date(2033, 3, 4, 9, 0, 0, 0, time.UTC), "Planning")
+	planning.UID = "planning"
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, ids []string, start, end time.Time) ([]models.CalendarView, error) {
+			var events []models.Event
+			if !planning.Start.Before(start) && planning.Start.Before(end) {
+				events = append(events, planning)
+			}
+			return []models.CalendarView{{Events: events}}, nil
+		}).AnyTimes()
+	uiMock := mocks.NewMockUI(ctrl)
+	service := NewCalendarService(provider, uiMock, time.Minute, Calendar{Policy: ReminderPolicy{LeadTime: 10 * time.Minute}})
+
+	agenda, err := service.Agenda(context.Background(), NOW, NOW.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, agenda, 1)
+	acked, err := service.Ack(context.Background(), agenda[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Planning", acked.Title)
+
+	// The acknowledged event is not reminded of when due
+	xtime.Mock(time.Date(2033, 3, 4, 8, 50, 10, 0, time.UTC))
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestDoNotDisturb(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	event := createMockEvent(time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC), "Standup")
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{event}}}, nil).AnyTimes()
+	uiMock := mocks.NewMockUI(ctrl)
+	service := NewCalendarService(provider, uiMock, time.Minute)
+
+	service.SetDoNotDisturb(true, NOW.Add(time.Hour))
+	assert.True(t, service.Status().DoNotDisturb)
+	service.FetchAndDisplayEvents(context.Background())
+
+	service.SetDoNotDisturb(true, NOW.Add(-time.Second))
+	assert.False(t, service.Status().DoNotDisturb, "expired")
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), gomock.Any()).Times(1)
+	service.FetchAndDisplayEvents(context.Background())
+}
+
+func TestStatus(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{"work"}, gomock.Any(), gomock.Any()).Return(nil, errors.New("offline"))
+	service := NewMultiAccountCalendarService([]Account{{
+		Name:     "Contoso",
+		Provider: provider,
+		Calendars: []Calendar{
+			{ID: "work", Name: "Work"},
+			{ID: "muted", Policy: ReminderPolicy{Disabled: true}},
+		},
+	}}, nil, time.Minute)
+	service.SetPushEnabled("Contoso", true)
+	assert.Error(t, service.RefreshAll(context.Background()))
+
+	assert.Equal(t, Status{
+		WatchInterval: time.Minute,
+		Accounts: []AccountStatus{{
+			Name:   "Contoso",
+			Pushed: true,
+			Calendars: []CalendarStatus{
+				{ID: "work", Name: "Work"},
+				{ID: "muted", Disabled: true},
+			},
+		}},
+	}, service.Status())
+}
+
+func TestControlWhileFetching(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, ids []string, start, end time.Time) ([]models.CalendarView, error) {
+			close(fetching)
+			<-release
+			return []models.CalendarView{{}}, nil
+		})
+	service := NewMultiAccountCalendarService([]Account{{Name: "Work", Provider: provider}}, nil, time.Minute)
+
+	done := make(chan error)
+	go func() { done <- service.RefreshAll(context.Background()) }()
+	<-fetching
+
+	// A slow provider doesn't block the control API
+	service.SetDoNotDisturb(true, time.Time{})
+	assert.True(t, service.Status().DoNotDisturb)
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.True(t, service.Status().Accounts[0].Calendars[0].OK)
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+)
+
+// savedLedger is the file format of the ledger of the reminders shown.
+type savedLedger struct {
+	Notified map[string]time.Time `json:"notified"`
+}
+
+// SaveLedger writes the ledger of the reminders shown to path, so that they are not shown
+// again when the program is restarted in the same interval.
+func (s *CalendarService) SaveLedger(path string) error {
+	s.mu.Lock()
+	data, err := json.Marshal(savedLedger{Notified: s.notified})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Written to a temporary file first, so that an interrupted write doesn't lose the ledger
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadLedger reads the ledger saved by SaveLedger, leaving out the reminders due before the
+// current interval. A missing file is not an error.
+func (s *CalendarService) LoadLedger(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved savedLedger
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	intervalStart := xtime.Now().Truncate(s.watchInterval)
+	for key, due := range saved.Notified {
+		if !due.Before(intervalStart) {
+			s.notified[key] = due
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/mocks"
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLedgerSurvivesRestart(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	event := createMockEvent(time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC), "Standup")
+	event.UID = "standup"
+	provider := mocks.NewMockCalendarProvider(ctrl)
+	provider.EXPECT().FetchCalendarViews(gomock.Any(), []string{""}, gomock.Any(), gomock.Any()).Return([]models.CalendarView{{Events: []models.Event{event}}}, nil).Times(2)
+	uiMock := mocks.NewMockUI(ctrl)
+	// Shown before the restart only
+	uiMock.EXPECT().ShowMeetingReminder(gomock.Any(), gomock.Any()).Times(1)
+
+	path := filepath.Join(t.TempDir(), "state", "ledger.json")
+	service := NewCalendarService(provider, uiMock, time.Minute)
+	service.FetchAndDisplayEvents(context.Background())
+	require.NoError(t, service.SaveLedger(path))
+
+	restarted := NewCalendarService(provider, uiMock, time.Minute)
+	require.NoError(t, restarted.LoadLedger(path))
+	restarted.FetchAndDisplayEvents(context.Background())
+}
+
+func TestLoadLedger(t *testing.T) {
+	NOW := time.Date(2033, 3, 3, 3, 3, 33, 333, time.UTC)
+	xtime.Mock(NOW)
+	defer xtime.Unmock()
+
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	service := NewCalendarService(nil, nil, time.Minute)
+	require.NoError(t, service.LoadLedger(path), "a missing ledger is empty")
+
+	service.notified["old"] = NOW.Add(-time.Hour)
+	service.notified["current"] = NOW.Truncate(time.Minute)
+	require.NoError(t, service.SaveLedger(path))
+
+	restarted := NewCalendarService(nil, nil, time.Minute)
+	require.NoError(t, restarted.LoadLedger(path))
+	require.Equal(t, map[string]time.Time{"current": NOW.Truncate(time.Minute)}, restarted.notified)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+	"github.com/kajikentaro/meeting-reminder/config"
+)
+
+// setting is a configuration value read from an environment variable.
+// It can also be set by the flag of the same name in kebab case, which takes precedence,
+// or in the env file, which doesn't override the environment.
+type setting struct {
+	env   string
+	usage string
+	// secret values are not printed by the config command
+	secret bool
+	// field is the value in the config file overridden by the setting. Settings without
+	// a field describe the account used when the config file has no account.
+	field func(c *config.Config) *string
+}
+
+var settings = []setting{
+	{env: "ACCOUNTS_FILE", usage: "JSON file describing several accounts, replacing those of the config file"},
+	{env: "TENANT_ID", usage: "directory (tenant) id of the Microsoft account"},
+	{env: "CLIENT_ID", usage: "application (client) id of the Microsoft app"},
+	{env: "CLIENT_SECRET", usage: "client secret of the Microsoft app, if it is a confidential client", secret: true},
+	{env: "APP_ONLY", usage: `"true" to read the calendars with the application permissions of the app`},
+	{env: "CLIENT_CERTIFICATE_FILE", usage: "PEM file of the certificate of an app-only app"},
+	{env: "CLIENT_CERTIFICATE_KEY_FILE", usage: "PEM file of the private key of the certificate"},
+	{env: "CALENDARS", usage: "JSON array of the calendars to watch"},
+	{env: "EVENTS_FILE", usage: "YAML or JSON file of manual events"},
+	{env: "LOGIN_FLOW", usage: `"browser" or "device"`, field: func(c *config.Config) *string { return &c.Login.Flow }},
+	{env: "CALLBACK_PORT", usage: "port of the redirect URI of the browser login", field: func(c *config.Config) *string { return &c.Login.CallbackPort }},
+	{env: "CALLBACK_PATH", usage: "path of the redirect URI of the browser login", field: func(c *config.Config) *string { return &c.Login.CallbackPath }},
+	{env: "TOKEN_STORE", usage: `where tokens are saved: "file", "encrypted" or "secret-service"`, field: func(c *config.Config) *string { return &c.Tokens.Store }},
+	{env: "TOKEN_PASSPHRASE", usage: `passphrase of the "encrypted" token store`, secret: true, field: func(c *config.Config) *string { return &c.Tokens.Passphrase }},
+	{env: "TOKEN_KEY_FILE", usage: `file containing the key of the "encrypted" token store`, field: func(c *config.Config) *string { return &c.Tokens.KeyFile }},
+	{env: "BROWSER_PATH", usage: "browser showing the reminders", field: func(c *config.Config) *string { return &c.UI.BrowserPath }},
+	{env: "OUTPUT_DIR", usage: "directory the reminder page is written to", field: func(c *config.Config) *string { return &c.UI.OutputDir }},
+	{env: "OPEN_DIR", usage: "directory the browser opens the reminder page from", field: func(c *config.Config) *string { return &c.UI.OpenDir }},
+	{env: "WEBHOOK_URL", usage: "public HTTPS URL receiving change notifications", field: func(c *config.Config) *string { return &c.Webhook.URL }},
+	{env: "WEBHOOK_LISTEN_ADDR", usage: "local address WEBHOOK_URL is forwarded to", field: func(c *config.Config) *string { return &c.Webhook.ListenAddr }},
+	{env: "METRICS_LISTEN_ADDR", usage: "address the Prometheus metrics are served on at /metrics", field: func(c *config.Config) *string { return &c.Metrics.ListenAddr }},
+}
+
+// flagName returns the name of the flag of the setting, e.g. "client-id" for CLIENT_ID.
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.env), "_", "-")
+}
+
+// Sources of the settings, shown by the config command
+const (
+	sourceFlag        = "flag"
+	sourceEnvironment = "environment"
+	sourceDefault     = "default"
+)
+
+// configPathEnv is the environment variable of the path of the config file
+const configPathEnv = "MEETING_REMINDER_CONFIG"
+
+// options are the flags shared by all commands, which may be given before or after the command.
+type options struct {
+	envFile     string
+	envFileSet  bool
+	configPath  string
+	deviceLogin bool
+	// overrides are the settings given by flags, by environment variable
+	overrides map[string]string
+	// envValues are the variables of the env file, read again by each load
+	envValues map[string]string
+	// sources holds where each setting was read from by the last load, by environment variable
+	sources map[string]string
+	// envMu guards envValues and sources, which a reload replaces while the program runs
+	envMu sync.Mutex
+}
+
+func newOptions() *options {
+	return &options{envFile: ".env", overrides: map[string]string{}}
+}
+
+// register adds the shared flags to flags.
+func (o *options) register(flags *flag.FlagSet) {
+	flags.Func("env-file", `file of environment variables, optional unless set (default ".env")`, func(value string) error {
+		o.envFile = value
+		o.envFileSet = true
+		return nil
+	})
+	flags.StringVar(&o.configPath, "config", o.configPath, "config file, optional unless set (default $"+configPathEnv+" or config.yaml in the config directory)")
+	flags.BoolVar(&o.deviceLogin, "device-login", o.deviceLogin, "sign in with a code entered in a browser on another device")
+	for _, s := range settings {
+		flags.Func(s.flagName(), s.usage+" ($"+s.env+")", func(value string) error {
+			o.overrides[s.env] = value
+			return nil
+		})
+	}
+}
+
+// lookupEnv returns the variable given by a flag, the environment or the env file, in this order.
+func (o *options) lookupEnv(key string) (string, bool) {
+	if value, ok := o.overrides[key]; ok {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	o.envMu.Lock()
+	defer o.envMu.Unlock()
+	value, ok := o.envValues[key]
+	return value, ok
+}
+
+// settingSource returns where the setting of the environment variable was read from by the
+// last load, or "" if it is not set.
+func (o *options) settingSource(key string) string {
+	o.envMu.Lock()
+	defer o.envMu.Unlock()
+	return o.sources[key]
+}
+
+// getenv returns the variable of lookupEnv, or "" if it is not set.
+func (o *options) getenv(key string) string {
+	value, _ := o.lookupEnv(key)
+	return value
+}
+
+// load reads the configuration without validating it. Flags override the environment,
+// which overrides the env file, which overrides the config file.
+func (o *options) load() (*config.Config, error) {
+	sources, err := o.loadEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	path, required, err := o.configFile()
+	if err != nil {
+		return nil, err
+	}
+	c, err := config.Load(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		c, err = config.Default(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := config.Default()
+	for _, s := range settings {
+		if s.field == nil {
+			continue
+		}
+		if value, ok := o.lookupEnv(s.env); ok {
+			*s.field(c) = value
+		} else if *s.field(c) != *s.field(defaults) {
+			sources[s.env] = c.Path
+		} else {
+			sources[s.env] = sourceDefault
+		}
+	}
+	o.envMu.Lock()
+	o.sources = sources
+	o.envMu.Unlock()
+
+	if path := o.getenv("ACCOUNTS_FILE"); path != "" {
+		if c.Accounts, err = loadAccountsFile(path); err != nil {
+			return nil, err
+		}
+	} else if len(c.Accounts) == 0 {
+		if c.Accounts, err = o.envAccounts(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// configFile returns the path of the config file, and whether it must exist, which it
+// must unless it is the default one.
+func (o *options) configFile() (path string, required bool, err error) {
+	path = o.configPath
+	if path == "" {
+		path = o.getenv(configPathEnv)
+	}
+	if path != "" {
+		return path, true, nil
+	}
+	path, err = config.DefaultPath()
+	return path, false, err
+}
+
+// loadEnv reads the env file again, and returns where the settings given by variables come from.
+// The process environment is left untouched, so that the changes of the env file are read by
+// the next load.
+func (o *options) loadEnv() (map[string]string, error) {
+	values, err := godotenv.Read(o.envFile)
+	if err != nil && (o.envFileSet || !errors.Is(err, fs.ErrNotExist)) {
+		return nil, err
+	}
+	o.envMu.Lock()
+	o.envValues = values
+	o.envMu.Unlock()
+
+	sources := map[string]string{}
+	for _, s := range settings {
+		_, inEnvironment := os.LookupEnv(s.env)
+		_, inEnvFile := values[s.env]
+		switch _, inFlags := o.overrides[s.env]; {
+		case inFlags:
+			sources[s.env] = sourceFlag
+		case inEnvironment:
+			sources[s.env] = sourceEnvironment
+		case inEnvFile:
+			sources[s.env] = o.envFile
+		}
+	}
+	return sources, nil
+}
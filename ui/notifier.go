@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/metrics"
+)
+
+// Notifier shows the reminders of meetings, like UI does in the browser.
+type Notifier interface {
+	ShowMeetingReminder(ctx context.Context, events []UIEvents)
+}
+
+// Notifiers shows the reminders with each notifier.
+type Notifiers []Notifier
+
+func (n Notifiers) ShowMeetingReminder(ctx context.Context, events []UIEvents) {
+	for _, notifier := range n {
+		notifier.ShowMeetingReminder(ctx, events)
+	}
+}
+
+// Commands of CommandNotifier are killed if they run longer than this
+const commandTimeout = 30 * time.Second
+
+// CommandNotifier runs a command for each event, like notify-send or a script.
+// The event is passed in the environment variables MEETING_TITLE, MEETING_START,
+// MEETING_LINK, MEETING_CALENDAR and MEETING_ACCOUNT.
+type CommandNotifier struct {
+	// Command and its arguments
+	Command []string
+}
+
+// ShowMeetingReminder runs the command for each event. The commands are killed when ctx is done.
+func (c *CommandNotifier) ShowMeetingReminder(ctx context.Context, events []UIEvents) {
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+		// A hanging command doesn't hold up the next reminders
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+		cmd.Env = append(os.Environ(),
+			"MEETING_TITLE="+event.Title,
+			"MEETING_START="+event.StartTime.Format(time.RFC3339),
+			"MEETING_LINK="+event.Link,
+			"MEETING_CALENDAR="+event.Calendar,
+			"MEETING_ACCOUNT="+event.Account,
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("Notifier command %v failed: %v: %s", c.Command, err, output)
+			metrics.Notifications.WithLabelValues("command", metrics.Failure).Inc()
+		} else {
+			metrics.Notifications.WithLabelValues("command", metrics.Success).Inc()
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,30 @@
+package ui
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommandNotifier(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "notified")
+	notifier := Notifiers{&CommandNotifier{
+		Command: []string{"sh", "-c", `echo "$MEETING_TITLE|$MEETING_START|$MEETING_LINK" >> "$0"`, output},
+	}}
+	start := time.Date(2033, 3, 3, 9, 0, 0, 0, time.UTC)
+	notifier.ShowMeetingReminder(context.Background(), []UIEvents{
+		{Title: "Standup", StartTime: start, Link: "https://example.com/join"},
+		{Title: "Review", StartTime: start},
+	})
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Standup|2033-03-03T09:00:00Z|https://example.com/join\nReview|2033-03-03T09:00:00Z|\n"
+	if string(data) != want {
+		t.Errorf("unexpected output: %q", data)
+	}
+}
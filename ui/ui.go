@@ -1,11 +1,17 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"html/template"
+	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/kajikentaro/meeting-reminder/metrics"
 	"github.com/kajikentaro/meeting-reminder/utils"
 )
 
@@ -17,10 +23,9 @@ type UI struct {
 
 var OUTPUT_NAME = "meeting-reminder.html"
 
+// NewUI creates the UI showing pages with the browser at browserPath,
+// or with the default browser of the system if it is empty.
 func NewUI(browserPath, outputDir, openDir string) *UI {
-	if browserPath == "" {
-		panic("BROWSER_PATH environment variable is not set")
-	}
 	if outputDir == "" {
 		outputDir = os.TempDir()
 	}
@@ -38,10 +43,47 @@ type UIEvents struct {
 	Title     string
 	StartTime time.Time
 	Link      string
+	// Calendar is the display name of the calendar the event belongs to. Optional.
+	Calendar string
+	// Color is a CSS color used to mark the calendar. Optional.
+	Color string
+	// Account is the name of the account the event came from. Optional.
+	Account string
+	// Organizer is the name of the organizer. Optional.
+	Organizer string
+	// Attendance counts the responses of the attendees.
+	Attendance Attendance
+	// NeedsResponse is set if the signed-in user has not responded to the invitation yet.
+	NeedsResponse bool
+}
+
+// Attendance counts the responses of the attendees of an event.
+type Attendance struct {
+	Accepted     int
+	Tentative    int
+	Declined     int
+	NotResponded int
 }
 
-func (u *UI) ShowMeetingReminder(events []UIEvents) {
-	html := `<html>
+func (a Attendance) total() int {
+	return a.Accepted + a.Tentative + a.Declined + a.NotResponded
+}
+
+// String returns a summary like "7 accepted / 2 tentative / 1 declined".
+func (a Attendance) String() string {
+	summary := fmt.Sprintf("%d accepted / %d tentative / %d declined", a.Accepted, a.Tentative, a.Declined)
+	if a.NotResponded > 0 {
+		summary += fmt.Sprintf(" / %d not responded", a.NotResponded)
+	}
+	return summary
+}
+
+// cssColor matches the colors of calendars put in the style of the page, like "#0078d7" or "teal".
+var cssColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// reminderPage is the page of the reminders. The events come from invitations and feeds
+// anyone can send, so they are escaped by html/template.
+var reminderPage = template.Must(template.New("reminder").Parse(`<html>
 	<head>
 		<title>Meeting Reminder</title>
 		<style>
@@ -66,27 +108,144 @@ func (u *UI) ShowMeetingReminder(events []UIEvents) {
 				padding: 1rem 3rem;
 				border-radius: 10px;
 			}
+			p.calendar {
+				margin: 0;
+				font-weight: bold;
+			}
+			p.needs-response {
+				background: yellow;
+				color: black;
+				padding: 0.2rem 0.5rem;
+				border-radius: 5px;
+				font-weight: bold;
+			}
 		</style>
 	</head>
 	<body>
-		<h1>Meeting is starting now!</h1>`
+		<h1>Meeting is starting now!</h1>
+{{- range .}}
+			<div class="event"{{if .Color}} style="border-left: 12px solid {{.Color}}"{{end}}>
+				{{if .Calendar}}<p class="calendar">{{.Calendar}}</p>{{end}}
+				<h2>{{.Title}}</h2>
+				<h3>Start Time: {{.StartTime}}</h3>
+				{{if .Insights}}<p>{{.Insights}}</p>{{end}}
+				{{- if .NeedsResponse}}<p class="needs-response">You haven't responded yet</p>{{end}}
+				<a href="{{.Link}}">{{.Link}}</a>
+			</div>
+{{end}}
+	</body>
+</html>`))
+
+// reminderEvent is an event as shown on the reminder page.
+type reminderEvent struct {
+	Title         string
+	StartTime     string
+	Link          string
+	Calendar      string
+	Color         string
+	Insights      string
+	NeedsResponse bool
+}
 
+func (u *UI) ShowMeetingReminder(ctx context.Context, events []UIEvents) {
+	var pageEvents []reminderEvent
 	for _, event := range events {
-		timeStr := event.StartTime.Format("15:04")
+		var labels []string
+		for _, label := range []string{event.Account, event.Calendar} {
+			if label != "" {
+				labels = append(labels, label)
+			}
+		}
 
-		html += fmt.Sprintf(`
-			<div class="event">
-				<h2>%s</h2>
-				<h3>Start Time: %s</h3>
-				<a href="%s">%s</a>
-			</div>
-		`, event.Title, timeStr, event.Link, event.Link)
+		var insights []string
+		if event.Organizer != "" {
+			insights = append(insights, "organizer: "+event.Organizer)
+		}
+		if event.Attendance.total() > 0 {
+			insights = append(insights, event.Attendance.String())
+		}
+
+		color := event.Color
+		if !cssColor.MatchString(color) {
+			color = ""
+		}
+		pageEvents = append(pageEvents, reminderEvent{
+			Title:         event.Title,
+			StartTime:     event.StartTime.Format("15:04"),
+			Link:          event.Link,
+			Calendar:      strings.Join(labels, " / "),
+			Color:         color,
+			Insights:      strings.Join(insights, ", "),
+			NeedsResponse: event.NeedsResponse,
+		})
 	}
 
-	html += `
+	var page strings.Builder
+	if err := reminderPage.Execute(&page, pageEvents); err != nil {
+		log.Printf("Failed to render the reminder page: %v", err)
+		metrics.Notifications.WithLabelValues("browser", metrics.Failure).Add(float64(len(events)))
+		return
+	}
+
+	err := u.show(ctx, page.String())
+	if ctx.Err() != nil {
+		return
+	}
+	for range events {
+		if err != nil {
+			metrics.Notifications.WithLabelValues("browser", metrics.Failure).Inc()
+		} else {
+			metrics.Notifications.WithLabelValues("browser", metrics.Success).Inc()
+		}
+	}
+}
+
+// reloginPage is the page asking to sign in to an account again.
+var reloginPage = template.Must(template.New("relogin").Parse(`<html>
+	<head>
+		<title>Meeting Reminder</title>
+		<style>
+			body {
+				background: #0078D7;
+				color: white;
+				display: flex;
+				justify-content: center;
+				align-items: center;
+				margin: 0;
+				flex-direction: column;
+				min-height: 100%;
+				gap: 20px;
+				font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, 'Open Sans', 'Helvetica Neue', sans-serif;
+			}
+			a {
+				color: yellow;
+			}
+			code {
+				font-size: 2rem;
+			}
+		</style>
+	</head>
+	<body>
+		<h1>Re-login required{{if .Account}}: {{.Account}}{{end}}</h1>
+		<p>Reminders of the account are paused until you sign in again.</p>
+		<a href="{{.URL}}">Sign in</a>
+		{{if .UserCode}}<p>Enter the code <code>{{.UserCode}}</code></p>{{end}}
 	</body>
-</html>`
+</html>`))
+
+// ShowReloginRequired asks the user to sign in to the account again, at the URL with the code if given.
+func (u *UI) ShowReloginRequired(account, url, userCode string) {
+	var page strings.Builder
+	err := reloginPage.Execute(&page, struct{ Account, URL, UserCode string }{account, url, userCode})
+	if err != nil {
+		log.Printf("Failed to render the re-login page: %v", err)
+		return
+	}
+	u.show(context.Background(), page.String())
+}
 
+// show writes the page and opens it in the browser, unless ctx is done.
+func (u *UI) show(ctx context.Context, html string) error {
 	if err := os.MkdirAll(u.OutputDir, 0700); err != nil {
 		panic(err)
 	}
@@ -99,7 +258,15 @@ func (u *UI) ShowMeetingReminder(events []UIEvents) {
 	f.WriteString(html)
 
 	url := filepath.Join(u.OpenDir, OUTPUT_NAME)
-	utils.ExecCommand(
+	if u.BrowserPath == "" {
+		if err := utils.OpenBrowser(ctx, url); err != nil {
+			log.Printf("Failed to open the default browser: %v", err)
+			return err
+		}
+		return nil
+	}
+	return utils.ExecCommand(
+		ctx,
 		u.BrowserPath,
 		url,
 	)
@@ -1,12 +1,18 @@
 package ui
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUI(t *testing.T) {
-	ui := NewUI("echo", "./", "./")
+	ui := NewUI("echo", t.TempDir(), "")
 	events := []UIEvents{
 		{
 			Title:     "[Sample Sample] Sample Sample Title",
@@ -22,6 +28,64 @@ func TestUI(t *testing.T) {
 			Title:     "[Sample Sample] Sample Sample Only Title",
 			StartTime: time.Now(),
 		},
+		{
+			Title:         "[Sample Sample] Sample Sample With Attendees",
+			StartTime:     time.Now(),
+			Link:          "https://example.com/sample-link",
+			Organizer:     "Sample Organizer",
+			Attendance:    Attendance{Accepted: 7, Tentative: 2, Declined: 1},
+			NeedsResponse: true,
+		},
 	}
-	ui.ShowMeetingReminder(events)
+	ui.ShowMeetingReminder(context.Background(), events)
+}
+
+func TestUIEscapesEvents(t *testing.T) {
+	dir := t.TempDir()
+	ui := NewUI("echo", dir, "")
+	ui.ShowMeetingReminder(context.Background(), []UIEvents{{
+		Title:     `<script>alert("title")</script>`,
+		StartTime: time.Date(2033, 3, 3, 3, 3, 0, 0, time.UTC),
+		Link:      `javascript:alert("link")`,
+		Calendar:  "<b>Team</b>",
+		Color:     `red" onmouseover="alert(1)`,
+		Organizer: "<img src=x onerror=alert(1)>",
+	}})
+
+	page, err := os.ReadFile(filepath.Join(dir, OUTPUT_NAME))
+	require.NoError(t, err)
+	assert.NotContains(t, string(page), "<script>")
+	assert.NotContains(t, string(page), "<b>")
+	assert.NotContains(t, string(page), "<img")
+	assert.NotContains(t, string(page), `href="javascript:`)
+	assert.NotContains(t, string(page), "onmouseover")
+	assert.Contains(t, string(page), "&lt;script&gt;alert(&#34;title&#34;)&lt;/script&gt;")
+	assert.Contains(t, string(page), "Start Time: 03:03")
+}
+
+func TestAttendanceString(t *testing.T) {
+	if got := (Attendance{Accepted: 7, Tentative: 2, Declined: 1}).String(); got != "7 accepted / 2 tentative / 1 declined" {
+		t.Errorf("unexpected summary: %q", got)
+	}
+	if got := (Attendance{Accepted: 1, NotResponded: 3}).String(); got != "1 accepted / 0 tentative / 0 declined / 3 not responded" {
+		t.Errorf("unexpected summary: %q", got)
+	}
+}
+
+func TestShowReloginRequired(t *testing.T) {
+	outputDir := t.TempDir()
+	ui := NewUI("echo", outputDir, "")
+	ui.ShowReloginRequired("Contoso", "https://login.example.com/authorize?client_id=a&state=b", "ABCD-EFGH")
+	page, err := os.ReadFile(filepath.Join(outputDir, OUTPUT_NAME))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), `<h1>Re-login required: Contoso</h1>`)
+	assert.Contains(t, string(page), `href="https://login.example.com/authorize?client_id=a&amp;state=b"`)
+	assert.Contains(t, string(page), `<code>ABCD-EFGH</code>`)
+
+	ui.ShowReloginRequired("<b>Contoso</b>", "javascript:alert(1)", "")
+	page, err = os.ReadFile(filepath.Join(outputDir, OUTPUT_NAME))
+	require.NoError(t, err)
+	assert.Contains(t, string(page), "&lt;b&gt;Contoso&lt;/b&gt;")
+	assert.NotContains(t, string(page), `href="javascript:`)
+	assert.NotContains(t, string(page), "<code>")
 }
@@ -0,0 +1,174 @@
+// Package cron parses cron expressions like "0 9 * * 1-5".
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression with the fields
+// minute, hour, day of month, month and day of week.
+type Schedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// If both days of month and of week are restricted, a day matching either runs
+	dayOfMonthAny, dayOfWeekAny bool
+}
+
+type field struct {
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{min: 0, max: 59},
+	{min: 0, max: 23},
+	{min: 1, max: 31},
+	{min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}},
+	// 7 is also Sunday
+	{min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}},
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression of five fields, or a macro like "@daily".
+// Fields are "*", values, ranges like "1-5", steps like "*/15" and lists of them.
+func Parse(expr string) (*Schedule, error) {
+	if macro, ok := macros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = macro
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected %d fields", expr, len(fields))
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		var err error
+		if bits[i], err = parseField(part, fields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dayOfMonth:    bits[2],
+		month:         bits[3],
+		dayOfWeek:     bits[4],
+		dayOfMonthAny: parts[2] == "*",
+		dayOfWeekAny:  parts[4] == "*",
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step: %q", item)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = f.value(lowPart); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highPart); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" runs from 5 to the end
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range: %q", item)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value: %q", s)
+	}
+	return v, nil
+}
+
+// Between returns the times the schedule runs at in [start, end), in the location of start.
+func (s *Schedule) Between(start, end time.Time) []time.Time {
+	loc := start.Location()
+	var times []time.Time
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if !s.matchesDay(day) {
+			continue
+		}
+		for hour := 0; hour < 24; hour++ {
+			if s.hour&(1<<hour) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if s.minute&(1<<minute) == 0 {
+					continue
+				}
+				t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+				if !t.Before(start) && t.Before(end) {
+					times = append(times, t)
+				}
+			}
+		}
+	}
+	return times
+}
+
+func (s *Schedule) matchesDay(day time.Time) bool {
+	if s.month&(1<<int(day.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := s.dayOfMonth&(1<<day.Day()) != 0
+	dayOfWeek := s.dayOfWeek&(1<<int(day.Weekday())) != 0
+	switch {
+	case s.dayOfMonthAny:
+		return dayOfWeek
+	case s.dayOfWeekAny:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBetween(t *testing.T) {
+	type TestCase struct {
+		expr     string
+		expected []time.Time
+	}
+	// 2025-06-06 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+	start := at(6, 0, 0)
+	end := at(9, 0, 0)
+
+	testCases := []TestCase{
+		{expr: "0 9 * * 1-5", expected: []time.Time{at(6, 9, 0)}},
+		{expr: "30 12 * * SAT,SUN", expected: []time.Time{at(7, 12, 30), at(8, 12, 30)}},
+		{expr: "*/20 9 6 * *", expected: []time.Time{at(6, 9, 0), at(6, 9, 20), at(6, 9, 40)}},
+		{expr: "0 0 * * 7", expected: []time.Time{at(8, 0, 0)}},
+		// Either the day of month or the day of week
+		{expr: "0 8 7 * 5", expected: []time.Time{at(6, 8, 0), at(7, 8, 0)}},
+		{expr: "0 10 * JUL *", expected: nil},
+		{expr: "@daily", expected: []time.Time{at(6, 0, 0), at(7, 0, 0), at(8, 0, 0)}},
+		{expr: "45 23/12 8 * *", expected: []time.Time{at(8, 23, 45)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			schedule, err := Parse(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, schedule.Between(start, end))
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "5-1 * * * *", "*/0 * * * *", "0 0 * * FOO"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,368 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+)
+
+// Calendar is the content of an iCalendar stream.
+type Calendar struct {
+	// Name is the X-WR-CALNAME of the calendar. Optional.
+	Name   string
+	events []*Component
+	zones  map[string]zone
+}
+
+// Parse reads the VCALENDARs of an iCalendar stream.
+func Parse(r io.Reader) (*Calendar, error) {
+	components, err := ParseComponents(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Calendar{zones: map[string]zone{}}
+	for _, vcalendar := range components {
+		if vcalendar.Name != "VCALENDAR" {
+			continue
+		}
+		if c.Name == "" {
+			c.Name = vcalendar.Text("X-WR-CALNAME")
+		}
+		for _, vtimezone := range vcalendar.Children("VTIMEZONE") {
+			tzid := vtimezone.Text("TZID")
+			z, err := parseVTimezone(vtimezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid VTIMEZONE %q: %w", tzid, err)
+			}
+			c.zones[tzid] = z
+		}
+		c.events = append(c.events, vcalendar.Children("VEVENT")...)
+	}
+	return c, nil
+}
+
+// zone resolves a TZID with the VTIMEZONEs of the calendar, or the IANA time zone database.
+func (c *Calendar) zone(tzid string) zone {
+	if z, ok := c.zones[tzid]; ok {
+		return z
+	}
+	if loc, err := time.LoadLocation(tzid); err == nil {
+		return locationZone{loc: loc}
+	}
+	log.Printf("Unknown time zone %q, using UTC", tzid)
+	return utcZone
+}
+
+// parseTime parses a DATE or DATE-TIME property into a wall clock time and its zone.
+func (c *Calendar) parseTime(p *Property) (wall time.Time, z zone, isDate bool, err error) {
+	value := p.Value
+	if p.Params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		wall, err = time.ParseInLocation(dateLayout, value, time.UTC)
+		// All-day events are in the local time of the user
+		return wall, floatingZone, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		wall, err = time.ParseInLocation(dateTimeLayout, strings.TrimSuffix(value, "Z"), time.UTC)
+		return wall, utcZone, false, err
+	}
+	wall, err = time.ParseInLocation(dateTimeLayout, value, time.UTC)
+	if tzid, ok := p.Params["TZID"]; ok {
+		return wall, c.zone(tzid), false, err
+	}
+	return wall, floatingZone, false, err
+}
+
+// parseTimes parses the instants of a multi-valued property like EXDATE.
+func (c *Calendar) parseTimes(p Property) []time.Time {
+	var instants []time.Time
+	for _, value := range strings.Split(p.Value, ",") {
+		single := p
+		single.Value = value
+		wall, z, _, err := c.parseTime(&single)
+		if err != nil {
+			log.Printf("Invalid %s value %q: %v", p.Name, value, err)
+			continue
+		}
+		instants = append(instants, z.instant(wall))
+	}
+	return instants
+}
+
+// Events returns the occurrences overlapping the range from start to end, sorted by start.
+// owner is the email address of the user, to find the user's response to invitations. Optional.
+// Invalid events are logged and skipped.
+func (c *Calendar) Events(start, end time.Time, owner string) []models.Event {
+	// Modified occurrences of recurring events by UID and original start
+	overrides := map[string]map[int64]*Component{}
+	for _, vevent := range c.events {
+		if p := vevent.Get("RECURRENCE-ID"); p != nil {
+			wall, z, _, err := c.parseTime(p)
+			if err != nil {
+				log.Printf("Invalid RECURRENCE-ID of event %q: %v", vevent.Text("UID"), err)
+				continue
+			}
+			uid := vevent.Text("UID")
+			if overrides[uid] == nil {
+				overrides[uid] = map[int64]*Component{}
+			}
+			overrides[uid][z.instant(wall).Unix()] = vevent
+		}
+	}
+
+	var events []models.Event
+	appendIfOverlaps := func(vevent *Component, wall time.Time, z zone, isDate bool) {
+		event, ok, err := c.occurrence(vevent, wall, z, isDate, owner)
+		if err != nil {
+			log.Printf("Invalid event %q: %v", vevent.Text("UID"), err)
+			return
+		}
+		if ok && event.Start.Before(end) && (event.End.After(start) || !event.Start.Before(start)) {
+			events = append(events, event)
+		}
+	}
+
+	for _, vevent := range c.events {
+		dtstart := vevent.Get("DTSTART")
+		if dtstart == nil {
+			log.Printf("Invalid event %q: missing DTSTART", vevent.Text("UID"))
+			continue
+		}
+		wall, z, isDate, err := c.parseTime(dtstart)
+		if err != nil {
+			log.Printf("Invalid DTSTART of event %q: %v", vevent.Text("UID"), err)
+			continue
+		}
+
+		// Overrides are added on their own, as they may have been moved into or out of the range
+		if vevent.Get("RECURRENCE-ID") != nil {
+			appendIfOverlaps(vevent, wall, z, isDate)
+			continue
+		}
+
+		rrule := vevent.Get("RRULE")
+		rdates := vevent.GetAll("RDATE")
+		if rrule == nil && len(rdates) == 0 {
+			appendIfOverlaps(vevent, wall, z, isDate)
+			continue
+		}
+
+		uid := vevent.Text("UID")
+		excluded := map[int64]bool{}
+		for _, p := range vevent.GetAll("EXDATE") {
+			for _, t := range c.parseTimes(p) {
+				excluded[t.Unix()] = true
+			}
+		}
+		duration, err := c.duration(vevent, wall, z, isDate)
+		if err != nil {
+			log.Printf("Invalid event %q: %v", uid, err)
+			continue
+		}
+
+		occurrence := func(occurrenceWall time.Time) {
+			instant := z.instant(occurrenceWall).Unix()
+			if excluded[instant] || overrides[uid][instant] != nil {
+				return
+			}
+			appendIfOverlaps(vevent, occurrenceWall, z, isDate)
+		}
+
+		seen := map[int64]bool{}
+		if rrule != nil {
+			rule, err := ParseRRule(rrule.Value, z)
+			if err != nil {
+				log.Printf("Invalid RRULE of event %q: %v", uid, err)
+				continue
+			}
+			rule.each(wall, z, func(t time.Time) bool {
+				instant := z.instant(t)
+				if !instant.Before(end) {
+					return false
+				}
+				seen[instant.Unix()] = true
+				if !instant.Add(duration).Before(start) {
+					occurrence(t)
+				}
+				return true
+			})
+		} else {
+			seen[z.instant(wall).Unix()] = true
+			occurrence(wall)
+		}
+
+		for _, p := range rdates {
+			for _, t := range c.parseTimes(p) {
+				if seen[t.Unix()] {
+					continue
+				}
+				seen[t.Unix()] = true
+				// RDATE is an instant, which is converted back to the wall clock of the event
+				occurrence(wallClock(t, z, wall))
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events
+}
+
+// wallClock converts an instant to the wall clock time of a zone.
+// Zones from VTIMEZONE can't convert that way, so the offset of the reference time is used.
+func wallClock(t time.Time, z zone, reference time.Time) time.Time {
+	if lz, ok := z.(locationZone); ok {
+		local := t.In(lz.loc)
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC)
+	}
+	offset := reference.Sub(z.instant(reference))
+	return t.Add(offset).UTC()
+}
+
+// duration returns the length of an event from DTEND or DURATION.
+func (c *Calendar) duration(vevent *Component, wall time.Time, z zone, isDate bool) (time.Duration, error) {
+	if p := vevent.Get("DTEND"); p != nil {
+		endWall, endZone, _, err := c.parseTime(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid DTEND: %w", err)
+		}
+		return endZone.instant(endWall).Sub(z.instant(wall)), nil
+	}
+	if p := vevent.Get("DURATION"); p != nil {
+		d, err := ParseDuration(p.Value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid DURATION: %w", err)
+		}
+		return d, nil
+	}
+	if isDate {
+		return 24 * time.Hour, nil
+	}
+	return 0, nil
+}
+
+// occurrence builds the event starting at the wall clock time.
+// ok is false if the occurrence is cancelled.
+func (c *Calendar) occurrence(vevent *Component, wall time.Time, z zone, isDate bool, owner string) (event models.Event, ok bool, err error) {
+	if strings.EqualFold(vevent.Text("STATUS"), "CANCELLED") {
+		return event, false, nil
+	}
+
+	// The length of the event is the one of its first occurrence
+	firstWall, firstZone, _, err := c.parseTime(vevent.Get("DTSTART"))
+	if err != nil {
+		return event, false, err
+	}
+	duration, err := c.duration(vevent, firstWall, firstZone, isDate)
+	if err != nil {
+		return event, false, err
+	}
+
+	event = models.Event{
+		UID:      vevent.Text("UID"),
+		Title:    vevent.Text("SUMMARY"),
+		Start:    z.instant(wall),
+		AllDay:   isDate,
+		Location: vevent.Text("LOCATION"),
+		JoinURL:  joinURL(vevent),
+	}
+	if isDate {
+		// Days may be shorter or longer than 24 hours on DST changes
+		event.End = z.instant(wall.Add(duration))
+	} else {
+		event.End = event.Start.Add(duration)
+	}
+
+	if organizer := vevent.Get("ORGANIZER"); organizer != nil {
+		event.Organizer = organizer.Params["CN"]
+		email := mailAddress(organizer.Value)
+		if event.Organizer == "" {
+			event.Organizer = email
+		}
+		if owner != "" && strings.EqualFold(email, owner) {
+			event.IsOrganizer = true
+			event.Response = models.ResponseOrganizer
+		}
+	}
+
+	for _, p := range vevent.GetAll("ATTENDEE") {
+		attendee := models.Attendee{
+			Name:     p.Params["CN"],
+			Email:    mailAddress(p.Value),
+			Type:     models.AttendeeRequired,
+			Response: partStat(p.Params["PARTSTAT"]),
+		}
+		switch {
+		case p.Params["CUTYPE"] == "RESOURCE" || p.Params["CUTYPE"] == "ROOM":
+			attendee.Type = models.AttendeeResource
+		case p.Params["ROLE"] == "OPT-PARTICIPANT" || p.Params["ROLE"] == "NON-PARTICIPANT":
+			attendee.Type = models.AttendeeOptional
+		}
+		if owner != "" && strings.EqualFold(attendee.Email, owner) && !event.IsOrganizer {
+			event.Response = attendee.Response
+		}
+		event.Attendees = append(event.Attendees, attendee)
+	}
+
+	for _, valarm := range vevent.Children("VALARM") {
+		if action := strings.ToUpper(valarm.Text("ACTION")); action != "" && action != "DISPLAY" && action != "AUDIO" {
+			continue
+		}
+		trigger := valarm.Get("TRIGGER")
+		if trigger == nil {
+			continue
+		}
+		if trigger.Params["VALUE"] == "DATE-TIME" {
+			triggerWall, triggerZone, _, err := c.parseTime(trigger)
+			if err != nil {
+				return event, false, fmt.Errorf("invalid TRIGGER: %w", err)
+			}
+			event.Alarms = append(event.Alarms, event.Start.Sub(triggerZone.instant(triggerWall)))
+			continue
+		}
+		d, err := ParseDuration(trigger.Value)
+		if err != nil {
+			return event, false, fmt.Errorf("invalid TRIGGER: %w", err)
+		}
+		if trigger.Params["RELATED"] == "END" {
+			d += event.End.Sub(event.Start)
+		}
+		event.Alarms = append(event.Alarms, -d)
+	}
+
+	return event, true, nil
+}
+
+// joinURL finds the link to an online meeting of the event.
+func joinURL(vevent *Component) string {
+	for _, name := range []string{"X-MICROSOFT-SKYPETEAMSMEETINGURL", "X-GOOGLE-CONFERENCE", "URL"} {
+		if url := vevent.Text(name); url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+func mailAddress(value string) string {
+	if len(value) >= len("mailto:") && strings.EqualFold(value[:len("mailto:")], "mailto:") {
+		return value[len("mailto:"):]
+	}
+	return value
+}
+
+func partStat(value string) models.ResponseStatus {
+	switch strings.ToUpper(value) {
+	case "ACCEPTED":
+		return models.ResponseAccepted
+	case "TENTATIVE":
+		return models.ResponseTentative
+	case "DECLINED":
+		return models.ResponseDeclined
+	default:
+		return models.ResponseNotResponded
+	}
+}
@@ -0,0 +1,289 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Test//Test//EN
+X-WR-CALNAME:Team\, Europe
+BEGIN:VTIMEZONE
+TZID:W. Europe Standard Time
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:weekly@example.com
+SUMMARY:Weekly Sync
+DTSTART;TZID=W. Europe Standard Time:20250303T100000
+DTEND;TZID=W. Europe Standard Time:20250303T103000
+RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=10
+EXDATE;TZID=W. Europe Standard Time:20250310T100000
+ORGANIZER;CN=Bob:mailto:bob@example.com
+ATTENDEE;CN=Alice;PARTSTAT=ACCEPTED;ROLE=REQ-PARTICIPANT:mailto:alice@example.com
+ATTENDEE;CN="Me, Myself";PARTSTAT=NEEDS-ACTION;ROLE=OPT-PARTICIPANT:mailto:me@example.com
+ATTENDEE;CN=Room 1;CUTYPE=ROOM;PARTSTAT=ACCEPTED:mailto:room1@example.com
+LOCATION:Room 1
+X-MICROSOFT-SKYPETEAMSMEETINGURL:https://teams.microsoft.com/l/meetup-join/
+ abc
+BEGIN:VALARM
+ACTION:DISPLAY
+TRIGGER:-PT15M
+END:VALARM
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250317T100000
+SUMMARY:Weekly Sync (moved)
+DTSTART;TZID=W. Europe Standard Time:20250318T140000
+DTEND;TZID=W. Europe Standard Time:20250318T143000
+END:VEVENT
+BEGIN:VEVENT
+UID:weekly@example.com
+RECURRENCE-ID;TZID=W. Europe Standard Time:20250324T100000
+SUMMARY:Weekly Sync
+STATUS:CANCELLED
+DTSTART;TZID=W. Europe Standard Time:20250324T100000
+END:VEVENT
+BEGIN:VEVENT
+UID:holiday@example.com
+SUMMARY:Holiday
+DTSTART;VALUE=DATE:20250305
+DTEND;VALUE=DATE:20250306
+END:VEVENT
+BEGIN:VEVENT
+UID:tokyo@example.com
+SUMMARY:Tokyo Call
+DTSTART;TZID=Asia/Tokyo:20250305T090000
+DURATION:PT1H
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParseComponents(t *testing.T) {
+	c, err := Parse(strings.NewReader(testCalendar))
+	require.NoError(t, err)
+	assert.Equal(t, "Team, Europe", c.Name)
+	assert.Len(t, c.events, 5)
+
+	attendee := c.events[0].GetAll("ATTENDEE")[1]
+	assert.Equal(t, "Me, Myself", attendee.Params["CN"])
+	assert.Equal(t, "mailto:me@example.com", attendee.Value)
+	assert.Equal(t, "https://teams.microsoft.com/l/meetup-join/abc", c.events[0].Text("X-MICROSOFT-SKYPETEAMSMEETINGURL"))
+
+	_, err = Parse(strings.NewReader("BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n"))
+	assert.Error(t, err)
+}
+
+func TestEvents(t *testing.T) {
+	c, err := Parse(strings.NewReader(testCalendar))
+	require.NoError(t, err)
+
+	cet := time.FixedZone("CET", 3600)
+	cest := time.FixedZone("CEST", 7200)
+
+	events := c.Events(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), "me@example.com")
+
+	var starts []time.Time
+	var titles []string
+	for _, e := range events {
+		if e.UID == "weekly@example.com" {
+			starts = append(starts, e.Start)
+			titles = append(titles, e.Title)
+		}
+	}
+	// 03-10 is excluded, 03-17 is moved to 03-18, 03-24 is cancelled,
+	// and 03-31 is after the change to daylight saving time.
+	assert.Equal(t, []time.Time{
+		time.Date(2025, 3, 3, 10, 0, 0, 0, cet).UTC(),
+		time.Date(2025, 3, 18, 14, 0, 0, 0, cet).UTC(),
+		time.Date(2025, 3, 31, 10, 0, 0, 0, cest).UTC(),
+	}, utc(starts))
+	assert.Equal(t, []string{"Weekly Sync", "Weekly Sync (moved)", "Weekly Sync"}, titles)
+
+	first := events[0]
+	assert.Equal(t, 30*time.Minute, first.End.Sub(first.Start))
+	last := events[len(events)-1]
+	assert.Equal(t, 30*time.Minute, last.End.Sub(last.Start))
+	assert.Equal(t, "Bob", first.Organizer)
+	assert.False(t, first.IsOrganizer)
+	assert.Equal(t, models.ResponseNotResponded, first.Response)
+	assert.Equal(t, "https://teams.microsoft.com/l/meetup-join/abc", first.JoinURL)
+	assert.Equal(t, "Room 1", first.Location)
+	assert.Equal(t, []time.Duration{15 * time.Minute}, first.Alarms)
+	assert.Equal(t, []models.Attendee{
+		{Name: "Alice", Email: "alice@example.com", Type: models.AttendeeRequired, Response: models.ResponseAccepted},
+		{Name: "Me, Myself", Email: "me@example.com", Type: models.AttendeeOptional, Response: models.ResponseNotResponded},
+		{Name: "Room 1", Email: "room1@example.com", Type: models.AttendeeResource, Response: models.ResponseAccepted},
+	}, first.Attendees)
+
+	var holiday, tokyo *models.Event
+	for i := range events {
+		switch events[i].UID {
+		case "holiday@example.com":
+			holiday = &events[i]
+		case "tokyo@example.com":
+			tokyo = &events[i]
+		}
+	}
+	require.NotNil(t, holiday)
+	assert.True(t, holiday.AllDay)
+	assert.Equal(t, time.Date(2025, 3, 5, 0, 0, 0, 0, time.Local), holiday.Start)
+	require.NotNil(t, tokyo)
+	assert.Equal(t, time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC), tokyo.Start.UTC())
+	assert.Equal(t, time.Hour, tokyo.End.Sub(tokyo.Start))
+}
+
+func TestEventsRange(t *testing.T) {
+	c, err := Parse(strings.NewReader(testCalendar))
+	require.NoError(t, err)
+
+	// The moved occurrence is found at its new time only
+	events := c.Events(time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 18, 0, 0, 0, 0, time.UTC), "")
+	assert.Empty(t, events)
+	events = c.Events(time.Date(2025, 3, 18, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 19, 0, 0, 0, 0, time.UTC), "")
+	require.Len(t, events, 1)
+	assert.Equal(t, "Weekly Sync (moved)", events[0].Title)
+}
+
+func utc(times []time.Time) []time.Time {
+	var result []time.Time
+	for _, t := range times {
+		result = append(result, t.UTC())
+	}
+	return result
+}
+
+func TestRRule(t *testing.T) {
+	type TestCase struct {
+		rule     string
+		dtstart  time.Time
+		expected []time.Time
+	}
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+	}
+
+	testCases := []TestCase{
+		{
+			rule:     "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			dtstart:  date(2025, 1, 30),
+			expected: []time.Time{date(2025, 1, 30), date(2025, 2, 1), date(2025, 2, 3)},
+		},
+		{
+			rule:     "FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20250110T235959Z",
+			dtstart:  date(2025, 1, 2),
+			expected: []time.Time{date(2025, 1, 2), date(2025, 1, 7), date(2025, 1, 9)},
+		},
+		{
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3",
+			dtstart:  date(2025, 1, 31),
+			expected: []time.Time{date(2025, 1, 31), date(2025, 3, 31), date(2025, 5, 31)},
+		},
+		{
+			rule:     "FREQ=MONTHLY;BYDAY=-1FR;COUNT=2",
+			dtstart:  date(2025, 1, 1),
+			expected: []time.Time{date(2025, 1, 31), date(2025, 2, 28)},
+		},
+		{
+			// Last weekday of the month
+			rule:     "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=2",
+			dtstart:  date(2025, 5, 1),
+			expected: []time.Time{date(2025, 5, 30), date(2025, 6, 30)},
+		},
+		{
+			rule:     "FREQ=YEARLY;BYMONTH=3,10;BYDAY=-1SU;COUNT=3",
+			dtstart:  date(2025, 1, 1),
+			expected: []time.Time{date(2025, 3, 30), date(2025, 10, 26), date(2026, 3, 29)},
+		},
+		{
+			// Every Monday of the year
+			rule:     "FREQ=YEARLY;BYDAY=MO;COUNT=3",
+			dtstart:  date(2025, 12, 20),
+			expected: []time.Time{date(2025, 12, 22), date(2025, 12, 29), date(2026, 1, 5)},
+		},
+		{
+			// The 20th Monday of the year, and the last one
+			rule:     "FREQ=YEARLY;BYDAY=20MO,-1MO;COUNT=3",
+			dtstart:  date(2025, 1, 1),
+			expected: []time.Time{date(2025, 5, 19), date(2025, 12, 29), date(2026, 5, 18)},
+		},
+		{
+			rule:     "FREQ=YEARLY;BYMONTHDAY=15;COUNT=3",
+			dtstart:  date(2025, 11, 1),
+			expected: []time.Time{date(2025, 11, 15), date(2025, 12, 15), date(2026, 1, 15)},
+		},
+		{
+			rule:     "FREQ=YEARLY;COUNT=2",
+			dtstart:  date(2024, 2, 29),
+			expected: []time.Time{date(2024, 2, 29), date(2028, 2, 29)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.rule, func(t *testing.T) {
+			rule, err := ParseRRule(tc.rule, utcZone)
+			require.NoError(t, err)
+
+			var got []time.Time
+			rule.each(tc.dtstart, utcZone, func(wall time.Time) bool {
+				got = append(got, wall)
+				return len(got) < 10
+			})
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	_, err := ParseRRule("FREQ=HOURLY", utcZone)
+	assert.Error(t, err)
+}
+
+func TestRecurrences(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	starts, err := Recurrences("FREQ=WEEKLY;BYDAY=MO,FR", time.Date(2025, 6, 2, 9, 30, 0, 0, tokyo),
+		time.Date(2025, 6, 6, 0, 30, 0, 0, time.UTC), time.Date(2025, 6, 13, 0, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		time.Date(2025, 6, 6, 9, 30, 0, 0, tokyo),
+		time.Date(2025, 6, 9, 9, 30, 0, 0, tokyo),
+	}, starts)
+
+	_, err = Recurrences("FREQ=SECONDLY", time.Now(), time.Now(), time.Now())
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"-PT15M":   -15 * time.Minute,
+		"PT1H30M":  90 * time.Minute,
+		"P1DT2H":   26 * time.Hour,
+		"+P1W":     7 * 24 * time.Hour,
+		"-PT0S":    0,
+		"PT10M30S": 10*time.Minute + 30*time.Second,
+	} {
+		d, err := ParseDuration(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+	for _, s := range []string{"", "P", "PT", "15M", "P1H", "PT1D"} {
+		_, err := ParseDuration(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,206 @@
+// Package ical reads iCalendar (RFC 5545) data and expands its events into occurrences.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Property is a content line of a component, like "DTSTART;TZID=Asia/Tokyo:20250610T150400".
+type Property struct {
+	Name string
+	// Params holds the parameters by upper-case name. Multiple values are joined with ",".
+	Params map[string]string
+	Value  string
+}
+
+// Component is a block between BEGIN and END, like VEVENT.
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+// Get returns the first property with the name, or nil.
+func (c *Component) Get(name string) *Property {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// GetAll returns the properties with the name.
+func (c *Component) GetAll(name string) []Property {
+	var properties []Property
+	for _, p := range c.Properties {
+		if p.Name == name {
+			properties = append(properties, p)
+		}
+	}
+	return properties
+}
+
+// Text returns the unescaped value of the first property with the name, or "".
+func (c *Component) Text(name string) string {
+	p := c.Get(name)
+	if p == nil {
+		return ""
+	}
+	return unescapeText(p.Value)
+}
+
+// Children returns the direct sub-components with the name.
+func (c *Component) Children(name string) []*Component {
+	var components []*Component
+	for _, child := range c.Components {
+		if child.Name == name {
+			components = append(components, child)
+		}
+	}
+	return components
+}
+
+// ParseComponents reads all top-level components, usually a single VCALENDAR.
+func ParseComponents(r io.Reader) ([]*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*Component
+	var stack []*Component
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch p.Name {
+		case "BEGIN":
+			stack = append(stack, &Component{Name: strings.ToUpper(p.Value)})
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, p.Value)
+			}
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				roots = append(roots, c)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			}
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside of a component", i+1, p.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, p)
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+	return roots, nil
+}
+
+// unfold joins the content lines split over several physical lines.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine parses "NAME;PARAM=value;PARAM="quoted":value".
+func parseLine(line string) (Property, error) {
+	p := Property{Params: map[string]string{}}
+
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return p, fmt.Errorf("invalid content line: %q", line)
+	}
+	p.Name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		rest := line[i+1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return p, fmt.Errorf("invalid parameter in content line: %q", line)
+		}
+		name := strings.ToUpper(rest[:eq])
+
+		// Values are separated by "," and may be quoted to contain ";", ":" and ","
+		var values []string
+		j := eq + 1
+		for {
+			var value string
+			if j < len(rest) && rest[j] == '"' {
+				end := strings.IndexByte(rest[j+1:], '"')
+				if end < 0 {
+					return p, fmt.Errorf("unterminated quoted parameter in content line: %q", line)
+				}
+				value = rest[j+1 : j+1+end]
+				j += end + 2
+			} else {
+				end := strings.IndexAny(rest[j:], ",;:")
+				if end < 0 {
+					return p, fmt.Errorf("missing value in content line: %q", line)
+				}
+				value = rest[j : j+end]
+				j += end
+			}
+			values = append(values, value)
+			if j < len(rest) && rest[j] == ',' {
+				j++
+				continue
+			}
+			break
+		}
+		p.Params[name] = strings.Join(values, ",")
+
+		i += 1 + j
+		if i >= len(line) {
+			return p, fmt.Errorf("missing value in content line: %q", line)
+		}
+	}
+
+	p.Value = line[i+1:]
+	return p, nil
+}
+
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,464 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is a recurrence rule.
+// FREQ of DAILY, WEEKLY, MONTHLY and YEARLY is supported, with INTERVAL, COUNT,
+// UNTIL, BYDAY, BYMONTHDAY, BYMONTH, BYSETPOS and WKST.
+type RRule struct {
+	Freq     string
+	Interval int
+	Count    int
+	// Until is the last instant an occurrence may start at. Zero if unbounded.
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// WeekdayNum is an entry of BYDAY, like "MO" or "-1FR" (the last Friday).
+type WeekdayNum struct {
+	// N is the ordinal within the month or year. 0 for every such weekday.
+	N       int
+	Weekday time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rules generating more periods than this are cut off
+const maxPeriods = 200000
+
+// ParseRRule parses a recurrence rule like "FREQ=WEEKLY;BYDAY=MO,WE".
+// A local UNTIL is converted to an instant with z.
+func ParseRRule(s string, z zone) (*RRule, error) {
+	rule := &RRule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule part: %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err == nil && rule.Interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+		case "UNTIL":
+			rule.Until, err = parseUntil(value, z)
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				var wd WeekdayNum
+				if wd, err = parseWeekdayNum(v); err != nil {
+					break
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseInts(value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseInts(value, 1, 12)
+			for _, m := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			rule.BySetPos, err = parseInts(value, -366, 366)
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(value)]
+			if !ok {
+				err = fmt.Errorf("unknown weekday")
+			}
+			rule.WeekStart = wd
+		case "BYHOUR", "BYMINUTE", "BYSECOND", "BYWEEKNO", "BYYEARDAY":
+			err = fmt.Errorf("not supported")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in rule %q: %w", name, s, err)
+		}
+	}
+
+	switch rule.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ in rule %q", s)
+	}
+	return rule, nil
+}
+
+func parseUntil(value string, z zone) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.ParseInLocation(dateTimeLayout, strings.TrimSuffix(value, "Z"), time.UTC)
+	}
+	if len(value) == len(dateLayout) {
+		// A date includes the whole day
+		t, err := time.ParseInLocation(dateLayout, value, time.UTC)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return z.instant(t.Add(24*time.Hour - time.Second)), nil
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, value, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return z.instant(t), nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid weekday: %q", s)
+	}
+	wd, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid weekday: %q", s)
+	}
+	n := 0
+	if prefix := s[:len(s)-2]; prefix != "" {
+		var err error
+		if n, err = strconv.Atoi(prefix); err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("invalid weekday: %q", s)
+		}
+	}
+	return WeekdayNum{N: n, Weekday: wd}, nil
+}
+
+func parseInts(s string, min, max int) ([]int, error) {
+	var values []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, fmt.Errorf("invalid value: %q", v)
+		}
+		values = append(values, n)
+	}
+	return values, nil
+}
+
+// Recurrences returns the starts of the occurrences of the recurrence rule
+// which are in [start, end). The rule repeats the wall clock time of dtstart
+// in its location.
+func Recurrences(rule string, dtstart, start, end time.Time) ([]time.Time, error) {
+	z := locationZone{loc: dtstart.Location()}
+	r, err := ParseRRule(rule, z)
+	if err != nil {
+		return nil, err
+	}
+
+	wall := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, time.UTC)
+	var starts []time.Time
+	r.each(wall, z, func(t time.Time) bool {
+		instant := z.instant(t)
+		if !instant.Before(end) {
+			return false
+		}
+		if !instant.Before(start) {
+			starts = append(starts, instant)
+		}
+		return true
+	})
+	return starts, nil
+}
+
+// each calls f with the wall clock start of each occurrence in order,
+// starting with dtstart if it matches the rule, until f returns false or the rule ends.
+// z converts wall clock times to instants to compare them with Until.
+func (r *RRule) each(dtstart time.Time, z zone, f func(wall time.Time) bool) {
+	count := 0
+	for period := 0; period < maxPeriods; period++ {
+		candidates := r.periodDates(dtstart, period*r.Interval)
+		if candidates == nil {
+			return
+		}
+		candidates = r.applySetPos(candidates)
+
+		for _, date := range candidates {
+			t := time.Date(date.Year(), date.Month(), date.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, time.UTC)
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.Until.IsZero() && z.instant(t).After(r.Until) {
+				return
+			}
+			if !f(t) {
+				return
+			}
+			count++
+			if r.Count > 0 && count >= r.Count {
+				return
+			}
+		}
+	}
+}
+
+// periodDates returns the dates of the period which is offset periods after
+// the one of dtstart, sorted. It returns nil after year 9999.
+func (r *RRule) periodDates(dtstart time.Time, offset int) []time.Time {
+	var dates []time.Time
+	add := func(t time.Time) {
+		if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, t.Month()) {
+			return
+		}
+		dates = append(dates, t)
+	}
+
+	start := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, time.UTC)
+	switch r.Freq {
+	case "DAILY":
+		day := start.AddDate(0, 0, offset)
+		if day.Year() > 9999 {
+			return nil
+		}
+		if r.matchesDay(day) {
+			add(day)
+		}
+	case "WEEKLY":
+		weekStart := start.AddDate(0, 0, -((int(start.Weekday())-int(r.WeekStart)+7)%7)).AddDate(0, 0, 7*offset)
+		if weekStart.Year() > 9999 {
+			return nil
+		}
+		for i := 0; i < 7; i++ {
+			day := weekStart.AddDate(0, 0, i)
+			if len(r.ByDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if len(r.ByDay) > 0 && !r.matchesDay(day) {
+				continue
+			}
+			add(day)
+		}
+	case "MONTHLY":
+		month := time.Date(start.Year(), start.Month()+time.Month(offset), 1, 0, 0, 0, 0, time.UTC)
+		if month.Year() > 9999 {
+			return nil
+		}
+		for _, day := range r.monthDates(month, dtstart.Day()) {
+			add(day)
+		}
+	case "YEARLY":
+		year := start.Year() + offset
+		if year > 9999 {
+			return nil
+		}
+		if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) > 0 {
+			// BYDAY is the weekdays of the whole year, and its ordinals are within the year
+			for _, day := range r.yearDates(year) {
+				add(day)
+			}
+			break
+		}
+		months := r.ByMonth
+		switch {
+		case len(months) > 0:
+		case len(r.ByMonthDay) > 0:
+			// BYMONTHDAY is the days of every month
+			for m := time.January; m <= time.December; m++ {
+				months = append(months, m)
+			}
+		default:
+			months = []time.Month{dtstart.Month()}
+		}
+		for _, m := range months {
+			for _, day := range r.monthDates(time.Date(year, m, 1, 0, 0, 0, 0, time.UTC), dtstart.Day()) {
+				add(day)
+			}
+		}
+		sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	}
+	if dates == nil {
+		dates = []time.Time{}
+	}
+	return dates
+}
+
+// matchesDay filters a day by BYDAY without ordinals and BYMONTHDAY.
+func (r *RRule) matchesDay(day time.Time) bool {
+	if len(r.ByDay) > 0 {
+		found := false
+		for _, wd := range r.ByDay {
+			if wd.Weekday == day.Weekday() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ByMonthDay) > 0 {
+		last := daysIn(day.Year(), day.Month())
+		found := false
+		for _, md := range r.ByMonthDay {
+			if md == day.Day() || last+md+1 == day.Day() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// monthDates returns the days of the month matching BYMONTHDAY and BYDAY, sorted.
+// Without either, it is the day of month of the start, if the month has it.
+func (r *RRule) monthDates(month time.Time, defaultDay int) []time.Time {
+	last := daysIn(month.Year(), month.Month())
+	matches := map[int]bool{}
+
+	if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+		if defaultDay <= last {
+			matches[defaultDay] = true
+		}
+	}
+
+	var byMonthDay map[int]bool
+	if len(r.ByMonthDay) > 0 {
+		byMonthDay = map[int]bool{}
+		for _, md := range r.ByMonthDay {
+			day := md
+			if md < 0 {
+				day = last + md + 1
+			}
+			if day >= 1 && day <= last {
+				byMonthDay[day] = true
+			}
+		}
+	}
+
+	var byDay map[int]bool
+	if len(r.ByDay) > 0 {
+		byDay = map[int]bool{}
+		firstWeekday := month.Weekday()
+		for _, wd := range r.ByDay {
+			first := 1 + (int(wd.Weekday)-int(firstWeekday)+7)%7
+			switch {
+			case wd.N == 0:
+				for day := first; day <= last; day += 7 {
+					byDay[day] = true
+				}
+			case wd.N > 0:
+				if day := first + 7*(wd.N-1); day <= last {
+					byDay[day] = true
+				}
+			default:
+				lastOccurrence := first + 7*((last-first)/7)
+				if day := lastOccurrence + 7*(wd.N+1); day >= 1 {
+					byDay[day] = true
+				}
+			}
+		}
+	}
+
+	switch {
+	case byMonthDay != nil && byDay != nil:
+		for day := range byMonthDay {
+			if byDay[day] {
+				matches[day] = true
+			}
+		}
+	case byMonthDay != nil:
+		matches = byMonthDay
+	case byDay != nil:
+		matches = byDay
+	}
+
+	var days []int
+	for day := range matches {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	var dates []time.Time
+	for _, day := range days {
+		dates = append(dates, time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, time.UTC))
+	}
+	return dates
+}
+
+// yearDates returns the days of the year matching BYDAY, whose ordinals are within the year, sorted.
+func (r *RRule) yearDates(year int) []time.Time {
+	january1 := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	last := january1.AddDate(1, 0, -1).YearDay()
+	matches := map[int]bool{}
+	for _, wd := range r.ByDay {
+		first := 1 + (int(wd.Weekday)-int(january1.Weekday())+7)%7
+		switch {
+		case wd.N == 0:
+			for day := first; day <= last; day += 7 {
+				matches[day] = true
+			}
+		case wd.N > 0:
+			if day := first + 7*(wd.N-1); day <= last {
+				matches[day] = true
+			}
+		default:
+			lastOccurrence := first + 7*((last-first)/7)
+			if day := lastOccurrence + 7*(wd.N+1); day >= 1 {
+				matches[day] = true
+			}
+		}
+	}
+
+	var days []int
+	for day := range matches {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	var dates []time.Time
+	for _, day := range days {
+		dates = append(dates, january1.AddDate(0, 0, day-1))
+	}
+	return dates
+}
+
+func (r *RRule) applySetPos(dates []time.Time) []time.Time {
+	if len(r.BySetPos) == 0 || len(dates) == 0 {
+		return dates
+	}
+	var selected []time.Time
+	for i, date := range dates {
+		for _, pos := range r.BySetPos {
+			if pos == i+1 || pos == i-len(dates) {
+				selected = append(selected, date)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
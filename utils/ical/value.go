@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wall clock times are represented as time.Time in UTC, and converted to
+// instants by the zone of their TZID.
+type zone interface {
+	instant(wall time.Time) time.Time
+}
+
+type locationZone struct {
+	loc *time.Location
+}
+
+func (z locationZone) instant(w time.Time) time.Time {
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, z.loc)
+}
+
+var utcZone = locationZone{loc: time.UTC}
+
+// floatingZone is used for times without TZID, which are in the local time of the user.
+var floatingZone = locationZone{loc: time.Local}
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+)
+
+// observance is a STANDARD or DAYLIGHT component of a VTIMEZONE.
+type observance struct {
+	offsetFrom time.Duration
+	offsetTo   time.Duration
+	// onsets are the wall clock times, in offsetFrom, the observance starts at
+	onsets []time.Time
+}
+
+// vtimezone is a time zone defined in the calendar itself.
+type vtimezone struct {
+	observances []observance
+}
+
+// Transitions of recurring observances are generated until this year
+const maxTransitionYear = 2100
+
+func parseVTimezone(c *Component) (*vtimezone, error) {
+	z := &vtimezone{}
+	for _, child := range c.Components {
+		if child.Name != "STANDARD" && child.Name != "DAYLIGHT" {
+			continue
+		}
+
+		var o observance
+		var err error
+		if o.offsetFrom, err = parseOffset(child.Get("TZOFFSETFROM")); err != nil {
+			return nil, err
+		}
+		if o.offsetTo, err = parseOffset(child.Get("TZOFFSETTO")); err != nil {
+			return nil, err
+		}
+
+		dtstart := child.Get("DTSTART")
+		if dtstart == nil {
+			return nil, fmt.Errorf("missing DTSTART in %s", child.Name)
+		}
+		start, err := time.ParseInLocation(dateTimeLayout, dtstart.Value, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DTSTART in %s: %w", child.Name, err)
+		}
+		o.onsets = append(o.onsets, start)
+
+		for _, p := range child.GetAll("RDATE") {
+			for _, value := range strings.Split(p.Value, ",") {
+				if t, err := time.ParseInLocation(dateTimeLayout, strings.TrimSuffix(value, "Z"), time.UTC); err == nil {
+					o.onsets = append(o.onsets, t)
+				}
+			}
+		}
+
+		if p := child.Get("RRULE"); p != nil {
+			// UNTIL of an observance is in UTC, which is close enough to compare with its onsets
+			rule, err := ParseRRule(p.Value, utcZone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE in %s: %w", child.Name, err)
+			}
+			limit := time.Date(maxTransitionYear, 1, 1, 0, 0, 0, 0, time.UTC)
+			rule.each(start, utcZone, func(t time.Time) bool {
+				if t.After(limit) {
+					return false
+				}
+				if !t.Equal(start) {
+					o.onsets = append(o.onsets, t)
+				}
+				return true
+			})
+		}
+
+		sort.Slice(o.onsets, func(i, j int) bool { return o.onsets[i].Before(o.onsets[j]) })
+		z.observances = append(z.observances, o)
+	}
+	if len(z.observances) == 0 {
+		return nil, fmt.Errorf("no STANDARD or DAYLIGHT in VTIMEZONE")
+	}
+	return z, nil
+}
+
+func (z *vtimezone) instant(w time.Time) time.Time {
+	var offset time.Duration
+	var latest time.Time
+	found := false
+	for _, o := range z.observances {
+		// Latest onset not after w
+		i := sort.Search(len(o.onsets), func(i int) bool { return o.onsets[i].After(w) })
+		if i == 0 {
+			continue
+		}
+		if onset := o.onsets[i-1]; !found || onset.After(latest) {
+			latest = onset
+			offset = o.offsetTo
+			found = true
+		}
+	}
+	if !found {
+		// Before the first onset, the offset the first observance changes from applies
+		first := z.observances[0]
+		for _, o := range z.observances[1:] {
+			if o.onsets[0].Before(first.onsets[0]) {
+				first = o
+			}
+		}
+		offset = first.offsetFrom
+	}
+	return w.Add(-offset)
+}
+
+// parseOffset parses a UTC offset like "+0900" or "-053000".
+func parseOffset(p *Property) (time.Duration, error) {
+	if p == nil {
+		return 0, fmt.Errorf("missing UTC offset")
+	}
+	s := p.Value
+	if (len(s) != 5 && len(s) != 7) || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset: %q", s)
+	}
+	hours, err1 := strconv.Atoi(s[1:3])
+	minutes, err2 := strconv.Atoi(s[3:5])
+	seconds := 0
+	var err3 error
+	if len(s) == 7 {
+		seconds, err3 = strconv.Atoi(s[5:7])
+	}
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, fmt.Errorf("invalid UTC offset: %q", s)
+	}
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	if s[0] == '-' {
+		d = -d
+	}
+	return d, nil
+}
+
+// ParseDuration parses a duration like "-PT15M" or "P1DT2H".
+func ParseDuration(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid duration: %q", s)
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, invalid
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	number := ""
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			number += string(r)
+			continue
+		case r == 'T':
+			if inTime || number != "" {
+				return 0, invalid
+			}
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, invalid
+		}
+		number = ""
+		switch {
+		case r == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case r == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case r == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case r == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case r == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, invalid
+		}
+	}
+	if number != "" {
+		return 0, invalid
+	}
+	return sign * d, nil
+}
@@ -0,0 +1,61 @@
+package ntlm
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// md4 returns the MD4 digest of data, which NTLM uses to hash passwords.
+// DOC: https://www.rfc-editor.org/rfc/rfc1320
+func md4(data []byte) [16]byte {
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+
+	// Padding to 56 bytes modulo 64, followed by the length in bits
+	msg := append([]byte{}, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	f := func(x, y, z uint32) uint32 { return x&y | ^x&z }
+	g := func(x, y, z uint32) uint32 { return x&y | x&z | y&z }
+	h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+
+	var x [16]uint32
+	for len(msg) > 0 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[4*i:])
+		}
+		msg = msg[64:]
+		aa, bb, cc, dd := a, b, c, d
+
+		for _, i := range []int{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+f(b, c, d)+x[i], 3)
+			d = bits.RotateLeft32(d+f(a, b, c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+f(d, a, b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+f(c, d, a)+x[i+3], 19)
+		}
+		for _, i := range []int{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+g(b, c, d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+g(a, b, c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+g(d, a, b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+g(c, d, a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range []int{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+h(b, c, d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+h(a, b, c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+h(d, a, b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+h(c, d, a)+x[i+12]+0x6ed9eba1, 15)
+		}
+
+		a, b, c, d = a+aa, b+bb, c+cc, d+dd
+	}
+
+	var digest [16]byte
+	binary.LittleEndian.PutUint32(digest[0:], a)
+	binary.LittleEndian.PutUint32(digest[4:], b)
+	binary.LittleEndian.PutUint32(digest[8:], c)
+	binary.LittleEndian.PutUint32(digest[12:], d)
+	return digest
+}
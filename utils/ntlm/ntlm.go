@@ -0,0 +1,225 @@
+// Package ntlm authenticates HTTP requests with NTLMv2, as used by on-premises Exchange.
+// DOC: https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-nlmp
+package ntlm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	flagUnicode                 = 0x00000001
+	flagRequestTarget           = 0x00000004
+	flagNTLM                    = 0x00000200
+	flagAlwaysSign              = 0x00008000
+	flagExtendedSessionSecurity = 0x00080000
+	flagTargetInfo              = 0x00800000
+	flag128                     = 0x20000000
+	flag56                      = 0x80000000
+
+	negotiateFlags = flagUnicode | flagRequestTarget | flagNTLM | flagAlwaysSign |
+		flagExtendedSessionSecurity | flagTargetInfo | flag128 | flag56
+)
+
+var signature = []byte("NTLMSSP\x00")
+
+// Attribute of the target info holding the time of the server
+const avTimestamp = 7
+
+// Transport is an http.RoundTripper signing in to the server with NTLM.
+// Each request is sent with the handshake, as the authentication is bound to the connection.
+type Transport struct {
+	// Domain of the user. It may also be given in Username, as in `DOMAIN\user`.
+	Domain   string
+	Username string
+	Password string
+	// Base sends the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// The body is sent twice
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	withAuthorization := func(message []byte) *http.Request {
+		r := req.Clone(req.Context())
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(message))
+		return r
+	}
+
+	resp, err := base.RoundTrip(withAuthorization(negotiateMessage()))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	var challengeMessage []byte
+	for _, value := range resp.Header.Values("WWW-Authenticate") {
+		if encoded, ok := strings.CutPrefix(value, "NTLM "); ok {
+			challengeMessage, _ = base64.StdEncoding.DecodeString(encoded)
+		}
+	}
+	if challengeMessage == nil {
+		// The server doesn't support NTLM, or refused the credentials
+		return resp, nil
+	}
+	// The connection is reused for the authentication only if the response is read
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	c, err := parseChallenge(challengeMessage)
+	if err != nil {
+		return nil, err
+	}
+	domain, user := t.Domain, t.Username
+	if d, u, ok := strings.Cut(user, `\`); ok && domain == "" {
+		domain, user = d, u
+	}
+	var clientChallenge [8]byte
+	if _, err := rand.Read(clientChallenge[:]); err != nil {
+		return nil, err
+	}
+	message := authenticateMessage(domain, user, t.Password, c, clientChallenge, fileTime(time.Now()))
+	return base.RoundTrip(withAuthorization(message))
+}
+
+func negotiateMessage() []byte {
+	// The domain and workstation are not given
+	msg := make([]byte, 32)
+	copy(msg, signature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], negotiateFlags)
+	return msg
+}
+
+type challenge struct {
+	flags           uint32
+	serverChallenge [8]byte
+	targetInfo      []byte
+}
+
+func parseChallenge(msg []byte) (*challenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], signature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, fmt.Errorf("invalid NTLM challenge")
+	}
+	c := &challenge{flags: binary.LittleEndian.Uint32(msg[20:])}
+	copy(c.serverChallenge[:], msg[24:32])
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, fmt.Errorf("invalid NTLM challenge")
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+// authenticateMessage answers the challenge with the NTLMv2 response.
+// timestamp is the current time as FILETIME, used unless the server gives its time.
+func authenticateMessage(domain, user, password string, c *challenge, clientChallenge [8]byte, timestamp []byte) []byte {
+	if serverTime := avPair(c.targetInfo, avTimestamp); len(serverTime) == 8 {
+		timestamp = serverTime
+	}
+	key := ntowfv2(user, password, domain)
+	nt, lm := ntlmv2Response(key, c.serverChallenge, clientChallenge, timestamp, c.targetInfo)
+
+	fields := [][]byte{lm, nt, utf16le(domain), utf16le(user), nil, nil}
+	const headerSize = 64
+	msg := make([]byte, headerSize)
+	copy(msg, signature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerSize
+	for i, field := range fields {
+		pos := 12 + 8*i
+		binary.LittleEndian.PutUint16(msg[pos:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[pos+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[pos+4:], uint32(offset))
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], negotiateFlags&c.flags|flagUnicode|flagNTLM)
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+	return msg
+}
+
+// ntowfv2 derives the key of the NTLMv2 responses from the password.
+func ntowfv2(user, password, domain string) []byte {
+	hash := md4(utf16le(password))
+	return hmacMD5(hash[:], utf16le(strings.ToUpper(user)+domain))
+}
+
+func ntlmv2Response(key []byte, serverChallenge, clientChallenge [8]byte, timestamp, targetInfo []byte) (nt, lm []byte) {
+	blob := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge[:]...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	proof := hmacMD5(key, serverChallenge[:], blob)
+	nt = append(proof, blob...)
+	lm = append(hmacMD5(key, serverChallenge[:], clientChallenge[:]), clientChallenge[:]...)
+	return nt, lm
+}
+
+// avPair returns the value of an attribute of the target info.
+func avPair(targetInfo []byte, id uint16) []byte {
+	for len(targetInfo) >= 4 {
+		attr := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if attr == 0 || 4+length > len(targetInfo) {
+			return nil
+		}
+		if attr == id {
+			return targetInfo[4 : 4+length]
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return nil
+}
+
+// fileTime encodes t as a Windows FILETIME, the number of 100ns since 1601.
+func fileTime(t time.Time) []byte {
+	const epochDiff = 116444736000000000
+	return binary.LittleEndian.AppendUint64(nil, uint64(t.UnixNano()/100+epochDiff))
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMD4(t *testing.T) {
+	// Test suite of RFC 1320
+	for input, expected := range map[string]string{
+		"":    "31d6cfe0d16ae931b73c59d7e0c089c0",
+		"abc": "a448017aaf21d8525fc10ae87aa6729d",
+		"12345678901234567890123456789012345678901234567890123456789012345678901234567890": "e33b4ddc9c38f2199c3e7b164fcc0536",
+	} {
+		digest := md4([]byte(input))
+		assert.Equal(t, expected, hex.EncodeToString(digest[:]), input)
+	}
+}
+
+// Example of MS-NLMP 4.2.4
+var (
+	testServerChallenge = [8]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	testClientChallenge = [8]byte{0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa, 0xaa}
+	testTargetInfo      = mustDecodeHex("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestNTLMv2Response(t *testing.T) {
+	key := ntowfv2("User", "Password", "Domain")
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(key))
+
+	nt, lm := ntlmv2Response(key, testServerChallenge, testClientChallenge, make([]byte, 8), testTargetInfo)
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(nt[:16]))
+	assert.Equal(t, "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa", hex.EncodeToString(lm))
+}
+
+// challengeMessage builds a challenge of the server with the target info of the example.
+func challengeMessage() []byte {
+	msg := make([]byte, 48)
+	copy(msg, signature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], negotiateFlags)
+	copy(msg[24:], testServerChallenge[:])
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(testTargetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(testTargetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return append(msg, testTargetInfo...)
+}
+
+// field returns a security buffer of an authenticate message.
+func field(msg []byte, index int) []byte {
+	pos := 12 + 8*index
+	length := int(binary.LittleEndian.Uint16(msg[pos:]))
+	offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+	return msg[offset : offset+length]
+}
+
+func TestTransport(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+		assert.Equal(t, "<soap/>", body.String())
+
+		encoded, ok := strings.CutPrefix(r.Header.Get("Authorization"), "NTLM ")
+		require.True(t, ok)
+		msg, err := base64.StdEncoding.DecodeString(encoded)
+		require.NoError(t, err)
+
+		switch binary.LittleEndian.Uint32(msg[8:]) {
+		case 1:
+			w.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(challengeMessage()))
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			// Verify the response with the password of the user
+			assert.Equal(t, utf16le("Domain"), field(msg, 2))
+			assert.Equal(t, utf16le("User"), field(msg, 3))
+			nt := field(msg, 1)
+			key := ntowfv2("User", "Password", "Domain")
+			if !bytes.Equal(nt[:16], hmacMD5(key, testServerChallenge[:], nt[16:])) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("ok"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: &Transport{Username: `Domain\User`, Password: "Password"}}
+	resp, err := client.Post(server.URL, "text/xml", strings.NewReader("<soap/>"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+
+	client = &http.Client{Transport: &Transport{Username: `Domain\User`, Password: "Wrong"}}
+	resp, err = client.Post(server.URL, "text/xml", strings.NewReader("<soap/>"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
@@ -1,15 +1,45 @@
 package utils
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os/exec"
+	"runtime"
 )
 
-func ExecCommand(command string, args ...string) error {
+// ExecCommand starts the command without waiting for it, unless ctx is done already.
+// The process is not killed with ctx, as it may be a browser the user keeps using,
+// but it is waited for in background so that it doesn't remain a zombie.
+func ExecCommand(ctx context.Context, command string, args ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	cmd := exec.Command(command, args...)
 	err := cmd.Start()
 	if err != nil {
 		log.Printf("failed to execute command: %s %v: %v", command, args, err)
+		return err
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("command failed: %s %v: %v", command, args, err)
+		}
+	}()
+	return nil
+}
+
+// OpenBrowser opens the URL or file with the default browser of the system.
+func OpenBrowser(ctx context.Context, url string) error {
+	// Branch commands by OS
+	switch runtime.GOOS {
+	case "windows":
+		return ExecCommand(ctx, "rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		return ExecCommand(ctx, "open", url)
+	case "linux":
+		return ExecCommand(ctx, "xdg-open", url)
+	default:
+		return fmt.Errorf("unsupported platform")
 	}
-	return err
 }
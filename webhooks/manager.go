@@ -0,0 +1,303 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/repositories"
+	"github.com/kajikentaro/meeting-reminder/utils/xtime"
+)
+
+// Subscriber creates and maintains Graph subscriptions of an account.
+// It is implemented by repositories.MicrosoftRepository.
+type Subscriber interface {
+	CreateSubscription(ctx context.Context, notificationURL, clientState string, expiration time.Time) (*repositories.Subscription, error)
+	RenewSubscription(ctx context.Context, id string, expiration time.Time) (*repositories.Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+}
+
+// Listener is notified about changes of the subscribed accounts.
+// It is implemented by services.CalendarService.
+type Listener interface {
+	// Refresh is called when the events of the account have changed.
+	// ctx is canceled when the manager is closed.
+	Refresh(ctx context.Context, account string)
+	// SetPushEnabled is called when change notifications of the account start or stop being delivered.
+	SetPushEnabled(account string, enabled bool)
+}
+
+const (
+	// Maximum lifetime of a subscription to Outlook events is 4230 minutes
+	defaultLifetime    = 70 * time.Hour
+	defaultRenewBefore = time.Hour
+	maxBodySize        = 1 << 20
+)
+
+// Manager keeps Graph subscriptions alive and receives their notifications.
+// It must be served at the notification URL given to NewManager.
+type Manager struct {
+	notificationURL string
+	listener        Listener
+	lifetime        time.Duration
+	renewBefore     time.Duration
+	// ctx is the context of the requests in background, canceled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu            sync.Mutex
+	subscriptions map[string]*subscription // by subscription id
+	// refreshes holds the accounts being refreshed, set if another refresh was requested meanwhile
+	refreshes map[string]bool
+}
+
+type subscription struct {
+	id          string
+	account     string
+	clientState string
+	subscriber  Subscriber
+	timer       *time.Timer
+}
+
+// NewManager creates a manager whose subscriptions send notifications to notificationURL.
+func NewManager(notificationURL string, listener Listener) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		notificationURL: notificationURL,
+		listener:        listener,
+		lifetime:        defaultLifetime,
+		renewBefore:     defaultRenewBefore,
+		ctx:             ctx,
+		cancel:          cancel,
+		subscriptions:   map[string]*subscription{},
+		refreshes:       map[string]bool{},
+	}
+}
+
+// Subscribe creates a subscription for the account and keeps it renewed.
+// If it fails, the account keeps being polled.
+func (m *Manager) Subscribe(ctx context.Context, account string, subscriber Subscriber) error {
+	clientState, err := randomClientState()
+	if err != nil {
+		return err
+	}
+
+	created, err := subscriber.CreateSubscription(ctx, m.notificationURL, clientState, xtime.Now().Add(m.lifetime))
+	if err != nil {
+		return fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	sub := &subscription{
+		id:          created.ID,
+		account:     account,
+		clientState: clientState,
+		subscriber:  subscriber,
+	}
+
+	m.mu.Lock()
+	m.subscriptions[sub.id] = sub
+	m.scheduleRenewal(sub, created.ExpirationDateTime)
+	m.mu.Unlock()
+
+	log.Printf("Subscribed to changes of account %q (subscription %s, expires at %s)", account, sub.id, created.ExpirationDateTime.Format(time.RFC3339))
+	m.listener.SetPushEnabled(account, true)
+	return nil
+}
+
+// Unsubscribe deletes the subscriptions of the account, which is polled from then on.
+func (m *Manager) Unsubscribe(ctx context.Context, account string) {
+	var subscriptions []*subscription
+	m.mu.Lock()
+	for id, sub := range m.subscriptions {
+		if sub.account == account {
+			subscriptions = append(subscriptions, sub)
+			delete(m.subscriptions, id)
+		}
+	}
+	m.mu.Unlock()
+
+	deleteSubscriptions(ctx, subscriptions)
+	m.listener.SetPushEnabled(account, false)
+}
+
+// Close cancels the requests in background and deletes all subscriptions, within the deadline of ctx.
+func (m *Manager) Close(ctx context.Context) {
+	m.cancel()
+	var subscriptions []*subscription
+	m.mu.Lock()
+	for _, sub := range m.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	m.subscriptions = map[string]*subscription{}
+	m.mu.Unlock()
+
+	deleteSubscriptions(ctx, subscriptions)
+}
+
+func deleteSubscriptions(ctx context.Context, subscriptions []*subscription) {
+	for _, sub := range subscriptions {
+		sub.timer.Stop()
+		if err := sub.subscriber.DeleteSubscription(ctx, sub.id); err != nil {
+			log.Printf("Failed to delete subscription %s: %v", sub.id, err)
+		}
+	}
+}
+
+// scheduleRenewal must be called with m.mu held.
+func (m *Manager) scheduleRenewal(sub *subscription, expiration time.Time) {
+	if sub.timer != nil {
+		sub.timer.Stop()
+	}
+	delay := expiration.Sub(xtime.Now()) - m.renewBefore
+	sub.timer = time.AfterFunc(delay, func() {
+		m.renew(sub.id)
+	})
+}
+
+// renew extends the subscription, or recreates it if it is gone.
+// If neither works, the account falls back to polling.
+func (m *Manager) renew(id string) {
+	m.mu.Lock()
+	sub, ok := m.subscriptions[id]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	renewed, err := sub.subscriber.RenewSubscription(m.ctx, id, xtime.Now().Add(m.lifetime))
+	if err == nil {
+		m.mu.Lock()
+		m.scheduleRenewal(sub, renewed.ExpirationDateTime)
+		m.mu.Unlock()
+		log.Printf("Renewed subscription %s until %s", id, renewed.ExpirationDateTime.Format(time.RFC3339))
+		return
+	}
+	log.Printf("Failed to renew subscription %s, recreating it: %v", id, err)
+	m.recreate(id)
+}
+
+func (m *Manager) recreate(id string) {
+	m.mu.Lock()
+	sub, ok := m.subscriptions[id]
+	if ok {
+		sub.timer.Stop()
+		delete(m.subscriptions, id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// Notifications may have been lost in the meantime
+	m.listener.Refresh(m.ctx, sub.account)
+	if err := m.Subscribe(m.ctx, sub.account, sub.subscriber); err != nil {
+		log.Printf("Failed to recreate subscription of account %q, falling back to polling: %v", sub.account, err)
+		m.listener.SetPushEnabled(sub.account, false)
+	}
+}
+
+// notification is a change or lifecycle notification.
+// DOC: https://learn.microsoft.com/en-us/graph/change-notifications-delivery-webhooks
+type notification struct {
+	SubscriptionID string `json:"subscriptionId"`
+	ClientState    string `json:"clientState"`
+	ChangeType     string `json:"changeType"`
+	Resource       string `json:"resource"`
+	LifecycleEvent string `json:"lifecycleEvent"`
+}
+
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Graph validates the endpoint when a subscription is created
+	// by sending a token which must be echoed back as plain text.
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, token)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Value []notification `json:"value"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&body); err != nil {
+		http.Error(w, "Invalid notification", http.StatusBadRequest)
+		return
+	}
+
+	// Graph expects a response within a few seconds, so notifications are handled in background
+	w.WriteHeader(http.StatusAccepted)
+
+	for _, n := range body.Value {
+		m.mu.Lock()
+		sub, ok := m.subscriptions[n.SubscriptionID]
+		m.mu.Unlock()
+		if !ok {
+			log.Printf("Ignored notification of unknown subscription %s", n.SubscriptionID)
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(n.ClientState), []byte(sub.clientState)) != 1 {
+			log.Printf("Ignored notification of subscription %s with invalid clientState", n.SubscriptionID)
+			continue
+		}
+
+		switch n.LifecycleEvent {
+		case "":
+			log.Printf("Received %s notification of account %q", n.ChangeType, sub.account)
+			m.refresh(sub.account)
+		case "reauthorizationRequired":
+			go m.renew(sub.id)
+		case "subscriptionRemoved":
+			go m.recreate(sub.id)
+		case "missed":
+			m.refresh(sub.account)
+		default:
+			log.Printf("Ignored unknown lifecycle event %q of subscription %s", n.LifecycleEvent, sub.id)
+		}
+	}
+}
+
+// refresh refreshes the account in background. The notifications received while it is refreshed,
+// like a burst of them, are coalesced into a single refresh which follows.
+func (m *Manager) refresh(account string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.refreshes[account]; ok {
+		m.refreshes[account] = true
+		return
+	}
+	m.refreshes[account] = false
+	go func() {
+		for {
+			m.listener.Refresh(m.ctx, account)
+			m.mu.Lock()
+			if !m.refreshes[account] {
+				delete(m.refreshes, account)
+				m.mu.Unlock()
+				return
+			}
+			m.refreshes[account] = false
+			m.mu.Unlock()
+		}
+	}()
+}
+
+func randomClientState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,227 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kajikentaro/meeting-reminder/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSubscriber struct {
+	mu          sync.Mutex
+	clientState string
+	renewed     int
+	deleted     []string
+	createErr   error
+	renewErr    error
+	expiration  time.Duration
+}
+
+func (f *fakeSubscriber) CreateSubscription(ctx context.Context, notificationURL, clientState string, expiration time.Time) (*repositories.Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	f.clientState = clientState
+	return &repositories.Subscription{ID: "sub-1", ClientState: clientState, ExpirationDateTime: time.Now().Add(f.expiration)}, nil
+}
+
+func (f *fakeSubscriber) RenewSubscription(ctx context.Context, id string, expiration time.Time) (*repositories.Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.renewed++
+	if f.renewErr != nil {
+		return nil, f.renewErr
+	}
+	return &repositories.Subscription{ID: id, ExpirationDateTime: time.Now().Add(f.expiration)}, nil
+}
+
+func (f *fakeSubscriber) DeleteSubscription(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+type fakeListener struct {
+	mu        sync.Mutex
+	refreshed []string
+	pushed    map[string]bool
+	// block, if set, holds the refreshes until it is closed
+	block chan struct{}
+}
+
+func (f *fakeListener) Refresh(ctx context.Context, account string) {
+	f.mu.Lock()
+	f.refreshed = append(f.refreshed, account)
+	block := f.block
+	f.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+}
+
+func (f *fakeListener) SetPushEnabled(account string, enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushed[account] = enabled
+}
+
+func (f *fakeListener) state() ([]string, map[string]bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pushed := map[string]bool{}
+	for k, v := range f.pushed {
+		pushed[k] = v
+	}
+	return append([]string{}, f.refreshed...), pushed
+}
+
+func postNotification(t *testing.T, url, subscriptionID, clientState string) {
+	body := fmt.Sprintf(`{"value":[{"subscriptionId":%q,"clientState":%q,"changeType":"updated","resource":"Users/x/Events/y"}]}`, subscriptionID, clientState)
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func TestValidationHandshake(t *testing.T) {
+	manager := NewManager("https://example.com/notifications", &fakeListener{pushed: map[string]bool{}})
+	server := httptest.NewServer(manager)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"?validationToken=Validation%3A+Testing+client+application", "text/plain", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Validation: Testing client application", string(body))
+}
+
+func TestNotificationTriggersRefresh(t *testing.T) {
+	listener := &fakeListener{pushed: map[string]bool{}}
+	manager := NewManager("https://example.com/notifications", listener)
+	server := httptest.NewServer(manager)
+	defer server.Close()
+
+	subscriber := &fakeSubscriber{expiration: time.Hour * 24}
+	require.NoError(t, manager.Subscribe(context.Background(), "Contoso", subscriber))
+	_, pushed := listener.state()
+	assert.True(t, pushed["Contoso"])
+
+	// Forged notifications are ignored
+	postNotification(t, server.URL, "sub-1", "wrong-state")
+	postNotification(t, server.URL, "unknown", subscriber.clientState)
+
+	postNotification(t, server.URL, "sub-1", subscriber.clientState)
+	require.Eventually(t, func() bool {
+		refreshed, _ := listener.state()
+		return len(refreshed) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	refreshed, _ := listener.state()
+	assert.Equal(t, []string{"Contoso"}, refreshed)
+
+	manager.Close(context.Background())
+	assert.Equal(t, []string{"sub-1"}, subscriber.deleted)
+}
+
+func TestNotificationsAreCoalesced(t *testing.T) {
+	listener := &fakeListener{pushed: map[string]bool{}, block: make(chan struct{})}
+	manager := NewManager("https://example.com/notifications", listener)
+	server := httptest.NewServer(manager)
+	defer server.Close()
+	defer manager.Close(context.Background())
+
+	subscriber := &fakeSubscriber{expiration: time.Hour * 24}
+	require.NoError(t, manager.Subscribe(context.Background(), "Contoso", subscriber))
+
+	postNotification(t, server.URL, "sub-1", subscriber.clientState)
+	require.Eventually(t, func() bool {
+		refreshed, _ := listener.state()
+		return len(refreshed) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The notifications received during the refresh are handled by a single refresh
+	for range 5 {
+		postNotification(t, server.URL, "sub-1", subscriber.clientState)
+	}
+	close(listener.block)
+	require.Eventually(t, func() bool {
+		refreshed, _ := listener.state()
+		return len(refreshed) == 2
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	refreshed, _ := listener.state()
+	assert.Equal(t, []string{"Contoso", "Contoso"}, refreshed)
+}
+
+func TestRenewal(t *testing.T) {
+	listener := &fakeListener{pushed: map[string]bool{}}
+	manager := NewManager("https://example.com/notifications", listener)
+	manager.renewBefore = 24*time.Hour - 50*time.Millisecond
+	defer manager.Close(context.Background())
+
+	subscriber := &fakeSubscriber{expiration: 24 * time.Hour}
+	require.NoError(t, manager.Subscribe(context.Background(), "Contoso", subscriber))
+
+	require.Eventually(t, func() bool {
+		subscriber.mu.Lock()
+		defer subscriber.mu.Unlock()
+		return subscriber.renewed >= 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFallbackToPolling(t *testing.T) {
+	listener := &fakeListener{pushed: map[string]bool{}}
+	manager := NewManager("https://example.com/notifications", listener)
+	manager.renewBefore = 24*time.Hour - 50*time.Millisecond
+	defer manager.Close(context.Background())
+
+	subscriber := &fakeSubscriber{expiration: 24 * time.Hour}
+	require.NoError(t, manager.Subscribe(context.Background(), "Contoso", subscriber))
+
+	subscriber.mu.Lock()
+	subscriber.renewErr = errors.New("404 Not Found")
+	subscriber.createErr = errors.New("403 Forbidden")
+	subscriber.mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		_, pushed := listener.state()
+		return !pushed["Contoso"]
+	}, time.Second, 10*time.Millisecond)
+
+	// Events changed while the subscription was lost are refetched
+	refreshed, _ := listener.state()
+	assert.Equal(t, []string{"Contoso"}, refreshed)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	listener := &fakeListener{pushed: map[string]bool{}}
+	manager := NewManager("https://example.com/notifications", listener)
+	defer manager.Close(context.Background())
+
+	subscriber := &fakeSubscriber{expiration: 24 * time.Hour}
+	require.NoError(t, manager.Subscribe(context.Background(), "Contoso", subscriber))
+	manager.Unsubscribe(context.Background(), "Contoso")
+
+	_, pushed := listener.state()
+	assert.False(t, pushed["Contoso"])
+	assert.Equal(t, []string{"sub-1"}, subscriber.deleted)
+	assert.Empty(t, manager.subscriptions)
+}